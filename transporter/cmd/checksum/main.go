@@ -51,6 +51,41 @@ func main() {
 		false,
 		"enable debug mode")
 
+	srcMountSource := flag.String(
+		"src-mount-source",
+		"",
+		"expected source of src mount point, example: 10.0.0.1:/export, empty means not check")
+
+	srcMountOptions := flag.String(
+		"src-mount-options",
+		"",
+		"expected options of src mount point, example: rw,hard, empty means not check")
+
+	destMountSource := flag.String(
+		"dest-mount-source",
+		"",
+		"expected source of dest mount point, example: 10.0.0.1:/export, empty means not check")
+
+	destMountOptions := flag.String(
+		"dest-mount-options",
+		"",
+		"expected options of dest mount point, example: rw,hard, empty means not check")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -62,6 +97,13 @@ func main() {
 		"algorithm:", *checksumAlgorithm,
 		"isGenerateChecksumFile", *isGenerateChecksumFile,
 		"isDebug:", *isDebug,
+		"srcMountSource:", *srcMountSource,
+		"srcMountOptions:", *srcMountOptions,
+		"destMountSource:", *destMountSource,
+		"destMountOptions:", *destMountOptions,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
 	)
 	log.Println("[checksum-Info]Start check")
 	log.Println("[checksum-Info]Start check format")
@@ -129,6 +171,15 @@ func main() {
 	}
 	log.Println("[checksum-Info]Check algorithm...OK")
 
+	log.Println("[checksum-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[checksum-Error]Failed to load filesystem type policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[checksum-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
+
 	if !(*isDebug) {
 		log.Println("[checksum-Info]Start check mount filesystem")
 		err = filesystem.IsMountPath(*srcMountPath)
@@ -147,7 +198,43 @@ func main() {
 			os.Exit(exitCode)
 		}
 		log.Println("[checksum-Info]Check mount filesystem...OK")
+
+		log.Println("[checksum-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*srcMountPath, filesystem.ParseMountExpect(*srcMountSource, *srcMountOptions))
+		if err != nil {
+			log.Println("[checksum-Error]Failed to verify src mount point:", *srcMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
+
+		err = filesystem.VerifyMountPoint(*destMountPath, filesystem.ParseMountExpect(*destMountSource, *destMountOptions))
+		if err != nil {
+			log.Println("[checksum-Error]Failed to verify dest mount point:", *destMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
+		log.Println("[checksum-Info]Verify mount point...OK")
+	}
+
+	log.Println("[checksum-Info]Start check path is beneath mount point")
+	err = filesystem.CheckPathBeneath(*srcMountPath, *srcRelativePath)
+	if err != nil {
+		log.Println("[checksum-Error]Failed to check src path:", *srcRelativePath,
+			"is beneath mount point:", *srcMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		os.Exit(exitCode)
+	}
+
+	err = filesystem.CheckPathBeneath(*destMountPath, *destRelativePath)
+	if err != nil {
+		log.Println("[checksum-Error]Failed to check dest path:", *destRelativePath,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		os.Exit(exitCode)
 	}
+	log.Println("[checksum-Info]Check path is beneath mount point...OK")
 
 	log.Println("[checksum-Info]End check")
 
@@ -13,8 +13,10 @@ import (
 
 	"transporter/pkg/checksum"
 	"transporter/pkg/client"
+	"transporter/pkg/dryrun"
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
+	"transporter/pkg/rsync_wrapper"
 	"transporter/pkg/rsync_wrapper/dir"
 	"transporter/pkg/rsync_wrapper/file"
 )
@@ -24,8 +26,6 @@ const (
 	slash              = '/'
 	slashStr           = "/"
 	sepFilterRule      = "|"
-	waitNFSCliUpdate   = 5
-	waitNFSCcliLimit   = 5
 	defaultLimtReadDir = 100
 	flagFileName       = "succeed-copy-file"
 	flagContent        = "The generation of this file indicates that all file copy operations have been completed"
@@ -84,6 +84,52 @@ func main() {
 		"limit of retry copy, default limit is 3",
 	)
 
+	retryBackoff := flag.Int(
+		"retry-backoff",
+		-1,
+		"wait time before first retry, time unit is second, double for each retry, default is 5")
+
+	retryBackoffMax := flag.Int(
+		"retry-backoff-max",
+		-1,
+		"limit of wait time before each retry, time unit is second, default is 300")
+
+	retryJitter := flag.Float64(
+		"retry-jitter",
+		-1,
+		"random ratio of wait time before each retry, range is 0~1, default is 0.2")
+
+	retryMaxDuration := flag.Int(
+		"retry-max-duration",
+		0,
+		"limit of total time of retry, time unit is second, default is no limit")
+
+	retryVanishedLimit := flag.Int(
+		"retry-vanished-limit",
+		-1,
+		"limit of retry when file(s) vanished on sender side, default limit is 10")
+
+	retryOverride := flag.String(
+		"retry-override",
+		emptyValue,
+		"override recoverable of rsync exit code, example: 23=unrecoverable,30=recoverable")
+
+	classificationFile := flag.String(
+		"exit-code-config",
+		emptyValue,
+		"absolute path of exit code classification file(json) that override built-in exit code table")
+
+	isSpaceCheck := flag.Bool(
+		"space-check",
+		false,
+		"check free space and quota of dest is enough for size of src that not present at dest before copy, "+
+			"quota is checked only if dest is at local block device, it is skipped for nfs and lustre")
+
+	spaceMargin := flag.Int(
+		"space-margin",
+		0,
+		"safety margin of space check in percent of src size, example: 10 means require 110% of src size")
+
 	isExcludeSrcDir := flag.Bool(
 		"exclude-src",
 		false,
@@ -94,6 +140,17 @@ func main() {
 		false,
 		"overwirte dest exist file, effective for file or file list, if dest is dir, do nothing")
 
+	conflictMode := flag.String(
+		"conflict",
+		"",
+		"policy if final dest file is exist: fail, skip, overwrite, overwrite-if-newer, overwrite-if-different, "+
+			"rename-with-suffix, backup, default is overwrite if overwrite-dest-file, otherwise fail")
+
+	conflictCompare := flag.String(
+		"conflict-compare",
+		filesystem.CompareSizeMtime,
+		"compare method of overwrite-if-different: size-mtime, checksum")
+
 	isGenerateChecksumFile := flag.Bool(
 		"generate-checksum-file",
 		false,
@@ -109,21 +166,116 @@ func main() {
 		emptyValue,
 		"track file relative to the dest mount point")
 
+	isDryRun := flag.Bool(
+		"dry-run",
+		false,
+		"run all checks and print plan of changes to stdout as json, exit with code of the real run, nothing is changed")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	srcMountSource := flag.String(
+		"src-mount-source",
+		"",
+		"expected source of src mount point, example: 10.0.0.1:/export, empty means not check")
+
+	srcMountOptions := flag.String(
+		"src-mount-options",
+		"",
+		"expected options of src mount point, example: rw,hard, empty means not check")
+
+	destMountSource := flag.String(
+		"dest-mount-source",
+		"",
+		"expected source of dest mount point, example: 10.0.0.1:/export, empty means not check")
+
+	destMountOptions := flag.String(
+		"dest-mount-options",
+		"",
+		"expected options of dest mount point, example: rw,hard, empty means not check")
+
+	nfsWaitInterval := flag.Int(
+		"nfs-wait-interval",
+		-1,
+		"second to wait NFS client cache update between stat of not exist path, negative means default of command")
+
+	nfsWaitAttempts := flag.Int(
+		"nfs-wait-attempts",
+		-1,
+		"max number of stat of not exist path, negative means default of command")
+
+	nfsCacheBust := flag.String(
+		"nfs-cache-bust",
+		"",
+		"bust NFS client cache of parent dir before stat, none, open-parent or list-parent, empty means default of command")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
+	permMode := flag.String(
+		"perm-policy",
+		filesystem.PermPreserve,
+		"permission policy of created or exist dirs and files: preserve, inherit or enforce[:octal mode], example: enforce:0750, "+
+			"preserve never change exist path, inherit apply permission of parent dir to new path, enforce without mode means 0775")
+
 	isHandleSparse := flag.Bool(
 		"sparse",
 		false,
 		"try to handle sparse files efficiently")
 
+	preserve := flag.String(
+		"preserve",
+		rsync_wrapper.PreserveDefault,
+		"preservation profile of copy, comma separated attributes: perms,owner,group,times,acls,xattrs,hardlinks,devices,atimes,crtimes, "+
+			"attribute with prefix - is removed, default(perms,owner,group,times,acls,hardlinks) and none are able to be used as base, "+
+			"example: default,xattrs,-owner,-group")
+
+	rsyncOptions := flag.String(
+		"rsync-options",
+		"",
+		"comma separated extra rsync options, allowed: --bwlimit=,--checksum,--inplace,--append-verify,--compress,"+
+			"--whole-file,--max-size=,--link-dest=(absolute path beneath dest mount), example: --bwlimit=10m,--checksum")
+
+	mirrorMode := flag.String(
+		"mirror",
+		"",
+		"mirror mode of dir copy, extraneous files of dest dir are deleted: delete, delete-after or delete-delay, "+
+			"deletions are previewed by dry run before copy, empty means copy only")
+
+	maxDelete := flag.Int(
+		"max-delete",
+		dir.MaxDeleteUnlimited,
+		"limit of deleted files of mirror, copy is not started if previewed deletions exceed it, negative means no limit")
+
 	filterRule := flag.String(
 		"filter",
 		emptyValue,
 		"rules to selectively exclude certain files, use '|' to separate multiple rules, avoid file names containing '|'")
 
+	timeout := flag.Int(
+		"timeout",
+		0,
+		"limit of total time for copy include retry, time unit is second, default is no limit")
+
+	stallTimeout := flag.Int(
+		"stall-timeout",
+		0,
+		"kill and retry rsync if no progress within it, time unit is second, default is disable")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -139,14 +291,43 @@ func main() {
 		"reportAddress:", *addrReport,
 		"reportInterval(second):", *intervalReport,
 		"retryLimit:", *retryLimit,
+		"retryBackoff(second):", *retryBackoff,
+		"retryBackoffMax(second):", *retryBackoffMax,
+		"retryJitter:", *retryJitter,
+		"retryMaxDuration(second):", *retryMaxDuration,
+		"retryVanishedLimit:", *retryVanishedLimit,
+		"retryOverride:", *retryOverride,
+		"classificationFile:", *classificationFile,
+		"isSpaceCheck:", *isSpaceCheck,
+		"spaceMargin:", *spaceMargin,
 		"isExcludeSrcDir:", *isExcludeSrcDir,
 		"isOverwriteDestFile:", *isOverwriteDestFile,
+		"conflict:", *conflictMode,
+		"conflictCompare:", *conflictCompare,
 		"isGenerateChecksumFile:", *isGenerateChecksumFile,
 		"fileSuffixForChecksum:", *fileSuffixForChecksum,
 		"trackFileRelativePath:", *trackFileRelativePath,
 		"isHandleSparse:", *isHandleSparse,
 		"filterRule:", *filterRule,
+		"timeout(second):", *timeout,
+		"stallTimeout(second):", *stallTimeout,
+		"isDryRun:", *isDryRun,
 		"isDebug:", *isDebug,
+		"srcMountSource:", *srcMountSource,
+		"srcMountOptions:", *srcMountOptions,
+		"destMountSource:", *destMountSource,
+		"destMountOptions:", *destMountOptions,
+		"nfsWaitInterval(second):", *nfsWaitInterval,
+		"nfsWaitAttempts:", *nfsWaitAttempts,
+		"nfsCacheBust:", *nfsCacheBust,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
+		"permPolicy:", *permMode,
+		"preserve:", *preserve,
+		"rsyncOptions:", *rsyncOptions,
+		"mirror:", *mirrorMode,
+		"maxDelete:", *maxDelete,
 	)
 
 	log.Println("[copy-Info]Start basic check")
@@ -158,6 +339,7 @@ func main() {
 		err                    error
 		isCreateTrackFile      bool
 		exitCode               int
+		permChanges            []filesystem.PermChange
 		isChecksumSuffixEmpty  bool
 		isFileNeedChecksum     bool
 		checksumFileSuffixList []string
@@ -201,6 +383,43 @@ func main() {
 		isCreateTrackFile = true
 	}
 
+	if *classificationFile != emptyValue {
+		err = rsync_wrapper.LoadClassificationFile(*classificationFile)
+		if err != nil {
+			log.Println("[copy-Error]Failed to load exit code classification file:", *classificationFile,
+				"and err:", err.Error())
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+
+	retryPolicy := rsync_wrapper.NewRetryPolicy(*retryLimit)
+	if *retryBackoff >= 0 {
+		retryPolicy.Backoff = time.Duration(*retryBackoff) * time.Second
+	}
+	if *retryBackoffMax >= 0 {
+		retryPolicy.BackoffMax = time.Duration(*retryBackoffMax) * time.Second
+	}
+	if *retryJitter >= 0 {
+		if *retryJitter > 1 {
+			log.Println("[copy-Error]Unavailable retry jitter:", *retryJitter)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+		retryPolicy.Jitter = *retryJitter
+	}
+	if *retryMaxDuration > 0 {
+		retryPolicy.MaxDuration = time.Duration(*retryMaxDuration) * time.Second
+	}
+	if *retryVanishedLimit >= 0 {
+		retryPolicy.MaxVanished = *retryVanishedLimit
+	}
+	if *retryOverride != emptyValue {
+		retryPolicy.Overrides, err = rsync_wrapper.ParseRetryOverrides(*retryOverride)
+		if err != nil {
+			log.Println("[copy-Error]Unavailable retry override:", *retryOverride, "and err:", err.Error())
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+
 	// not need check err, because format of mount point has already been checked above
 	srcPath, _ = filesystem.AbsolutePath(*srcMountPath, *srcRelativePath)
 	destTempDirPath, _ = filesystem.AbsolutePath(*destMountPath, *destTempDirRelativePath)
@@ -228,6 +447,71 @@ func main() {
 	}
 	log.Println("[copy-Info]Check basic format...OK")
 
+	waitPolicy, err := filesystem.NewWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable NFS wait policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	// flag file of complete file copy is usually not exist, not need wait long
+	flagWaitPolicy, _ := filesystem.NewQuickWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	log.Println("[copy-Info]NFS wait policy, interval:", waitPolicy.Interval.String(),
+		"attempts:", waitPolicy.Attempts,
+		"cache bust:", waitPolicy.CacheBust,
+		"flag file, interval:", flagWaitPolicy.Interval.String(),
+		"attempts:", flagWaitPolicy.Attempts,
+		"cache bust:", flagWaitPolicy.CacheBust)
+
+	if len(*conflictMode) == 0 {
+		*conflictMode = filesystem.ConflictFail
+		if *isOverwriteDestFile {
+			*conflictMode = filesystem.ConflictOverwrite
+		}
+	}
+	conflictPolicy, err := filesystem.ParseConflictPolicy(*conflictMode, *conflictCompare)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable conflict policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	preserveProfile, err := rsync_wrapper.ParsePreserveProfile(*preserve)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable preservation profile:", *preserve, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	log.Println("[copy-Info]Preservation profile:", preserveProfile.String(),
+		"rsync option:", preserveProfile.RsyncOption())
+
+	extraOptionList, err := rsync_wrapper.ParseExtraOptions(*rsyncOptions)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable extra rsync options:", *rsyncOptions, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	log.Println("[copy-Info]Extra rsync options:", extraOptionList)
+
+	mirror, err := dir.ParseMirror(*mirrorMode, *maxDelete)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable mirror mode:", *mirrorMode, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	permPolicy, err := filesystem.ParsePermPolicy(*permMode)
+	if err != nil {
+		log.Println("[copy-Error]Unavailable permission policy:", *permMode, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	plan := dryrun.New("copy", *isDryRun)
+
+	log.Println("[copy-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[copy-Error]Failed to load filesystem type policy, err:", err.Error())
+		plan.ExitFail(srcPath1, destFinalDirPath, exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[copy-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
+
 	if !(*isDebug) {
 		log.Println("[copy-Info]Start check mount filesystem")
 		err = filesystem.IsMountPath(*srcMountPath)
@@ -235,7 +519,7 @@ func main() {
 			log.Println("[copy-Info]Failed to check src mount filesystem:", *srcMountPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*srcMountPath, "", exitCode)
 		}
 
 		err = filesystem.IsMountPath(*destMountPath)
@@ -243,11 +527,74 @@ func main() {
 			log.Println("[copy-Info]Failed to check dest mount filesystem:", *destMountPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*destMountPath, "", exitCode)
 		}
 		log.Println("[copy-Info]Check mount filesystem...OK")
+
+		log.Println("[copy-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*srcMountPath, filesystem.ParseMountExpect(*srcMountSource, *srcMountOptions))
+		if err != nil {
+			log.Println("[copy-Error]Failed to verify src mount point:", *srcMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*srcMountPath, "", exitCode)
+		}
+
+		err = filesystem.VerifyMountPoint(*destMountPath, filesystem.ParseMountExpect(*destMountSource, *destMountOptions))
+		if err != nil {
+			log.Println("[copy-Error]Failed to verify dest mount point:", *destMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*destMountPath, "", exitCode)
+		}
+		log.Println("[copy-Info]Verify mount point...OK")
+	}
+
+	log.Println("[copy-Info]Start check path is beneath mount point")
+	err = filesystem.CheckPathBeneath(*srcMountPath, *srcRelativePath)
+	if err != nil {
+		log.Println("[copy-Error]Failed to check src path:", *srcRelativePath,
+			"is beneath mount point:", *srcMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(srcPath1, "", exitCode)
+	}
+
+	err = filesystem.CheckPathBeneath(*destMountPath, *destTempDirRelativePath)
+	if err != nil {
+		log.Println("[copy-Error]Failed to check dest temp dir path:", *destTempDirRelativePath,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(destTempDirPath, "", exitCode)
+	}
+
+	err = filesystem.CheckPathBeneath(*destMountPath, *destFinalDirRelativePath)
+	if err != nil {
+		log.Println("[copy-Error]Failed to check dest final dir path:", *destFinalDirRelativePath,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(destFinalDirPath, "", exitCode)
 	}
 
+	if isCreateTrackFile {
+		err = filesystem.CheckPathBeneath(*destMountPath, *trackFileRelativePath)
+		if err != nil {
+			log.Println("[copy-Error]Failed to check track file path:", *trackFileRelativePath,
+				"is beneath mount point:", *destMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*trackFileRelativePath, "", exitCode)
+		}
+	}
+	for _, optionPath := range rsync_wrapper.ExtraOptionPathList(extraOptionList) {
+		err = filesystem.CheckAbsPathBeneath(*destMountPath, optionPath)
+		if err != nil {
+			log.Println("[copy-Error]Failed to check path of extra rsync option:", optionPath,
+				"is beneath mount point:", *destMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(optionPath, "", exitCode)
+		}
+	}
+	log.Println("[copy-Info]Check path is beneath mount point...OK")
+
 	log.Println("[copy-Info]End basic check")
 
 	/*
@@ -264,9 +611,12 @@ func main() {
 						- if not equal -> rm file from temp dir -> retry rsync
 					- create final dest dir
 					- rename file from temp dir to final dir
-						- if file is exist in final dir
-							- if overwrite -> rename directly
-							- if not overwrite -> EEXIST
+						- if file is exist in final dir -> resolve by conflict policy:
+							- fail -> EEXIST
+							- skip, or not newer/different -> keep final file
+							- overwrite, or newer/different -> rename directly
+							- rename-with-suffix -> rename to new name like: file (1).txt
+							- backup -> rename final file to backup, then rename directly
 						- if file not exist -> rename directly
 					- create track file
 					- rm temp dir
@@ -285,27 +635,18 @@ func main() {
 		srcInfo      os.FileInfo
 		retryStatNum int
 	)
-	for {
-		if retryStatNum >= waitNFSCcliLimit {
+	srcInfo, retryStatNum, err = waitPolicy.Stat(srcPath1)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println("[copy-Error]Src path:", srcPath1,
 				"is not exist, retry stat num:", retryStatNum)
-			os.Exit(exit_code.ErrNoSuchFileOrDir)
-		}
-
-		srcInfo, err = os.Stat(srcPath1)
-		if err == nil {
-			break
-		}
-
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println("[copy-Error]Failed to stat src path:", srcPath1,
-				"and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(srcPath1, "", exit_code.ErrNoSuchFileOrDir)
 		}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		retryStatNum += 1
+		log.Println("[copy-Error]Failed to stat src path:", srcPath1,
+			"and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(srcPath1, "", exitCode)
 	}
 	log.Println("[copy-Info]Check src path is exist...Exist")
 
@@ -316,26 +657,78 @@ func main() {
 		if !errors.Is(err, fs.ErrNotExist) {
 			log.Println("[copy-Error]Failed to stat temp dest dir:", destTempDirPath, "and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(destTempDirPath, "", exitCode)
 		}
 
 		log.Println("[copy-Info]Check temp dest dir...NotExist")
-		err = filesystem.CheckOrCreateDir(destTempDirPath)
+		if plan.IsEnable() {
+			plan.Add(dryrun.OpCreateDir, destTempDirPath, "", "temp dest dir is not exist")
+			err = nil
+		} else {
+			permChanges, err = filesystem.CheckOrCreateDir(destTempDirPath, permPolicy)
+			logPermChanges(permChanges)
+		}
 		if err != nil {
 			log.Println("[copy-Error]Failed to create temp dest dir:", destTempDirPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(destTempDirPath, "", exitCode)
 		}
 		log.Println("[copy-Info]Succeed to create temp dest dir:", destTempDirPath)
 	} else {
 		if !destTempDirInfo.IsDir() {
 			log.Println("[copy-Info]Check temp dest dir...Exist, but is file")
 			log.Println("[copy-Error]Temp dest dir is a exist file")
-			os.Exit(exit_code.ErrNotDirectory)
+			plan.ExitFail(destTempDirPath, "", exit_code.ErrNotDirectory)
 		}
 	}
 
+	if *isSpaceCheck {
+		log.Println("[copy-Info]Start check space of dest, src:", srcPath1, "dest:", destTempDirPath)
+		var (
+			srcSize   uint64
+			spaceInfo filesystem.SpaceInfo
+		)
+		// data copied by a previous run is present at dest, it is not counted
+		spaceDestPath := destTempDirPath + srcInfo.Name()
+		if srcInfo.IsDir() && *isExcludeSrcDir {
+			spaceDestPath = destTempDirPath
+		}
+		srcSize, err = filesystem.PathSizeToCopy(srcPath1, spaceDestPath)
+		if err != nil {
+			log.Println("[copy-Error]Failed to get size of src:", srcPath1, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(srcPath1, spaceDestPath, exitCode)
+		}
+
+		spaceInfo, err = filesystem.AvailableSpace(destTempDirPath)
+		if err != nil {
+			log.Println("[copy-Error]Failed to get available space of dest:", destTempDirPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(destTempDirPath, "", exitCode)
+		}
+
+		if spaceInfo.IsQuotaSkipped {
+			log.Println("[copy-Warning]Quota of dest is not checked, it is not at local block device, fs type:",
+				spaceInfo.FSType)
+		}
+
+		spaceRequired := filesystem.SpaceRequired(srcSize, *spaceMargin)
+		log.Println("[copy-Info]Size of src to copy:", srcSize,
+			"required with margin:", spaceRequired,
+			"free of filesystem:", spaceInfo.Free,
+			"is quota:", spaceInfo.IsQuota,
+			"free of quota:", spaceInfo.QuotaFree,
+			"quota type:", spaceInfo.QuotaType)
+		err = spaceInfo.Check(spaceRequired)
+		if err != nil {
+			log.Println("[copy-Error]Space of dest is not enough, err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(srcPath1, destTempDirPath, exitCode)
+		}
+		log.Println("[copy-Info]Check space of dest...OK")
+	}
+
 	// src is dir
 	if srcInfo.IsDir() {
 
@@ -344,7 +737,7 @@ func main() {
 			log.Println(
 				"[copy-Error]The source and destination are the same file, parent dir:",
 				destFinalDirPath)
-			os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+			plan.ExitFail(srcPath1, destFinalDirPath, exit_code.ErrSrcAndDstAreSameFile)
 		}
 
 		// case: cp -rf /home/dir /home/
@@ -352,13 +745,13 @@ func main() {
 			log.Println(
 				"[copy-Error]The source and destination are the same file, parent dir:",
 				destFinalDirPath)
-			os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+			plan.ExitFail(srcPath1, destFinalDirPath, exit_code.ErrSrcAndDstAreSameFile)
 		}
 
 		if !(*isExcludeSrcDir) && ((srcPath1 + slashStr) == destFinalDirPath) {
 			log.Println("[copy-Error]Cannot copy a directory into itself, dir:",
 				srcPath1)
-			os.Exit(exit_code.ErrDirectoryNestedItself)
+			plan.ExitFail(srcPath1, destFinalDirPath, exit_code.ErrDirectoryNestedItself)
 		}
 
 		var filterRuleList []string
@@ -375,13 +768,13 @@ func main() {
 				log.Println("[copy-Error]Faild to check final dest dir is available:", destFinalDirPath,
 					"and err:", err.Error())
 				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				plan.ExitFail(destFinalDirPath, "", exitCode)
 			}
 
 			if !isDestFinalDirAvailable {
 				log.Println("[copy-Error]Unavailable final dest dir:", destFinalDirPath,
 					", there is same name file at src dir:", srcPath1)
-				os.Exit(exit_code.ErrFileIsExists)
+				plan.ExitFail(srcPath1, destFinalDirPath, exit_code.ErrFileIsExists)
 			}
 			log.Println("[copy-Info]Check final dest dir...Available")
 
@@ -399,8 +792,42 @@ func main() {
 			ReportClient:     rc,
 			ReportInterval:   *intervalReport,
 			ReportAddr:       *addrReport,
-			RetryLimit:       *retryLimit,
+			RetryPolicy:      retryPolicy,
+			Preserve:         preserveProfile,
 			FilterList:       filterRuleList,
+			ExtraOptions:     extraOptionList,
+			Mirror:           mirror,
+			Timeout:          *timeout,
+			StallTimeout:     *stallTimeout,
+		}
+
+		if plan.IsEnable() {
+			plan.Add(dryrun.OpCopy, srcPath1, destTempDirPath, "")
+			plan.Itemize, exitCode = dir.DryRun(reqCopyDir)
+			for _, deletePath := range dir.DeleteList(plan.Itemize) {
+				plan.Add(dryrun.OpRemove, filepath.Join(destTempDirPath, deletePath), "", "mirror "+mirror.Mode)
+			}
+			plan.Exit(exitCode)
+		}
+
+		if mirror.IsEnable() {
+			log.Println("[copy-Info]Start preview deletions of mirror")
+			var deleteList []string
+			deleteList, exitCode = dir.PreviewDelete(reqCopyDir)
+			if *addrReport != emptyValue {
+				err = dir.ReportDeletePreview(reqCopyDir, deleteList, exitCode)
+				if err != nil {
+					log.Println("[copy-Error]Failed to report deletions of mirror to:", *addrReport,
+						"dir copy is not started, err:", err.Error())
+					os.Exit(exit_code.ExitCodeConvertWithErr(err))
+				}
+				log.Println("[copy-Info]Report deletions of mirror to:", *addrReport, "...OK")
+			}
+			if exitCode != exit_code.Succeed {
+				log.Println("[copy-Error]Failed to preview deletions of mirror, dir copy is not started, exit code:", exitCode)
+				os.Exit(exitCode)
+			}
+			log.Println("[copy-Info]Preview deletions of mirror...OK")
 		}
 
 		startTime := time.Now().String()
@@ -417,11 +844,16 @@ func main() {
 	}
 
 	// src is file
+	if mirror.IsEnable() {
+		log.Println("[copy-Error]Mirror mode is only available for dir copy, src:", srcPath1)
+		plan.ExitFail(srcPath1, "", exit_code.ErrInvalidArgument)
+	}
+
 	log.Println("[copy-Info]Src is file, start format check")
 	isPathAvailable = filesystem.CheckFilePathFormat(srcPath1)
 	if !isPathAvailable {
 		log.Println("[copy-Error]Unavailable src file path:", srcPath1)
-		os.Exit(exit_code.ErrInvalidArgument)
+		plan.ExitFail(srcPath1, "", exit_code.ErrInvalidArgument)
 	}
 	log.Println("[copy-Info]Check src path format...OK")
 
@@ -432,7 +864,7 @@ func main() {
 		isPathAvailable = filesystem.CheckFilePathFormat(trackFilePath)
 		if !isPathAvailable {
 			log.Println("[copy-Error]Unavailable track file path:", trackFilePath)
-			os.Exit(exit_code.ErrInvalidArgument)
+			plan.ExitFail(trackFilePath, "", exit_code.ErrInvalidArgument)
 		}
 		log.Println("[copy-Info]Check track file format...OK")
 	}
@@ -444,23 +876,29 @@ func main() {
 		if !errors.Is(err, fs.ErrNotExist) {
 			log.Println("[copy-Error]Failed to stat final dest dir:", destFinalDirPath, "and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(destFinalDirPath, "", exitCode)
 		}
 
 		log.Println("[copy-Info]Check final dest dir...NotExist")
-		err = filesystem.CheckOrCreateDir(destFinalDirPath)
+		if plan.IsEnable() {
+			plan.Add(dryrun.OpCreateDir, destFinalDirPath, "", "final dest dir is not exist")
+			err = nil
+		} else {
+			permChanges, err = filesystem.CheckOrCreateDir(destFinalDirPath, permPolicy)
+			logPermChanges(permChanges)
+		}
 		if err != nil {
 			log.Println("[copy-Error]Failed to create final dest dir:", destFinalDirPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(destFinalDirPath, "", exitCode)
 		}
 		log.Println("[copy-Info]Succeed to create final dest dir:", destFinalDirPath)
 	} else {
 		if !destFinalDirInfo.IsDir() {
 			log.Println("[copy-Info]Check final dest dir...Exist, but is file")
 			log.Println("[copy-Error]Final dest dir is a exist file")
-			os.Exit(exit_code.ErrNotDirectory)
+			plan.ExitFail(destFinalDirPath, "", exit_code.ErrNotDirectory)
 		}
 	}
 
@@ -469,18 +907,35 @@ func main() {
 	// case: cp /home/dir/file /home/dir/ or cp /home/dir/file /home/dir/file
 	if srcPath1 == destFinalFileName {
 		log.Println("[copy-Error]The source and destination are the same file, file:", srcPath1)
-		os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+		plan.ExitFail(srcPath1, destFinalFileName, exit_code.ErrSrcAndDstAreSameFile)
 	}
 
 	// check succeed-copy-file is exist, if exist -> exit with succeed
-	if isCompleteFileCopy(destTempDirPath) {
+	if isCompleteFileCopy(destTempDirPath, flagWaitPolicy) {
 		log.Println(
 			"[copy-Info]Flag file: succeed-copy-file is exist, "+
 				"all step of file copy has been complete, exit with",
 			exit_code.ErrCopyFileSucceed)
+		if plan.IsEnable() {
+			plan.Add(dryrun.OpSkip, srcPath1, destFinalFileName, "file copy has been complete")
+			plan.Exit(exit_code.ErrCopyFileSucceed)
+		}
 		os.Exit(exit_code.ErrCopyFileSucceed)
 	}
 
+	if plan.IsEnable() {
+		isFileNeedChecksum = !isChecksumSuffixEmpty && isNeedChecksum(fileName, checksumFileSuffixList)
+		exitCode = planFileCopy(plan, srcPath1, destTempDirPath+fileName, destFinalFileName,
+			conflictPolicy, isFileNeedChecksum && *isGenerateChecksumFile)
+		if exitCode == exit_code.ErrCopyFileSucceed {
+			if isCreateTrackFile {
+				plan.Add(dryrun.OpCreateFile, trackFilePath, "", "track file")
+			}
+			plan.Add(dryrun.OpRemove, destTempDirPath, "", "temp dest dir")
+		}
+		plan.Exit(exitCode)
+	}
+
 	log.Println("[copy-Info]Start copy file, Step 1 -> copy file from src:", srcPath1,
 		"to temp dest dir:", destTempDirPath)
 
@@ -491,7 +946,11 @@ func main() {
 		SrcPath:        srcPath1,
 		DestPath:       destTempFileName,
 		IsHandleSparse: *isHandleSparse,
-		RetryLimit:     *retryLimit,
+		RetryPolicy:    retryPolicy,
+		Preserve:       preserveProfile,
+		ExtraOptions:   extraOptionList,
+		Timeout:        *timeout,
+		StallTimeout:   *stallTimeout,
 	}
 	exitCode = file.CopyFile(reqCopyFile)
 	if exitCode != exit_code.Succeed {
@@ -571,26 +1030,49 @@ func main() {
 			os.Exit(exit_code.ErrIsDirectory)
 		}
 
-		if !(*isOverwriteDestFile) {
-			log.Println("[copy-Error]Final dest file is exist file, but not overwrite:", destFinalFileName)
-			os.Exit(exit_code.ErrFileIsExists)
-		}
+		log.Println("[copy-Info]Final dest file is exist file:", destFinalFileName,
+			"resolve by conflict policy:", conflictPolicy.Mode)
 	}
 
-	// rename file from temp dir to final dir
-	err = os.Rename(destTempFileName, destFinalFileName)
+	var conflictResult filesystem.ConflictResult
+	conflictResult, err = conflictPolicy.Resolve(srcPath1, destFinalFileName)
 	if err != nil {
-		log.Println("[copy-Error]Failed to rename dest file from temp:", destTempFileName,
-			"to final:", destFinalFileName, "and err:", err.Error())
+		log.Println("[copy-Error]Failed to resolve conflict of final dest file:", destFinalFileName,
+			"and err:", err.Error())
 		exitCode = exit_code.ExitCodeConvertWithErr(err)
 		os.Exit(exitCode)
 	}
-	log.Println(
-		"[copy-Info]Succeed to rename file from temp dest:", destTempFileName,
-		"to final dest:", destFinalFileName)
 
-	if isFileNeedChecksum && *isGenerateChecksumFile {
-		err = os.Rename(destTempCheckFileName, destFinalCheckFileName)
+	if conflictResult.Skip {
+		log.Println("[copy-Info]Final dest file is exist, skip by conflict policy:", destFinalFileName)
+	} else if conflictResult.Path != destFinalFileName {
+		log.Println("[copy-Info]Final dest file is exist, rename to:", conflictResult.Path)
+		destFinalFileName = conflictResult.Path
+		destFinalCheckFileName = destFinalFileName + checksum.MD5Suffix
+	}
+
+	// rename file from temp dir to final dir, final dest file is replaced only if it is resolved as exist,
+	// file created by concurrent writer after resolve is not overwritten.
+	if !conflictResult.Skip {
+		err = conflictResult.Replace(destTempFileName)
+		if err != nil {
+			log.Println("[copy-Error]Failed to rename dest file from temp:", destTempFileName,
+				"to final:", destFinalFileName, "backup:", conflictResult.BackupPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
+		if len(conflictResult.BackupPath) != 0 {
+			log.Println("[copy-Info]Succeed to backup final dest file:", destFinalFileName,
+				"to:", conflictResult.BackupPath)
+		}
+		log.Println(
+			"[copy-Info]Succeed to rename file from temp dest:", destTempFileName,
+			"to final dest:", destFinalFileName)
+	}
+
+	// checksum file follows conflict result of data file, it is not overwritten unless data file is
+	if !conflictResult.Skip && isFileNeedChecksum && *isGenerateChecksumFile {
+		err = checksumConflictResult(conflictResult, destFinalCheckFileName).Replace(destTempCheckFileName)
 		if err != nil {
 			log.Println("[copy-Error]Failed to rename dest checksum file from temp:", destTempCheckFileName,
 				"to final:", destFinalCheckFileName, "and err:", err.Error())
@@ -604,7 +1086,8 @@ func main() {
 
 	if isCreateTrackFile {
 		log.Println("[copy-Info]Start create track file:", trackFilePath)
-		err = filesystem.CheckOrCreateFile(trackFilePath, false)
+		permChanges, err = filesystem.CheckOrCreateFile(trackFilePath, false, permPolicy)
+		logPermChanges(permChanges)
 		if err != nil {
 			log.Println("[copy-Error]Failed to check or create track file:", trackFilePath,
 				"and err:", err.Error())
@@ -788,51 +1271,39 @@ func buildFlagFilePath(dirPath string) (flagFilePath string) {
 	return flagFilePath
 }
 
-func isCompleteFileCopy(tmpDestDir string) bool {
+// isCompleteFileCopy check flag file of complete file copy is exist, flag file is usually not exist,
+// so policy that allow path not exist should be used.
+func isCompleteFileCopy(tmpDestDir string, waitPolicy filesystem.WaitPolicy) bool {
 	flagFilePath := buildFlagFilePath(tmpDestDir)
 
 	log.Println("[copy-Info]Start check 'succeed-copy-file' is exist")
-	var (
-		flagFileInfo os.FileInfo
-		err          error
-		retryStatNum int
-		exitCode     int
-	)
-	for {
-		if retryStatNum >= waitNFSCcliLimit {
+	flagFileInfo, retryStatNum, err := waitPolicy.Stat(flagFilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println(
 				"[copy-Warning]Flag file: succeed-copy-file path:", flagFilePath,
 				"is not exist, retry stat num:", retryStatNum)
 			return false
 		}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		flagFileInfo, err = os.Stat(flagFilePath)
-		if err == nil {
-			if flagFileInfo.IsDir() {
-				log.Println(
-					"[copy-Warning]Flag file: succeed-copy-file is exist but is dir:",
-					flagFilePath)
-				return false
-			}
-
-			log.Println(
-				"[copy-Info]Flag file: succeed-copy-file is exist file:",
-				flagFilePath)
-			return true
-		}
-
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println(
-				"[copy-Error]Failed to stat flag path:", flagFilePath,
-				"and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
-		}
+		log.Println(
+			"[copy-Error]Failed to stat flag path:", flagFilePath,
+			"and err:", err.Error())
+		exitCode := exit_code.ExitCodeConvertWithErr(err)
+		os.Exit(exitCode)
+	}
 
-		retryStatNum += 1
+	if flagFileInfo.IsDir() {
+		log.Println(
+			"[copy-Warning]Flag file: succeed-copy-file is exist but is dir:",
+			flagFilePath)
+		return false
 	}
 
+	log.Println(
+		"[copy-Info]Flag file: succeed-copy-file is exist file:",
+		flagFilePath)
+	return true
 }
 
 func setCompleteFlagFileCopy(src, tmpDestDir, finalDestDir string) error {
@@ -868,3 +1339,80 @@ func setCompleteFlagFileCopy(src, tmpDestDir, finalDestDir string) error {
 
 	return nil
 }
+
+// planFileCopy add actions of file copy to plan, include resolve conflict of final dest file,
+// return exit code of the real run.
+func planFileCopy(plan *dryrun.Plan, src, destTemp, destFinal string,
+	conflictPolicy filesystem.ConflictPolicy, isGenerateChecksumFile bool) int {
+	plan.Add(dryrun.OpCopy, src, destTemp, "")
+	if isGenerateChecksumFile {
+		plan.Add(dryrun.OpChecksum, src, destTemp+checksum.MD5Suffix, "generate checksum file")
+	}
+
+	destFinalInfo, err := os.Stat(destFinal)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("[copy-Error]Failed to stat final dest file:", destFinal, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	if destFinalInfo != nil && destFinalInfo.IsDir() {
+		log.Println("[copy-Error]Final dest file exist but is dir:", destFinal)
+		return exit_code.ErrIsDirectory
+	}
+
+	result, err := conflictPolicy.Resolve(src, destFinal)
+	if err != nil {
+		log.Println("[copy-Error]Failed to resolve conflict of final dest file:", destFinal,
+			"and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	if result.Skip {
+		plan.Add(dryrun.OpSkip, destTemp, destFinal, "final dest file is exist, conflict policy: "+conflictPolicy.Mode)
+		return exit_code.ErrCopyFileSucceed
+	}
+
+	if len(result.BackupPath) != 0 {
+		plan.Add(dryrun.OpBackup, destFinal, result.BackupPath, "final dest file is exist")
+	}
+
+	reason := ""
+	if result.IsExist {
+		reason = "replace exist final dest file"
+	} else if result.Path != destFinal {
+		reason = "final dest file is exist, conflict policy: " + conflictPolicy.Mode
+	}
+	plan.Add(dryrun.OpRename, destTemp, result.Path, reason)
+	if isGenerateChecksumFile {
+		plan.Add(dryrun.OpRename, destTemp+checksum.MD5Suffix, result.Path+checksum.MD5Suffix, "")
+	}
+
+	return exit_code.ErrCopyFileSucceed
+}
+
+// logPermChanges log permission changes that made by policy.
+func logPermChanges(changes []filesystem.PermChange) {
+	for _, change := range changes {
+		log.Println("[copy-Info]Permission change:", change.String())
+	}
+}
+
+// checksumConflictResult return conflict result of checksum file that follow result of data file,
+// exist checksum file is replaced only if data file is resolved as exist, and it is backed up with same suffix
+// if data file is backed up. Otherwise checksum file created by concurrent writer is not overwritten.
+func checksumConflictResult(result filesystem.ConflictResult, checkFileName string) filesystem.ConflictResult {
+	checkResult := filesystem.ConflictResult{
+		Path:    checkFileName,
+		IsExist: result.IsExist && len(result.BackupPath) == 0,
+	}
+
+	if len(result.BackupPath) != 0 {
+		_, err := os.Lstat(checkFileName)
+		if err == nil {
+			checkResult.IsExist = true
+			checkResult.BackupPath = checkFileName + strings.TrimPrefix(result.BackupPath, result.Path)
+		}
+	}
+
+	return checkResult
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"io"
@@ -15,8 +16,10 @@ import (
 
 	"golang.org/x/sys/unix"
 	"transporter/pkg/checksum"
+	"transporter/pkg/dryrun"
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
+	"transporter/pkg/rsync_wrapper"
 	"transporter/pkg/rsync_wrapper/file"
 )
 
@@ -24,8 +27,6 @@ const (
 	emptyValue              = "empty"
 	slash                   = '/'
 	slashStr                = "/"
-	waitNFSCliUpdate        = 5
-	waitNFSCcliLimit        = 5
 	delimLF                 = '\n'
 	delimLFStr              = "\n"
 	delimCRLFStr            = "\r\n"
@@ -84,6 +85,17 @@ func main() {
 		false,
 		"overwirte dest exist file, if dest is dir, do nothing")
 
+	conflictMode := flag.String(
+		"conflict",
+		"",
+		"policy if dest file is exist: fail, skip, overwrite, overwrite-if-newer, overwrite-if-different, "+
+			"rename-with-suffix, backup, default is overwrite if overwrite-dest-file, otherwise fail")
+
+	conflictCompare := flag.String(
+		"conflict-compare",
+		filesystem.CompareSizeMtime,
+		"compare method of overwrite-if-different: size-mtime, checksum")
+
 	isGenerateChecksumFile := flag.Bool(
 		"generate-checksum-file",
 		false,
@@ -109,16 +121,147 @@ func main() {
 		-1,
 		"limit of retry copy, default limit is 3")
 
+	retryBackoff := flag.Int(
+		"retry-backoff",
+		-1,
+		"wait time before first retry, time unit is second, double for each retry, default is 5")
+
+	retryBackoffMax := flag.Int(
+		"retry-backoff-max",
+		-1,
+		"limit of wait time before each retry, time unit is second, default is 300")
+
+	retryJitter := flag.Float64(
+		"retry-jitter",
+		-1,
+		"random ratio of wait time before each retry, range is 0~1, default is 0.2")
+
+	retryMaxDuration := flag.Int(
+		"retry-max-duration",
+		0,
+		"limit of total time of retry, time unit is second, default is no limit")
+
+	retryVanishedLimit := flag.Int(
+		"retry-vanished-limit",
+		-1,
+		"limit of retry when file(s) vanished on sender side, default limit is 10")
+
+	retryOverride := flag.String(
+		"retry-override",
+		emptyValue,
+		"override recoverable of rsync exit code, example: 23=unrecoverable,30=recoverable")
+
+	classificationFile := flag.String(
+		"exit-code-config",
+		emptyValue,
+		"absolute path of exit code classification file(json) that override built-in exit code table")
+
 	isHandleSparse := flag.Bool(
 		"sparse",
 		false,
 		"try to handle sparse files efficiently")
 
+	preserve := flag.String(
+		"preserve",
+		rsync_wrapper.PreserveDefault,
+		"preservation profile of copy, comma separated attributes: perms,owner,group,times,acls,xattrs,hardlinks,devices,atimes,crtimes, "+
+			"attribute with prefix - is removed, default(perms,owner,group,times,acls,hardlinks) and none are able to be used as base, "+
+			"example: default,xattrs,-owner,-group")
+
+	rsyncOptions := flag.String(
+		"rsync-options",
+		"",
+		"comma separated extra rsync options, allowed: --bwlimit=,--checksum,--inplace,--append-verify,--compress,"+
+			"--whole-file,--max-size=,--link-dest=(absolute path beneath dest mount), example: --bwlimit=10m,--checksum")
+
+	timeout := flag.Int(
+		"timeout",
+		0,
+		"limit of total time for copy each record include retry, time unit is second, default is no limit")
+
+	stallTimeout := flag.Int(
+		"stall-timeout",
+		0,
+		"kill and retry rsync if no progress within it, time unit is second, default is disable")
+
+	isDryRun := flag.Bool(
+		"dry-run",
+		false,
+		"run all checks of each record and print plan of changes to stdout as json, "+
+			"exit with code of the real run, nothing is changed and output record file is not written")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	srcMountSource := flag.String(
+		"src-mount-source",
+		"",
+		"expected source of src mount point, example: 10.0.0.1:/export, empty means not check")
+
+	srcMountOptions := flag.String(
+		"src-mount-options",
+		"",
+		"expected options of src mount point, example: rw,hard, empty means not check")
+
+	destMountSource := flag.String(
+		"dest-mount-source",
+		"",
+		"expected source of dest mount point, example: 10.0.0.1:/export, empty means not check")
+
+	destMountOptions := flag.String(
+		"dest-mount-options",
+		"",
+		"expected options of dest mount point, example: rw,hard, empty means not check")
+
+	isSpaceCheck := flag.Bool(
+		"space-check",
+		false,
+		"check free space and quota of dest is enough for total size of src files at record list that not present "+
+			"at dest before copy, quota is checked only if dest is at local block device, it is skipped for nfs and lustre")
+
+	spaceMargin := flag.Int(
+		"space-margin",
+		0,
+		"safety margin of space check in percent of src size, example: 10 means require 110% of src size")
+
+	nfsWaitInterval := flag.Int(
+		"nfs-wait-interval",
+		-1,
+		"second to wait NFS client cache update between stat of not exist path, negative means default of command")
+
+	nfsWaitAttempts := flag.Int(
+		"nfs-wait-attempts",
+		-1,
+		"max number of stat of not exist path, negative means default of command")
+
+	nfsCacheBust := flag.String(
+		"nfs-cache-bust",
+		"",
+		"bust NFS client cache of parent dir before stat, none, open-parent or list-parent, empty means default of command")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
+	permMode := flag.String(
+		"perm-policy",
+		filesystem.PermPreserve,
+		"permission policy of created or exist dirs and files: preserve, inherit or enforce[:octal mode], example: enforce:0750, "+
+			"preserve never change exist path, inherit apply permission of parent dir to new path, enforce without mode means 0775")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -132,13 +275,40 @@ func main() {
 		"isIgnoreSrcIsDir:", *isIgnoreSrcIsDir,
 		"isIgnoreDestIsExistDir:", *isIgnoreDestIsExistDir,
 		"isOverwriteDestFile:", *isOverwriteDestFile,
+		"conflict:", *conflictMode,
+		"conflictCompare:", *conflictCompare,
 		"isGenerateChecksumFile:", *isGenerateChecksumFile,
 		"trackFileRelativePath:", *trackFileRelativePath,
 		"fileSuffixForChecksum:", *fileSuffixForChecksum,
 		"isRemoveInRecordFile:", *isRemoveInRecordFile,
 		"retryLimit:", *retryLimit,
+		"retryBackoff(second):", *retryBackoff,
+		"retryBackoffMax(second):", *retryBackoffMax,
+		"retryJitter:", *retryJitter,
+		"retryMaxDuration(second):", *retryMaxDuration,
+		"retryVanishedLimit:", *retryVanishedLimit,
+		"retryOverride:", *retryOverride,
+		"classificationFile:", *classificationFile,
+		"isSpaceCheck:", *isSpaceCheck,
+		"spaceMargin:", *spaceMargin,
 		"isHandleSparse:", *isHandleSparse,
+		"timeout(second):", *timeout,
+		"stallTimeout(second):", *stallTimeout,
+		"isDryRun:", *isDryRun,
 		"isDebug:", *isDebug,
+		"srcMountSource:", *srcMountSource,
+		"srcMountOptions:", *srcMountOptions,
+		"destMountSource:", *destMountSource,
+		"destMountOptions:", *destMountOptions,
+		"nfsWaitInterval(second):", *nfsWaitInterval,
+		"nfsWaitAttempts:", *nfsWaitAttempts,
+		"nfsCacheBust:", *nfsCacheBust,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
+		"permPolicy:", *permMode,
+		"preserve:", *preserve,
+		"rsyncOptions:", *rsyncOptions,
 	)
 
 	log.Println("[copylist-Info]Start check")
@@ -150,6 +320,7 @@ func main() {
 		outRecordFilePath      string
 		err                    error
 		exitCode               int
+		permChanges            []filesystem.PermChange
 		isChecksumSuffixEmpty  bool
 		checksumFileSuffixList []string
 		isCreateTrackFile      bool
@@ -178,6 +349,43 @@ func main() {
 		isCreateTrackFile = true
 	}
 
+	if *classificationFile != emptyValue {
+		err = rsync_wrapper.LoadClassificationFile(*classificationFile)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to load exit code classification file:", *classificationFile,
+				"and err:", err.Error())
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+
+	retryPolicy := rsync_wrapper.NewRetryPolicy(*retryLimit)
+	if *retryBackoff >= 0 {
+		retryPolicy.Backoff = time.Duration(*retryBackoff) * time.Second
+	}
+	if *retryBackoffMax >= 0 {
+		retryPolicy.BackoffMax = time.Duration(*retryBackoffMax) * time.Second
+	}
+	if *retryJitter >= 0 {
+		if *retryJitter > 1 {
+			log.Println("[copylist-Error]Unavailable retry jitter:", *retryJitter)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+		retryPolicy.Jitter = *retryJitter
+	}
+	if *retryMaxDuration > 0 {
+		retryPolicy.MaxDuration = time.Duration(*retryMaxDuration) * time.Second
+	}
+	if *retryVanishedLimit >= 0 {
+		retryPolicy.MaxVanished = *retryVanishedLimit
+	}
+	if *retryOverride != emptyValue {
+		retryPolicy.Overrides, err = rsync_wrapper.ParseRetryOverrides(*retryOverride)
+		if err != nil {
+			log.Println("[copylist-Error]Unavailable retry override:", *retryOverride, "and err:", err.Error())
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+
 	// not need check err, because format of mount point has already been checked above
 	inRecordFilePath, _ = filesystem.AbsolutePath(*destMountPath, *inputRecordFile)
 	outRecordFilePath, _ = filesystem.AbsolutePath(*destMountPath, *outputRecordFile)
@@ -207,6 +415,59 @@ func main() {
 	}
 	log.Println("[copylist-Info]Check format...OK")
 
+	waitPolicy, err := filesystem.NewWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	if err != nil {
+		log.Println("[copylist-Error]Unavailable NFS wait policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	log.Println("[copylist-Info]NFS wait policy, interval:", waitPolicy.Interval.String(),
+		"attempts:", waitPolicy.Attempts,
+		"cache bust:", waitPolicy.CacheBust)
+
+	if len(*conflictMode) == 0 {
+		*conflictMode = filesystem.ConflictFail
+		if *isOverwriteDestFile {
+			*conflictMode = filesystem.ConflictOverwrite
+		}
+	}
+	conflictPolicy, err := filesystem.ParseConflictPolicy(*conflictMode, *conflictCompare)
+	if err != nil {
+		log.Println("[copylist-Error]Unavailable conflict policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	preserveProfile, err := rsync_wrapper.ParsePreserveProfile(*preserve)
+	if err != nil {
+		log.Println("[copylist-Error]Unavailable preservation profile:", *preserve, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	log.Println("[copylist-Info]Preservation profile:", preserveProfile.String(),
+		"rsync option:", preserveProfile.RsyncOption())
+
+	extraOptionList, err := rsync_wrapper.ParseExtraOptions(*rsyncOptions)
+	if err != nil {
+		log.Println("[copylist-Error]Unavailable extra rsync options:", *rsyncOptions, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	log.Println("[copylist-Info]Extra rsync options:", extraOptionList)
+
+	permPolicy, err := filesystem.ParsePermPolicy(*permMode)
+	if err != nil {
+		log.Println("[copylist-Error]Unavailable permission policy:", *permMode, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	plan := dryrun.New("copylist", *isDryRun)
+
+	log.Println("[copylist-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[copylist-Error]Failed to load filesystem type policy, err:", err.Error())
+		plan.ExitFail(inRecordFilePath, outRecordFilePath, exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[copylist-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
+
 	if !(*isDebug) {
 		log.Println("[copylist-Info]Start check mount filesystem")
 		err = filesystem.IsMountPath(*srcMountPath)
@@ -215,7 +476,7 @@ func main() {
 				"[copylist-Error]Failed to check src mount filesystem:", *srcMountPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*srcMountPath, "", exitCode)
 		}
 
 		err = filesystem.IsMountPath(*destMountPath)
@@ -224,10 +485,65 @@ func main() {
 				"[copylist-Error]Failed to check dest mount filesystem:", *destMountPath,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*destMountPath, "", exitCode)
 		}
 		log.Println("[copylist-Info]Check mount filesystem...OK")
+
+		log.Println("[copylist-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*srcMountPath, filesystem.ParseMountExpect(*srcMountSource, *srcMountOptions))
+		if err != nil {
+			log.Println("[copylist-Error]Failed to verify src mount point:", *srcMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*srcMountPath, "", exitCode)
+		}
+
+		err = filesystem.VerifyMountPoint(*destMountPath, filesystem.ParseMountExpect(*destMountSource, *destMountOptions))
+		if err != nil {
+			log.Println("[copylist-Error]Failed to verify dest mount point:", *destMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*destMountPath, "", exitCode)
+		}
+		log.Println("[copylist-Info]Verify mount point...OK")
+	}
+
+	log.Println("[copylist-Info]Start check path is beneath mount point")
+	err = filesystem.CheckPathBeneath(*destMountPath, *inputRecordFile)
+	if err != nil {
+		log.Println("[copylist-Error]Failed to check input record file path:", *inputRecordFile,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(*inputRecordFile, "", exitCode)
+	}
+
+	err = filesystem.CheckPathBeneath(*destMountPath, *outputRecordFile)
+	if err != nil {
+		log.Println("[copylist-Error]Failed to check output record file path:", *outputRecordFile,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(*outputRecordFile, "", exitCode)
+	}
+
+	if isCreateTrackFile {
+		err = filesystem.CheckPathBeneath(*destMountPath, *trackFileRelativePath)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to check track file path:", *trackFileRelativePath,
+				"is beneath mount point:", *destMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*trackFileRelativePath, "", exitCode)
+		}
+	}
+	for _, optionPath := range rsync_wrapper.ExtraOptionPathList(extraOptionList) {
+		err = filesystem.CheckAbsPathBeneath(*destMountPath, optionPath)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to check path of extra rsync option:", optionPath,
+				"is beneath mount point:", *destMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(optionPath, "", exitCode)
+		}
 	}
+	log.Println("[copylist-Info]Check path is beneath mount point...OK")
 
 	/*
 		if input file not exist -> ENOENT
@@ -247,8 +563,12 @@ func main() {
 					- if isIgnoreDestIsExistDir is false -> record EISDIR as reason to output file -> next
 					- if isIgnoreDestIsExistDir is true ->  next record
 				- if dest is file
-					- if isOverwriteDestFile is false -> record EEXIST as reason to output file -> next
-					- if isOverwriteDestFile is true -> trancunt dest file
+					- resolve by conflict policy, default is fail if isOverwriteDestFile is false:
+						- fail -> record EEXIST as reason to output file -> next
+						- skip, or not newer/different -> next record
+						- overwrite, or newer/different -> trancunt dest file
+						- rename-with-suffix -> copy to new name like: file (1).txt
+						- backup -> rename dest file to backup
 
 		- start copy file -> get exit code of rsync:
 			- if not succeed -> record to output file -> next
@@ -271,32 +591,23 @@ func main() {
 		inputRecordFileInfo os.FileInfo
 		retryStatNum        int
 	)
-	for {
-		if retryStatNum >= waitNFSCcliLimit {
+	inputRecordFileInfo, retryStatNum, err = waitPolicy.Stat(inRecordFilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println("[copylist-Error]Input record file:", inRecordFilePath,
 				"is not exit, retry num:", retryStatNum)
-			os.Exit(exit_code.ErrNoSuchFileOrDir)
+			plan.ExitFail(inRecordFilePath, "", exit_code.ErrNoSuchFileOrDir)
 		}
 
-		inputRecordFileInfo, err = os.Stat(inRecordFilePath)
-		if err == nil {
-			if inputRecordFileInfo.IsDir() {
-				log.Println("[copylist-Error]Input record file is exist, but is dir:", inRecordFilePath)
-				os.Exit(exit_code.ErrIsDirectory)
-			}
-
-			break
-		}
-
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println("[copylist-Error]Failed to stat input record file:", inRecordFilePath,
-				"and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
-		}
+		log.Println("[copylist-Error]Failed to stat input record file:", inRecordFilePath,
+			"and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(inRecordFilePath, "", exitCode)
+	}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		retryStatNum += 1
+	if inputRecordFileInfo.IsDir() {
+		log.Println("[copylist-Error]Input record file is exist, but is dir:", inRecordFilePath)
+		plan.ExitFail(inRecordFilePath, "", exit_code.ErrIsDirectory)
 	}
 	log.Println("[copylist-Info]Check input record file is exist...Exist")
 
@@ -306,14 +617,15 @@ func main() {
 		log.Println("[copylist-Error]Failed to open(1) input record file:", inRecordFilePath,
 			"and err:", err.Error())
 		exitCode = exit_code.ExitCodeConvertWithErr(err)
-		os.Exit(exitCode)
+		plan.ExitFail(inRecordFilePath, "", exitCode)
 	}
 
-	// check record format of input file
+	// check record format of input file, and sum size of src files if need check space
 	var (
 		line               string
 		isRecordAvailable  bool
 		availableRecordNum int
+		srcTotalSize       uint64
 	)
 	inputReader := bufio.NewReader(inputF)
 	for {
@@ -325,13 +637,13 @@ func main() {
 
 				_ = inputF.Close()
 				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				plan.ExitFail(inRecordFilePath, "", exitCode)
 			}
 
 			if len(line) > 0 {
 				_ = inputF.Close()
 				log.Println("[copylist-Error]Last line is not end with LF")
-				os.Exit(exit_code.ErrInvalidListFile)
+				plan.ExitFail(inRecordFilePath, "", exit_code.ErrInvalidListFile)
 			}
 
 			log.Println("[copylist-Info]Read EOF of input record file:", inRecordFilePath)
@@ -343,18 +655,53 @@ func main() {
 		if !isRecordAvailable {
 			_ = inputF.Close()
 			log.Println("[copylist-Error]Unavailable record: >>", line, "<<")
-			os.Exit(exit_code.ErrInvalidListFile)
+			plan.ExitFail(inRecordFilePath, "", exit_code.ErrInvalidListFile)
+		}
+
+		if *isSpaceCheck {
+			srcTotalSize += recordSrcSize(*srcMountPath, *destMountPath, line)
 		}
 	}
 	_ = inputF.Close()
 
 	if availableRecordNum == 0 {
 		log.Println("[copylist-Error]Empty input record file")
-		os.Exit(exit_code.ErrInvalidListFile)
+		plan.ExitFail(inRecordFilePath, "", exit_code.ErrInvalidListFile)
 	}
 
 	log.Println("[copylist-Info]Check record format of input file...OK")
 
+	if *isSpaceCheck {
+		log.Println("[copylist-Info]Start check space of dest:", *destMountPath)
+		var spaceInfo filesystem.SpaceInfo
+		spaceInfo, err = filesystem.AvailableSpace(*destMountPath)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to get available space of dest:", *destMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*destMountPath, "", exitCode)
+		}
+
+		if spaceInfo.IsQuotaSkipped {
+			log.Println("[copylist-Warning]Quota of dest is not checked, it is not at local block device, fs type:",
+				spaceInfo.FSType)
+		}
+
+		spaceRequired := filesystem.SpaceRequired(srcTotalSize, *spaceMargin)
+		log.Println("[copylist-Info]Total size of src to copy:", srcTotalSize,
+			"required with margin:", spaceRequired,
+			"free of filesystem:", spaceInfo.Free,
+			"is quota:", spaceInfo.IsQuota,
+			"free of quota:", spaceInfo.QuotaFree,
+			"quota type:", spaceInfo.QuotaType)
+		err = spaceInfo.Check(spaceRequired)
+		if err != nil {
+			log.Println("[copylist-Error]Space of dest is not enough, err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*destMountPath, "", exitCode)
+		}
+		log.Println("[copylist-Info]Check space of dest...OK")
+	}
+
 	log.Println("[copylist-Info]Start parse input record file, reopen input file")
 	// reopen input file to parse record
 	inputF, err = os.Open(inRecordFilePath)
@@ -362,28 +709,38 @@ func main() {
 		log.Println("[copylist-Error]Failed to open(2) input record file:", inRecordFilePath,
 			"and err:", err.Error())
 		exitCode = exit_code.ExitCodeConvertWithErr(err)
-		os.Exit(exitCode)
+		plan.ExitFail(inRecordFilePath, "", exitCode)
 	}
 	inputReader.Reset(inputF)
 
-	// check or create output record file, if parent dir is not exist, create it
-	err = filesystem.CheckOrCreateFile(outRecordFilePath, true)
-	if err != nil {
-		log.Println("[copylist-Error]Failed to check or create output record file:", outRecordFilePath,
-			"and err:", err.Error())
-		_ = inputF.Close()
-		exitCode = exit_code.ExitCodeConvertWithErr(err)
-		os.Exit(exitCode)
-	}
+	// output record of dry run is written to buffer, and added to plan at last
+	var (
+		outputF          *os.File
+		dryRunRecordBuf  bytes.Buffer
+		dryRunCreatedDir = make(map[string]bool)
+	)
+	if plan.IsEnable() {
+		plan.Add(dryrun.OpCreateFile, outRecordFilePath, "", "output record file")
+	} else {
+		// check or create output record file, if parent dir is not exist, create it
+		permChanges, err = filesystem.CheckOrCreateFile(outRecordFilePath, true, permPolicy)
+		logPermChanges(permChanges)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to check or create output record file:", outRecordFilePath,
+				"and err:", err.Error())
+			_ = inputF.Close()
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
 
-	var outputF *os.File
-	outputF, err = os.OpenFile(outRecordFilePath, unix.O_RDWR|unix.O_CREAT|unix.O_TRUNC|unix.O_APPEND, permFileDefault)
-	if err != nil {
-		log.Println("[copylist-Error]Failed to open output record file:", outRecordFilePath,
-			"and err:", err.Error())
-		_ = inputF.Close()
-		exitCode = exit_code.ExitCodeConvertWithErr(err)
-		os.Exit(exitCode)
+		outputF, err = os.OpenFile(outRecordFilePath, unix.O_RDWR|unix.O_CREAT|unix.O_TRUNC|unix.O_APPEND, permFileDefault)
+		if err != nil {
+			log.Println("[copylist-Error]Failed to open output record file:", outRecordFilePath,
+				"and err:", err.Error())
+			_ = inputF.Close()
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
 	}
 
 	var (
@@ -401,16 +758,24 @@ func main() {
 		recordErrStr   string
 		recordContent  recordInfo
 		// firstExitCode  int = exit_code.Empty
-		numRecord     int
-		numErrRecord  int
-		numIgSrcDir   int
-		numIgSrcNOENT int
-		numIgDestDir  int
-		numOverWrite  int
-		reqCopyFile   file.ReqContent
+		numRecord         int
+		numErrRecord      int
+		numIgSrcDir       int
+		numIgSrcNOENT     int
+		numIgDestDir      int
+		numOverWrite      int
+		numConflictSkip   int
+		numConflictRename int
+		numConflictBackup int
+		conflictResult    filesystem.ConflictResult
+		reqCopyFile       file.ReqContent
 	)
 
-	outputWriter = bufio.NewWriter(outputF)
+	if plan.IsEnable() {
+		outputWriter = bufio.NewWriter(&dryRunRecordBuf)
+	} else {
+		outputWriter = bufio.NewWriter(outputF)
+	}
 	for {
 		line, err = inputReader.ReadString(delimLF)
 		if err != nil {
@@ -422,7 +787,7 @@ func main() {
 				_ = outputF.Close()
 
 				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				plan.ExitFail(inRecordFilePath, "", exitCode)
 			}
 
 			log.Println("[copylist-Info]Read end of input record file:", inRecordFilePath,
@@ -453,6 +818,29 @@ func main() {
 		srcPath, _ = filesystem.AbsolutePath(*srcMountPath, recordContent.srcRelativeCleanPath)
 		destPath, _ = filesystem.AbsolutePath(*destMountPath, recordContent.destRelativeCleanPath)
 
+		err = filesystem.CheckPathBeneath(*srcMountPath, recordContent.srcRelativeCleanPath)
+		if err == nil {
+			err = filesystem.CheckPathBeneath(*destMountPath, recordContent.destRelativeCleanPath)
+		}
+		if err != nil {
+			log.Println("[copylist-Error]Failed to check path of record is beneath mount point, src:", srcPath,
+				"dest:", destPath,
+				"and err:", err.Error())
+			numErrRecord += 1
+			isRecordErr = true
+			recordBuilder.Reset()
+			recordBuilder.WriteString(recordContent.srcRelativeDirtyPath)
+			recordBuilder.WriteString(seq)
+			recordBuilder.WriteString(recordContent.destRelativeDirtyPath)
+			recordBuilder.WriteString(seq)
+			exitCodeStr = strconv.Itoa(exit_code.ExitCodeConvertWithErr(err) + errCodeAdditional)
+			recordBuilder.WriteString(exitCodeStr)
+			recordBuilder.WriteString("\n")
+			recordErrStr = recordBuilder.String()
+			_, _ = outputWriter.WriteString(recordErrStr)
+			continue
+		}
+
 		if *isDebug {
 			log.Println("[copylist-debug]srcRelativePath:", recordContent.srcRelativeCleanPath,
 				"destRelativePath:", recordContent.destRelativeCleanPath,
@@ -617,30 +1005,11 @@ func main() {
 				continue
 			}
 
-			// dest is exist file
-			if !(*isOverwriteDestFile) {
-				numErrRecord += 1
-				isRecordErr = true
-				recordBuilder.Reset()
-				recordBuilder.WriteString(recordContent.srcRelativeDirtyPath)
-				recordBuilder.WriteString(seq)
-				recordBuilder.WriteString(recordContent.destRelativeDirtyPath)
-				recordBuilder.WriteString(seq)
-				exitCodeStr = strconv.Itoa(exit_code.ErrFileIsExists + errCodeAdditional)
-				recordBuilder.WriteString(exitCodeStr)
-				recordBuilder.WriteString("\n")
-				recordErrStr = recordBuilder.String()
-				_, _ = outputWriter.WriteString(recordErrStr)
-				// if firstExitCode == exit_code.Empty {
-				// 	firstExitCode = exit_code.ErrFileIsExists
-				// }
-				continue
-			} else {
-				numOverWrite += 1
+			// dest is exist file, resolve by conflict policy
+			conflictResult, err = conflictPolicy.Resolve(srcPath, destPath)
+			if err == nil && !plan.IsEnable() {
+				err = conflictResult.Backup()
 			}
-
-			// trunc dest file
-			_, err = os.OpenFile(destPath, unix.O_RDWR|unix.O_TRUNC, permFileDefault)
 			if err != nil {
 				numErrRecord += 1
 				isRecordErr = true
@@ -659,13 +1028,61 @@ func main() {
 				recordBuilder.WriteString("\n")
 				recordErrStr = recordBuilder.String()
 				_, _ = outputWriter.WriteString(recordErrStr)
-				// if firstExitCode == exit_code.Empty {
-				// 	firstExitCode = exitCode
-				// }
 				continue
 			}
 
-			// trunc dest file succeed
+			if conflictResult.Skip {
+				numConflictSkip += 1
+				log.Println("[copylist-Info]Dest is exist, skip by conflict policy:", destPath)
+				plan.Add(dryrun.OpSkip, srcPath, destPath, "dest is exist, conflict policy: "+conflictPolicy.Mode)
+				continue
+			}
+
+			if conflictResult.Path != destPath {
+				numConflictRename += 1
+				log.Println("[copylist-Info]Dest is exist:", destPath, "rename to:", conflictResult.Path)
+				destPath = conflictResult.Path
+			}
+
+			if len(conflictResult.BackupPath) != 0 {
+				numConflictBackup += 1
+				log.Println("[copylist-Info]Dest is exist:", destPath, "backup to:", conflictResult.BackupPath)
+				plan.Add(dryrun.OpBackup, destPath, conflictResult.BackupPath, "dest is exist")
+			}
+
+			if conflictResult.IsExist && len(conflictResult.BackupPath) == 0 && plan.IsEnable() {
+				numOverWrite += 1
+				plan.Add(dryrun.OpTruncate, destPath, "", "dest is exist, conflict policy: "+conflictPolicy.Mode)
+			} else if conflictResult.IsExist && len(conflictResult.BackupPath) == 0 {
+				numOverWrite += 1
+				// trunc dest file
+				_, err = os.OpenFile(destPath, unix.O_RDWR|unix.O_TRUNC, permFileDefault)
+				if err != nil {
+					numErrRecord += 1
+					isRecordErr = true
+					recordBuilder.Reset()
+					recordBuilder.WriteString(recordContent.srcRelativeDirtyPath)
+					recordBuilder.WriteString(seq)
+					recordBuilder.WriteString(recordContent.destRelativeDirtyPath)
+					recordBuilder.WriteString(seq)
+					exitCode = exit_code.ExitCodeConvertWithErr(err)
+					if exitCode == exit_code.ErrSystem {
+						exitCodeStr = strconv.Itoa(exit_code.SystemError)
+					} else {
+						exitCodeStr = strconv.Itoa(exitCode + errCodeAdditional)
+					}
+					recordBuilder.WriteString(exitCodeStr)
+					recordBuilder.WriteString("\n")
+					recordErrStr = recordBuilder.String()
+					_, _ = outputWriter.WriteString(recordErrStr)
+					// if firstExitCode == exit_code.Empty {
+					// 	firstExitCode = exitCode
+					// }
+					continue
+				}
+
+				// trunc dest file succeed
+			}
 		} else {
 			if !errors.Is(err, fs.ErrNotExist) {
 				numErrRecord += 1
@@ -705,7 +1122,12 @@ func main() {
 			log.Println("[copylist-debug]Dest parent dir:", destParentDir)
 		}
 
-		err = filesystem.CheckOrCreateDir(destParentDir)
+		if plan.IsEnable() {
+			err = planDestParentDir(plan, destParentDir, dryRunCreatedDir)
+		} else {
+			permChanges, err = filesystem.CheckOrCreateDir(destParentDir, permPolicy)
+			logPermChanges(permChanges)
+		}
 		if err != nil {
 			numErrRecord += 1
 			isRecordErr = true
@@ -730,10 +1152,22 @@ func main() {
 			continue
 		}
 
+		if plan.IsEnable() {
+			plan.Add(dryrun.OpCopy, srcPath, destPath, "")
+			if !isChecksumSuffixEmpty && isNeedChecksum(srcPathInfo.Name(), checksumFileSuffixList) {
+				plan.Add(dryrun.OpChecksum, srcPath, destPath, "")
+			}
+			continue
+		}
+
 		reqCopyFile.SrcPath = srcPath
 		reqCopyFile.DestPath = destPath
 		reqCopyFile.IsHandleSparse = *isHandleSparse
-		reqCopyFile.RetryLimit = *retryLimit
+		reqCopyFile.RetryPolicy = retryPolicy
+		reqCopyFile.Preserve = preserveProfile
+		reqCopyFile.ExtraOptions = extraOptionList
+		reqCopyFile.Timeout = *timeout
+		reqCopyFile.StallTimeout = *stallTimeout
 		exitCode = file.CopyFile(reqCopyFile)
 		if exitCode != exit_code.Succeed {
 			// try remove dest file to clean dest to clean dest
@@ -844,6 +1278,23 @@ func main() {
 		}
 	}
 
+	if plan.IsEnable() {
+		_ = outputWriter.Flush()
+		_ = inputF.Close()
+		planRecordFailure(plan, dryRunRecordBuf.String())
+		if *isRemoveInRecordFile {
+			plan.Add(dryrun.OpRemove, inRecordFilePath, "", "input record file")
+		}
+		if isCreateTrackFile {
+			plan.Add(dryrun.OpCreateFile, trackFilePath, "", "track file")
+		}
+
+		if isRecordErr {
+			plan.Exit(exit_code.ErrCopylistPartial)
+		}
+		plan.Exit(exit_code.Succeed)
+	}
+
 	err = outputWriter.Flush()
 	if err != nil {
 		log.Println("[copylist-Warning]Failed to flush any buffered data to the underlying io.Writer, and err:", err.Error())
@@ -883,7 +1334,8 @@ func main() {
 	}
 
 	if isCreateTrackFile {
-		err = filesystem.CheckOrCreateFile(trackFilePath, false)
+		permChanges, err = filesystem.CheckOrCreateFile(trackFilePath, false, permPolicy)
+		logPermChanges(permChanges)
 		if err != nil {
 			log.Println("[copylist-Error]Failed to check or create track file:", trackFilePath,
 				"and err:", err.Error())
@@ -903,7 +1355,10 @@ func main() {
 		"ignore src is dir:", numIgSrcDir,
 		"ignore src not exist:", numIgSrcNOENT,
 		"ignore dest is dir:", numIgDestDir,
-		"overWrite:", numOverWrite)
+		"overWrite:", numOverWrite,
+		"conflict skip:", numConflictSkip,
+		"conflict rename:", numConflictRename,
+		"conflict backup:", numConflictBackup)
 	// if numRecord == numErrRecord {
 	// 	if firstExitCode != exit_code.Empty {
 	// 		log.Println("[copylist-Error]All records get err, exit with first err:", firstExitCode)
@@ -1043,3 +1498,92 @@ func isNeedChecksum(fileName string, fileSuffixList []string) bool {
 	}
 	return false
 }
+
+// recordSrcSize return size of src file of record, unavailable record or not exist src is zero,
+// because them will be reported when copy, dest file with same size is zero.
+func recordSrcSize(srcMountPath, destMountPath, record string) uint64 {
+	recordContent, isRecordAvailable := cleanRecord(record)
+	if !isRecordAvailable {
+		return 0
+	}
+
+	srcPath, err := filesystem.AbsolutePath(srcMountPath, recordContent.srcRelativeCleanPath)
+	if err != nil {
+		return 0
+	}
+
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil || !srcInfo.Mode().IsRegular() {
+		return 0
+	}
+
+	destPath, err := filesystem.AbsolutePath(destMountPath, recordContent.destRelativeCleanPath)
+	if err != nil {
+		return uint64(srcInfo.Size())
+	}
+
+	// dest file with same size is copied by a previous run
+	destInfo, err := os.Lstat(destPath)
+	if err == nil && destInfo.Mode().IsRegular() && destInfo.Size() == srcInfo.Size() {
+		return 0
+	}
+
+	return uint64(srcInfo.Size())
+}
+
+// planDestParentDir add action to create dest parent dir if it is not exist,
+// createdDir avoid add same dir again.
+func planDestParentDir(plan *dryrun.Plan, destParentDir string, createdDir map[string]bool) error {
+	if createdDir[destParentDir] {
+		return nil
+	}
+
+	info, err := os.Stat(destParentDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		createdDir[destParentDir] = true
+		plan.Add(dryrun.OpCreateDir, destParentDir, "", "dest parent dir is not exist")
+		return nil
+	}
+
+	if !info.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: destParentDir, Err: unix.ENOTDIR}
+	}
+	return nil
+}
+
+// planRecordFailure add failed records of output record content to plan.
+func planRecordFailure(plan *dryrun.Plan, content string) {
+	var (
+		record   recordInfo
+		ok       bool
+		exitCode int
+		err      error
+	)
+	for _, line := range strings.Split(content, delimLFStr) {
+		if len(line) == 0 {
+			continue
+		}
+
+		record, ok = cleanRecord(line)
+		if !ok {
+			continue
+		}
+
+		exitCode, err = strconv.Atoi(line[strings.LastIndex(line, seq)+1:])
+		if err != nil {
+			continue
+		}
+		plan.AddFail(record.srcRelativeCleanPath, record.destRelativeCleanPath, exitCode)
+	}
+}
+
+// logPermChanges log permission changes that made by policy.
+func logPermChanges(changes []filesystem.PermChange) {
+	for _, change := range changes {
+		log.Println("[copylist-Info]Permission change:", change.String())
+	}
+}
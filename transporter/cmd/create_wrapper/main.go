@@ -1,10 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
 
+	"golang.org/x/sys/unix"
+	"transporter/pkg/dryrun"
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
 )
@@ -12,7 +18,11 @@ import (
 const (
 	typeFile      = "file"
 	typeDir       = "dir"
+	typeSymlink   = "symlink"
+	typeHardlink  = "hardlink"
 	emptyValue    = "empty"
+	modeMax       = 07777
+	umaskMax      = 0777
 )
 
 func main() {
@@ -30,18 +40,95 @@ func main() {
 	typeCreate := flag.String(
 		"type",
 		emptyValue,
-		"available create types: file,dir")
+		"available create types: file,dir,symlink,hardlink")
+
+	target := flag.String(
+		"target",
+		"",
+		"target of symlink or hardlink, symlink target is kept as it is and must be beneath mount point after resolve "+
+			"against parent dir of link, hardlink target is path relative mount point")
+
+	isAllowTargetEscape := flag.Bool(
+		"allow-target-escape",
+		false,
+		"allow symlink target that is not beneath mount point")
+
+	mode := flag.String(
+		"mode",
+		"",
+		"octal permission of file or dir with special bits, example: 0750, it override perm-policy, empty means not set")
+
+	uid := flag.Int(
+		"uid",
+		filesystem.NoChange,
+		"owner of path, -1 means not change")
+
+	gid := flag.Int(
+		"gid",
+		filesystem.NoChange,
+		"group of path, -1 means not change")
+
+	umask := flag.String(
+		"umask",
+		"",
+		"octal umask during create, it also applies to default permission and parent dirs, example: 0027, empty means not change")
+
+	size := flag.Int64(
+		"size",
+		0,
+		"preallocate size(bytes) of file by fallocate, 0 means no preallocate")
+
+	isNoTouchExisting := flag.Bool(
+		"no-touch-existing",
+		false,
+		"not change permission, owner and size of exist path")
 
 	isOverWrite := flag.Bool(
 		"overwrite",
 		false,
 		"if create type is file, truncat exist file")
 
+	isDryRun := flag.Bool(
+		"dry-run",
+		false,
+		"run all checks and print plan of changes to stdout as json, exit with code of the real run, nothing is changed")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	mountSource := flag.String(
+		"mount-source",
+		"",
+		"expected source of mount point, example: 10.0.0.1:/export, empty means not check")
+
+	mountOptions := flag.String(
+		"mount-options",
+		"",
+		"expected options of mount point, example: rw,hard, empty means not check")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
+	permMode := flag.String(
+		"perm-policy",
+		filesystem.PermPreserve,
+		"permission policy of created or exist dirs and files: preserve, inherit or enforce[:octal mode], example: enforce:0750, "+
+			"preserve never change exist path, inherit apply permission of parent dir to new path, enforce without mode means 0775")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -49,8 +136,23 @@ func main() {
 	log.Println("[createWrapper-Info]New create request, relative path:", *relativePath,
 		"mount point:", *mountPath,
 		"type:", *typeCreate,
+		"target:", *target,
+		"isAllowTargetEscape:", *isAllowTargetEscape,
+		"mode:", *mode,
+		"uid:", *uid,
+		"gid:", *gid,
+		"umask:", *umask,
+		"size:", *size,
 		"isOverWrite:", *isOverWrite,
+		"isNoTouchExisting:", *isNoTouchExisting,
+		"isDryRun:", *isDryRun,
 		"isDebug:", *isDebug,
+		"mountSource:", *mountSource,
+		"mountOptions:", *mountOptions,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
+		"permPolicy:", *permMode,
 	)
 	log.Println("[createWrapper-Info]Start check")
 
@@ -81,7 +183,7 @@ func main() {
 	}
 
 	switch *typeCreate {
-	case typeFile:
+	case typeFile, typeSymlink, typeHardlink:
 		isPathAvailable = filesystem.CheckFilePathFormat(path)
 	case typeDir:
 		isPathAvailable = filesystem.CheckDirPathFormat(path)
@@ -94,34 +196,148 @@ func main() {
 		log.Println("[createWrapper-Error]Unavailable format of create path:", path)
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
+
+	createReq := filesystem.NewCreateReq(*typeCreate)
+	createReq.UID = *uid
+	createReq.GID = *gid
+	createReq.Size = *size
+	createReq.IsOverWrite = *isOverWrite
+	createReq.IsKeepExisting = *isNoTouchExisting
+
+	createReq.Mode, err = parseOctal(*mode, modeMax)
+	if err != nil {
+		log.Println("[createWrapper-Error]Unavailable format of mode:", *mode)
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	createReq.Umask, err = parseOctal(*umask, umaskMax)
+	if err != nil {
+		log.Println("[createWrapper-Error]Unavailable format of umask:", *umask)
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	if *uid < filesystem.NoChange || *gid < filesystem.NoChange || *size < 0 {
+		log.Println("[createWrapper-Error]Unavailable uid:", *uid, "gid:", *gid, "or size:", *size)
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	if *size != 0 && *typeCreate != typeFile {
+		log.Println("[createWrapper-Error]Preallocate size is only available for create type:", typeFile)
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	switch *typeCreate {
+	case typeSymlink, typeHardlink:
+		if len(*target) == 0 {
+			log.Println("[createWrapper-Error]Target is required for create type:", *typeCreate)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		if createReq.Mode != filesystem.NoChange {
+			log.Println("[createWrapper-Error]Mode is unavailable for create type:", *typeCreate)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	default:
+		if len(*target) != 0 {
+			log.Println("[createWrapper-Error]Target is unavailable for create type:", *typeCreate)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+
+	createReq.Target = *target
+	if *typeCreate == typeHardlink {
+		// owner of hardlink is owner of target, it is not changed by create
+		if *uid != filesystem.NoChange || *gid != filesystem.NoChange {
+			log.Println("[createWrapper-Error]Uid and gid are unavailable for create type:", *typeCreate)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		createReq.Target, err = filesystem.AbsolutePath(*mountPath, *target)
+		if err != nil || !filesystem.CheckFilePathFormat(createReq.Target) {
+			log.Println("[createWrapper-Error]Unavailable format of target:", *target)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
 	log.Println("[createWrapper-Info]Check path format...OK")
 
+	permPolicy, err := filesystem.ParsePermPolicy(*permMode)
+	if err != nil {
+		log.Println("[createWrapper-Error]Unavailable permission policy:", *permMode, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+	createReq.Policy = permPolicy
+
+	plan := dryrun.New("create", *isDryRun)
+
+	log.Println("[createWrapper-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[createWrapper-Error]Failed to load filesystem type policy, err:", err.Error())
+		plan.ExitFail(path, "", exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[createWrapper-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
+
 	if !(*isDebug) {
 		log.Println("[createWrapper-Info]Start check mount filesystem")
 		err = filesystem.IsMountPath(*mountPath)
 		if err != nil {
 			log.Println("[createWrapper-Error]Failed to check mount filesystem, err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*mountPath, "", exitCode)
 		}
 		log.Println("[createWrapper-Info]Check mount filesystem...OK")
+
+		log.Println("[createWrapper-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*mountPath, filesystem.ParseMountExpect(*mountSource, *mountOptions))
+		if err != nil {
+			log.Println("[createWrapper-Error]Failed to verify mount point:", *mountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*mountPath, "", exitCode)
+		}
+		log.Println("[createWrapper-Info]Verify mount point...OK")
 	}
 
-	log.Println("[createWrapper-Info]End check")
+	log.Println("[createWrapper-Info]Start check path is beneath mount point")
+	checkList := []string{*relativePath}
+	if *typeCreate == typeHardlink {
+		checkList = append(checkList, *target)
+	}
+	for _, checkPath := range checkList {
+		err = filesystem.CheckPathBeneath(*mountPath, checkPath)
+		if err != nil {
+			log.Println("[createWrapper-Error]Failed to check path:", checkPath,
+				"is beneath mount point:", *mountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(checkPath, "", exitCode)
+		}
+	}
 
-	log.Println("[createWrapper-Info]Start create")
-	switch *typeCreate {
-	case typeDir:
-		err = filesystem.CheckOrCreateDir(path)
+	if *typeCreate == typeSymlink && !(*isAllowTargetEscape) {
+		err = filesystem.CheckLinkTargetBeneath(*mountPath, path, *target)
+		if err != nil {
+			log.Println("[createWrapper-Error]Failed to check symlink target:", *target,
+				"is beneath mount point:", *mountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(path, *target, exitCode)
+		}
+	}
+	log.Println("[createWrapper-Info]Check path is beneath mount point...OK")
 
-	case typeFile:
-		err = filesystem.CheckOrCreateFile(path, *isOverWrite)
+	log.Println("[createWrapper-Info]End check")
 
-	default:
-		log.Println("[createWrapper-Error]Unsupport create type:", *typeCreate)
-		os.Exit(exit_code.ErrInvalidArgument)
+	if plan.IsEnable() {
+		exitCode = planCreate(plan, path, createReq)
+		if exitCode != exit_code.Succeed {
+			plan.ExitFail(path, createReq.Target, exitCode)
+		}
+		plan.Exit(exitCode)
 	}
 
+	log.Println("[createWrapper-Info]Start create")
+	changes, err := filesystem.Create(path, createReq)
+	logPermChanges(changes)
 	if err != nil {
 		log.Println("[createWrapper-Error]Failed to create path:", path, "and err:", err.Error())
 		exitCode = exit_code.ExitCodeConvertWithErr(err)
@@ -131,4 +347,136 @@ func main() {
 	log.Println("[createWrapper-Info]End create")
 	log.Println("[createWrapper-Info]Succeed to create path:", path, "type:", *typeCreate)
 	os.Exit(exit_code.Succeed)
-}
\ No newline at end of file
+}
+
+// parseOctal return octal value of s, filesystem.NoChange if s is empty.
+func parseOctal(s string, max uint64) (int, error) {
+	if len(s) == 0 {
+		return filesystem.NoChange, nil
+	}
+
+	value, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return filesystem.NoChange, err
+	}
+	if value > max {
+		return filesystem.NoChange, strconv.ErrRange
+	}
+	return int(value), nil
+}
+
+// planCreate add create action to plan, return exit code of the real run.
+// Exist path is kept as filesystem.Create does, only its owner and size may be reset, and its permission by policy.
+func planCreate(plan *dryrun.Plan, path string, req filesystem.CreateReq) int {
+	var (
+		pInfo os.FileInfo
+		err   error
+	)
+	switch req.Type {
+	case typeSymlink, typeHardlink:
+		pInfo, err = os.Lstat(path)
+	default:
+		pInfo, err = os.Stat(path)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("[createWrapper-Error]Failed to stat path:", path, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+	isExist := err == nil
+
+	switch req.Type {
+	case typeDir:
+		if !isExist {
+			plan.Add(dryrun.OpCreateDir, path, "", "")
+		} else if !pInfo.IsDir() {
+			return planFail(path, unix.ENOTDIR)
+		}
+
+	case typeFile:
+		if !isExist {
+			plan.Add(dryrun.OpCreateFile, path, "", "")
+		} else if pInfo.IsDir() {
+			return planFail(path, unix.EISDIR)
+		} else if req.IsOverWrite && !req.IsKeepExisting {
+			plan.Add(dryrun.OpTruncate, path, "", "overwrite exist file")
+		}
+
+		if req.Size > 0 && (!isExist || !req.IsKeepExisting) {
+			plan.Add(dryrun.OpAllocate, path, "", fmt.Sprint("size: ", req.Size))
+		}
+
+	case typeSymlink, typeHardlink:
+		isSame, code := isSameLink(path, pInfo, req)
+		if code != exit_code.Succeed {
+			return code
+		}
+
+		if isExist && !isSame {
+			if !req.IsOverWrite {
+				return planFail(path, unix.EEXIST)
+			}
+			if pInfo.IsDir() {
+				return planFail(path, unix.EISDIR)
+			}
+		}
+
+		if !isSame {
+			op := dryrun.OpSymlink
+			if req.Type == typeHardlink {
+				op = dryrun.OpHardlink
+			}
+			plan.Add(op, path, req.Target, "")
+		}
+		isExist = isSame
+	}
+
+	if isExist {
+		plan.Add(dryrun.OpSkip, path, "", "path is exist")
+		if req.IsKeepExisting {
+			return exit_code.Succeed
+		}
+	}
+
+	if req.UID != filesystem.NoChange || req.GID != filesystem.NoChange {
+		plan.Add(dryrun.OpChown, path, "", fmt.Sprint("uid: ", req.UID, " gid: ", req.GID))
+	}
+
+	// parent of new path may be not exist at dry run, then inherit is not planned
+	perm, ok, _ := req.PermPolicy().PermOf(path, req.Type == typeDir, !isExist)
+	if ok && (!isExist || pInfo.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != perm) {
+		plan.Add(dryrun.OpChmod, path, "", "mode: "+perm.String())
+	}
+	return exit_code.Succeed
+}
+
+// isSameLink return true if exist path is symlink or hardlink of target already.
+func isSameLink(path string, pInfo os.FileInfo, req filesystem.CreateReq) (bool, int) {
+	if req.Type == typeSymlink {
+		if pInfo == nil || pInfo.Mode()&os.ModeSymlink == 0 {
+			return false, exit_code.Succeed
+		}
+
+		target, err := os.Readlink(path)
+		return err == nil && target == req.Target, exit_code.Succeed
+	}
+
+	targetInfo, err := os.Lstat(req.Target)
+	if err != nil {
+		log.Println("[createWrapper-Error]Failed to stat target:", req.Target, "and err:", err.Error())
+		return false, exit_code.ExitCodeConvertWithErr(err)
+	}
+	return pInfo != nil && os.SameFile(pInfo, targetInfo), exit_code.Succeed
+}
+
+// planFail log err of create and return its exit code.
+func planFail(path string, err error) int {
+	log.Println("[createWrapper-Error]Failed to create path:", path, "and err:", err.Error())
+	return exit_code.ExitCodeConvertWithErr(err)
+}
+
+// logPermChanges log permission changes that made by policy.
+func logPermChanges(changes []filesystem.PermChange) {
+	for _, change := range changes {
+		log.Println("[createWrapper-Info]Permission change:", change.String())
+	}
+}
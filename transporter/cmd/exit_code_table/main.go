@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"transporter/pkg/exit_code"
+	"transporter/pkg/rsync_wrapper"
+)
+
+const (
+	emptyValue = "empty"
+)
+
+func main() {
+
+	classificationFile := flag.String(
+		"exit-code-config",
+		emptyValue,
+		"absolute path of exit code classification file(json), if not specify, print built-in table")
+
+	flag.Parse()
+
+	// set output of standard logger to stderr
+	log.SetOutput(os.Stderr)
+	log.Println("[exitCodeTable-Info]New exit code table request, classificationFile:", *classificationFile)
+
+	var (
+		err      error
+		exitCode int
+	)
+
+	if *classificationFile != emptyValue {
+		log.Println("[exitCodeTable-Info]Start load classification file:", *classificationFile)
+		err = rsync_wrapper.LoadClassificationFile(*classificationFile)
+		if err != nil {
+			log.Println("[exitCodeTable-Error]Failed to load classification file:", *classificationFile,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			if exitCode == exit_code.ErrSystem {
+				exitCode = exit_code.ErrInvalidArgument
+			}
+			os.Exit(exitCode)
+		}
+		log.Println("[exitCodeTable-Info]Load classification file...OK")
+	}
+
+	table, err := json.MarshalIndent(rsync_wrapper.EffectiveClassification(), "", "    ")
+	if err != nil {
+		log.Println("[exitCodeTable-Error]Failed to marshal effective classification, err:", err.Error())
+		os.Exit(exit_code.ErrSystem)
+	}
+
+	fmt.Println(string(table))
+	os.Exit(exit_code.Succeed)
+}
@@ -3,15 +3,19 @@ package main
 import (
 	"errors"
 	"flag"
-	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
+	"golang.org/x/sys/unix"
+	"transporter/pkg/client"
+	"transporter/pkg/dryrun"
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
+	"transporter/pkg/rsync_wrapper"
+	"transporter/pkg/rsync_wrapper/dir"
+	"transporter/pkg/rsync_wrapper/move"
 )
 
 const (
@@ -19,10 +23,12 @@ const (
 	slash              = '/'
 	slashStr           = "/"
 	defaultLimtReadDir = 1024
-	waitNFSCliUpdate   = 5
-	waitNFSCcliLimit   = 5
 )
 
+// mountPointList is mount points of src and dest, paths of rename are checked beneath one of them again
+// right before rename, because symlink may be swapped in after the check at start.
+var mountPointList []string
+
 func main() {
 
 	srcMountPath := flag.String(
@@ -50,11 +56,118 @@ func main() {
 		false,
 		"exclude src dir(src must is dir)")
 
+	journalRelativePath := flag.String(
+		"journal",
+		"",
+		"undo journal path relative to the src mount point, used with exclude-src, default is next to src dir")
+
+	conflictMode := flag.String(
+		"conflict",
+		filesystem.ConflictFail,
+		"policy if dest name is exist: fail, skip, overwrite, overwrite-if-newer, overwrite-if-different, rename-with-suffix, backup")
+
+	conflictCompare := flag.String(
+		"conflict-compare",
+		filesystem.CompareSizeMtime,
+		"compare method of overwrite-if-different: size-mtime, checksum")
+
+	isCrossFS := flag.Bool(
+		"cross-fs",
+		false,
+		"if src and dest are at different filesystem, copy src to dest, verify with checksum, then remove src")
+
+	isReportProgress := flag.Bool(
+		"progress",
+		false,
+		"report progress of cross filesystem move, must used with 'report-addr' flag")
+
+	isReportStderr := flag.Bool(
+		"stderr",
+		false,
+		"report std error content of cross filesystem move, must used with 'report-addr' flag")
+
+	addrReport := flag.String(
+		"report-addr",
+		emptyValue,
+		"addr for report progress info or error message")
+
+	intervalReport := flag.Int(
+		"report-interval",
+		0,
+		"interval for report progress info, time unit is second, must positive integer")
+
+	retryLimit := flag.Int(
+		"retry-limit",
+		-1,
+		"limit of retry copy of cross filesystem move, default limit is 3")
+
+	preserve := flag.String(
+		"preserve",
+		rsync_wrapper.PreserveDefault,
+		"preservation profile of cross filesystem move, comma separated attributes: perms,owner,group,times,acls,xattrs,hardlinks,devices,atimes,crtimes, "+
+			"attribute with prefix - is removed, default(perms,owner,group,times,acls,hardlinks) and none are able to be used as base, "+
+			"example: default,-owner,-group")
+
+	isDryRun := flag.Bool(
+		"dry-run",
+		false,
+		"run all checks and print plan of changes to stdout as json, exit with code of the real run, nothing is changed")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	srcMountSource := flag.String(
+		"src-mount-source",
+		"",
+		"expected source of src mount point, example: 10.0.0.1:/export, empty means not check")
+
+	srcMountOptions := flag.String(
+		"src-mount-options",
+		"",
+		"expected options of src mount point, example: rw,hard, empty means not check")
+
+	destMountSource := flag.String(
+		"dest-mount-source",
+		"",
+		"expected source of dest mount point, example: 10.0.0.1:/export, empty means not check")
+
+	destMountOptions := flag.String(
+		"dest-mount-options",
+		"",
+		"expected options of dest mount point, example: rw,hard, empty means not check")
+
+	nfsWaitInterval := flag.Int(
+		"nfs-wait-interval",
+		-1,
+		"second to wait NFS client cache update between stat of not exist path, negative means default of command")
+
+	nfsWaitAttempts := flag.Int(
+		"nfs-wait-attempts",
+		-1,
+		"max number of stat of not exist path, negative means default of command")
+
+	nfsCacheBust := flag.String(
+		"nfs-cache-bust",
+		"",
+		"bust NFS client cache of parent dir before stat, none, open-parent or list-parent, empty means default of command")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -65,7 +178,28 @@ func main() {
 		"srcMountPath:", *srcMountPath,
 		"destMountPath:", *destMountPath,
 		"isExcludeSrcDir", *isExcludeSrcDir,
+		"journalRelativePath:", *journalRelativePath,
+		"conflict:", *conflictMode,
+		"conflictCompare:", *conflictCompare,
+		"isCrossFS:", *isCrossFS,
+		"isReportProgress:", *isReportProgress,
+		"isReportStderr:", *isReportStderr,
+		"reportAddress:", *addrReport,
+		"reportInterval(second):", *intervalReport,
+		"retryLimit:", *retryLimit,
+		"preserve:", *preserve,
+		"isDryRun:", *isDryRun,
 		"isDebug:", *isDebug,
+		"srcMountSource:", *srcMountSource,
+		"srcMountOptions:", *srcMountOptions,
+		"destMountSource:", *destMountSource,
+		"destMountOptions:", *destMountOptions,
+		"nfsWaitInterval(second):", *nfsWaitInterval,
+		"nfsWaitAttempts:", *nfsWaitAttempts,
+		"nfsCacheBust:", *nfsCacheBust,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
 	)
 	log.Println("[mvWrapper-Info]Start check")
 
@@ -126,13 +260,51 @@ func main() {
 	log.Println("[mvWrapper-Info]Check path format...OK")
 
 	var exitCode int
+	srcWaitPolicy, err := filesystem.NewWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Unavailable NFS wait policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	// dest is allowed to be not exist, not need wait long
+	destWaitPolicy, _ := filesystem.NewQuickWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	log.Println("[mvWrapper-Info]NFS wait policy of src, interval:", srcWaitPolicy.Interval.String(),
+		"attempts:", srcWaitPolicy.Attempts,
+		"cache bust:", srcWaitPolicy.CacheBust,
+		"dest, interval:", destWaitPolicy.Interval.String(),
+		"attempts:", destWaitPolicy.Attempts,
+		"cache bust:", destWaitPolicy.CacheBust)
+
+	conflictPolicy, err := filesystem.ParseConflictPolicy(*conflictMode, *conflictCompare)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Unavailable conflict policy, err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	preserveProfile, err := rsync_wrapper.ParsePreserveProfile(*preserve)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Unavailable preservation profile:", *preserve, "and err:", err.Error())
+		os.Exit(exit_code.ErrInvalidArgument)
+	}
+
+	plan := dryrun.New("mv", *isDryRun)
+
+	log.Println("[mvWrapper-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to load filesystem type policy, err:", err.Error())
+		plan.ExitFail(srcPath1, destPath, exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[mvWrapper-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
+
 	if !(*isDebug) {
 		log.Println("[mvWrapper-Info]Start check src mount filesystem")
 		err = filesystem.IsMountPath(*srcMountPath)
 		if err != nil {
 			log.Println("[mvWrapper-Error]Failed to check src mount filesystem, err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*srcMountPath, "", exitCode)
 		}
 		log.Println("[mvWrapper-Info]Check src mount filesystem...OK")
 
@@ -141,38 +313,76 @@ func main() {
 		if err != nil {
 			log.Println("[mvWrapper-Error]Failed to check dest mount filesystem, err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*destMountPath, "", exitCode)
 		}
 		log.Println("[mvWrapper-Info]Check dest mount filesystem...OK")
+
+		log.Println("[mvWrapper-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*srcMountPath, filesystem.ParseMountExpect(*srcMountSource, *srcMountOptions))
+		if err != nil {
+			log.Println("[mvWrapper-Error]Failed to verify src mount point:", *srcMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*srcMountPath, "", exitCode)
+		}
+
+		err = filesystem.VerifyMountPoint(*destMountPath, filesystem.ParseMountExpect(*destMountSource, *destMountOptions))
+		if err != nil {
+			log.Println("[mvWrapper-Error]Failed to verify dest mount point:", *destMountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*destMountPath, "", exitCode)
+		}
+		log.Println("[mvWrapper-Info]Verify mount point...OK")
+	}
+
+	log.Println("[mvWrapper-Info]Start check path is beneath mount point")
+	err = filesystem.CheckPathBeneath(*srcMountPath, *srcRelativePath)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to check src path:", *srcRelativePath,
+			"is beneath mount point:", *srcMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(srcPath1, "", exitCode)
 	}
 
+	err = filesystem.CheckPathBeneath(*destMountPath, *destRelativePath)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to check dest path:", *destRelativePath,
+			"is beneath mount point:", *destMountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(destPath, "", exitCode)
+	}
+
+	if len(*journalRelativePath) != 0 {
+		err = filesystem.CheckPathBeneath(*srcMountPath, *journalRelativePath)
+		if err != nil {
+			log.Println("[mvWrapper-Error]Failed to check journal path:", *journalRelativePath,
+				"is beneath mount point:", *srcMountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*journalRelativePath, "", exitCode)
+		}
+	}
+	log.Println("[mvWrapper-Info]Check path is beneath mount point...OK")
+	mountPointList = []string{*srcMountPath, *destMountPath}
+
 	// sleep and retry avoid NFS client cache not update
 	var (
 		srcInfo     os.FileInfo
 		srcRetryNum int
 	)
 	log.Println("[mvWrapper-Info]Start check src path is exist")
-	for {
-		if srcRetryNum >= waitNFSCcliLimit {
+	srcInfo, srcRetryNum, err = srcWaitPolicy.Stat(srcPath1)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println("[mvWrapper-Error]Src path:", srcPath1,
 				"is not exist, retry stat num:", srcRetryNum)
-			os.Exit(exit_code.ErrNoSuchFileOrDir)
-		}
-
-		srcInfo, err = os.Stat(srcPath1)
-		if err == nil {
-			break
+			plan.ExitFail(srcPath1, "", exit_code.ErrNoSuchFileOrDir)
 		}
 
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println("[mvWrapper-Error]Failed to stat src path:", srcPath1,
-				"and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
-		}
-
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		srcRetryNum += 1
+		log.Println("[mvWrapper-Error]Failed to stat src path:", srcPath1,
+			"and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(srcPath1, "", exitCode)
 	}
 	log.Println("[mvWrapper-Info]Check src path is exist...Exist")
 
@@ -182,28 +392,32 @@ func main() {
 		destRetryNum int
 	)
 	log.Println("[mvWrapper-Info]Start check dest path is exist")
-	for {
+	destInfo, destRetryNum, err = destWaitPolicy.Stat(destPath)
+	if err == nil {
+		log.Println("[mvWrapper-Info]Check dest path is exist...Exist")
+		isDestExist = true
+	} else {
 		// dest path allow not exist
-		if destRetryNum >= waitNFSCcliLimit {
-			log.Println("[mvWrapper-Info]Check dest path is exist...NotExist")
-			break
-		}
-
-		destInfo, err = os.Stat(destPath)
-		if err == nil {
-			log.Println("[mvWrapper-Info]Check dest path is exist...Exist")
-			isDestExist = true
-			break
-		}
-
 		if !errors.Is(err, fs.ErrNotExist) {
 			log.Println("[mvWrapper]Failed to stat dest path:", destPath, "and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(destPath, "", exitCode)
 		}
+		log.Println("[mvWrapper-Info]Check dest path is exist...NotExist, retry stat num:", destRetryNum)
+	}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		destRetryNum += 1
+	// request of cross filesystem move, nil means only rename
+	var moveReq *move.ReqContent
+	if *isCrossFS {
+		moveReq = &move.ReqContent{
+			IsReportProgress: *isReportProgress,
+			IsReportStderr:   *isReportStderr,
+			ReportClient:     client.NewReportClient(),
+			ReportInterval:   *intervalReport,
+			ReportAddr:       *addrReport,
+			RetryPolicy:      rsync_wrapper.NewRetryPolicy(*retryLimit),
+			Preserve:         preserveProfile,
+		}
 	}
 
 	log.Println("[mvWrapper-Info]End check")
@@ -215,27 +429,30 @@ func main() {
 				- if dest is exit:
 					- if dest is not dir -> ENOTDIR;
 					- if dest is dir -> read dir names of src -> build new file name:
-						- check new file name is exist in dest dir:
-							- if new file exist in dest dir -> EEXIST;
+						- preflight all new file names before rename:
+							- if new file exist in dest dir -> resolve by conflict policy, default EEXIST;
 							- if get err when stat new file -> EACCES/EPERM/ErrSystem(custom);
-							- if new file not exist -> rename(src/file, dest/file) ;
+						- rename(src/file, dest/file) and record to undo journal,
+						  if failed -> rollback renamed files;
 				 - remove src dir(empty dir)
 
 			- if include src dir:
 				- if dest not exist -> rename(src, dest);
 				- if dest is exist:
 					- if dest is file -> ENOTDIR;
-					- if dest is dir -> rename(src, dest/src);
+					- if dest is dir -> rename(src, dest/src), dest/src is resolved by conflict policy;
 
 		src is file:
 			- if dest not exist -> rename(src, dest);
 			- if dest exist:
-				- if dest is file -> EEXIST;
+				- if dest is file -> resolve by conflict policy, default EEXIST;
 				- if dest is dir -> build new file name:
 					- check new file name is exist in dest dir:
-						- if new file exist in dest dir -> EEXIST;
+						- if new file exist in dest dir -> resolve by conflict policy, default EEXIST;
 						- if new file not exist -> rename(src, dest/src);
 
+		rename never replace a path that is not resolved as exist by conflict policy,
+		so a path created by concurrent writer after check cause EEXIST instead of being overwritten.
 	*/
 
 	// src is dir
@@ -252,7 +469,7 @@ func main() {
 		if !(*isExcludeSrcDir) && (srcPath1 == destPath1) {
 			log.Println("[mvWrapper-Error]Cannot copy a directory into itself, dir:",
 				srcPath1)
-			os.Exit(exit_code.ErrDirectoryNestedItself)
+			plan.ExitFail(srcPath1, destPath, exit_code.ErrDirectoryNestedItself)
 		}
 
 		// case: mv /home/dir/* /home/dir/
@@ -260,7 +477,7 @@ func main() {
 			log.Println(
 				"[mvWrapper-Error]The source and destination are the same file, parent dir:",
 				srcPath1)
-			os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+			plan.ExitFail(srcPath1, destPath, exit_code.ErrSrcAndDstAreSameFile)
 		}
 
 		// case: mv /home/dir /home
@@ -272,7 +489,7 @@ func main() {
 		if !(*isExcludeSrcDir) && (srcPath1 == destPath2+srcInfo.Name()) {
 			log.Println(
 				"[mvWrapper-Error]The source and destination are the same file:", srcPath1)
-			os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+			plan.ExitFail(srcPath1, destPath, exit_code.ErrSrcAndDstAreSameFile)
 		}
 
 		// case: mv src/* dest
@@ -280,17 +497,17 @@ func main() {
 
 			if !isDestExist {
 				log.Println("[mvWrapper-Error]Src is dir and exclude src dir, but dest is not exist")
-				os.Exit(exit_code.ErrNoSuchFileOrDir)
+				plan.ExitFail(srcPath1, destPath, exit_code.ErrNoSuchFileOrDir)
 			}
 
 			if destInfo == nil {
 				log.Println("[mvWrapper-Error]Src is dir and exclude src dir, but dest is not exist")
-				os.Exit(exit_code.ErrNoSuchFileOrDir)
+				plan.ExitFail(srcPath1, destPath, exit_code.ErrNoSuchFileOrDir)
 			}
 
 			if !destInfo.IsDir() {
 				log.Println("[mvWrapper-Error]Src is dir and exclude src dir, but dest is not dir")
-				os.Exit(exit_code.ErrNotDirectory)
+				plan.ExitFail(srcPath1, destPath, exit_code.ErrNotDirectory)
 			}
 
 			var (
@@ -301,14 +518,19 @@ func main() {
 				destDirPath += "/"
 			}
 
+			journalPath := move.JournalPath(srcPath1)
+			if len(*journalRelativePath) != 0 {
+				journalPath = filepath.Join(*srcMountPath, *journalRelativePath)
+			}
+
 			log.Println("[mvWrapper-Info]Rename start, src is dir and exclude src dir:", srcPath1)
 			log.Println("[mvWrapper-Info]Start read names of src dir")
-			err = renameChild(srcDirPath, destDirPath)
+			err = renameChild(srcDirPath, destDirPath, journalPath, conflictPolicy, moveReq, plan)
 			if err != nil {
 				log.Println("[mvWrapper-Error]Failed to rename file from src dir:", srcDirPath,
 					"to dest dir:", destDirPath, "and err:", err.Error())
-				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				exitCode = move.ExitCode(err)
+				plan.ExitFail(srcDirPath, destDirPath, exitCode)
 			}
 			log.Println("[mvWrapper-Info]Rename end, src is dir and exclude src dir:", srcPath1)
 
@@ -316,7 +538,7 @@ func main() {
 			if !isDestExist || destInfo == nil {
 				log.Println("[mvWrapper-Info]Rename start, src is dir:", srcPath1,
 					"and include src dir, dest is not exist:", destPath)
-				err = os.Rename(srcPath1, destPath)
+				err = renameOrMove(srcPath1, filesystem.ConflictResult{Path: destPath}, moveReq, plan)
 				if err != nil {
 					log.Println(
 						"[mvWrapper-Error]Failed to rename src dir:", srcPath1,
@@ -324,15 +546,15 @@ func main() {
 						"isExcludeSrcDir:", *isExcludeSrcDir,
 						"and err:", err.Error())
 
-					exitCode = exit_code.ExitCodeConvertWithErr(err)
-					os.Exit(exitCode)
+					exitCode = move.ExitCode(err)
+					plan.ExitFail(srcPath1, destPath, exitCode)
 				}
 				log.Println("[mvWrapper-Info]Rename end, src is dir:", srcPath1,
 					"and include src dir, dest is not exist:", destPath)
 			} else {
 				if !destInfo.IsDir() {
 					log.Println("[mvWrapper-Error]Src is dir and include src dir, but dest is a exist file")
-					os.Exit(exit_code.ErrNotDirectory)
+					plan.ExitFail(srcPath1, destPath, exit_code.ErrNotDirectory)
 				}
 
 				srcFileName := filepath.Base(srcPath1)
@@ -340,10 +562,20 @@ func main() {
 				if destDirPath[len(destDirPath)-1] != slash {
 					destDirPath += "/"
 				}
-				newFilePath := destDirPath + srcFileName
+				result, isRename, err := resolveConflict(conflictPolicy, plan, srcPath1, destDirPath+srcFileName)
+				if err != nil {
+					log.Println("[mvWrapper-Error]Failed to resolve conflict of new path:", destDirPath+srcFileName,
+						"and err:", err.Error())
+					exitCode = exit_code.ExitCodeConvertWithErr(err)
+					plan.ExitFail(srcPath1, destDirPath+srcFileName, exitCode)
+				}
+				if !isRename {
+					plan.Exit(exit_code.Succeed)
+				}
+				newFilePath := result.Path
 				log.Println("[mvWrapper-Info]Rename start, src is dir:", srcPath1,
 					"and include src dir, dest already exist, new path:", newFilePath)
-				err = os.Rename(srcPath1, newFilePath)
+				err = renameOrMove(srcPath1, result, moveReq, plan)
 				if err != nil {
 					log.Println(
 						"[mvWrapper-Error]Failed to rename src dir:", srcPath1,
@@ -351,8 +583,8 @@ func main() {
 						"isExcludeSrcDir:", *isExcludeSrcDir,
 						"and err:", err.Error())
 
-					exitCode = exit_code.ExitCodeConvertWithErr(err)
-					os.Exit(exitCode)
+					exitCode = move.ExitCode(err)
+					plan.ExitFail(srcPath1, newFilePath, exitCode)
 				}
 				log.Println("[mvWrapper-Info]Rename end, src is dir:", srcPath1,
 					"and include src dir, dest already exist, new path:", newFilePath)
@@ -364,14 +596,14 @@ func main() {
 		if !isDestExist || destInfo == nil {
 			log.Println("[mvWrapper-Info]Rename start, src is file:", srcPath1,
 				"dest is not exist:", destPath)
-			err = os.Rename(srcPath1, destPath)
+			err = renameOrMove(srcPath1, filesystem.ConflictResult{Path: destPath}, moveReq, plan)
 			if err != nil {
 				log.Println(
 					"[mvWrapper-Error]Failed to rename src file:", srcPath1,
 					"to not exist dest file:", destPath,
 					"and err:", err.Error())
-				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				exitCode = move.ExitCode(err)
+				plan.ExitFail(srcPath1, destPath, exitCode)
 			}
 			log.Println("[mvWrapper-Info]Rename end, src is file:", srcPath1,
 				"dest is not exist:", destPath)
@@ -380,14 +612,36 @@ func main() {
 			// case: mv /home/dir/file /home/dir/file
 			if srcPath1 == destPath {
 				log.Println("[mvWrapper-Error]The source and destination are the same file, file:", srcPath1)
-				os.Exit(exit_code.ErrSrcAndDstAreSameFile)
+				plan.ExitFail(srcPath1, destPath, exit_code.ErrSrcAndDstAreSameFile)
 			}
 
-			// src is file but dest is a exist file -> EEXIST
+			// src is file but dest is a exist file -> resolve by conflict policy
 			if !destInfo.IsDir() {
-				log.Println("[mvWrapper-Error]Src is file:", srcPath1,
+				log.Println("[mvWrapper-Info]Src is file:", srcPath1,
 					"but dest is a exist file:", destPath)
-				os.Exit(exit_code.ErrFileIsExists)
+				result, isRename, err := resolveConflict(conflictPolicy, plan, srcPath1, destPath)
+				if err != nil {
+					log.Println("[mvWrapper-Error]Failed to resolve conflict of new path:", destPath,
+						"and err:", err.Error())
+					exitCode = exit_code.ExitCodeConvertWithErr(err)
+					plan.ExitFail(srcPath1, destPath, exitCode)
+				}
+				if !isRename {
+					plan.Exit(exit_code.Succeed)
+				}
+
+				newFilePath := result.Path
+				err = renameOrMove(srcPath1, result, moveReq, plan)
+				if err != nil {
+					log.Println("[mvWrapper-Error]Failed to rename src file:", srcPath1,
+						"to exist dest file:", newFilePath,
+						"and err:", err.Error())
+					exitCode = move.ExitCode(err)
+					plan.ExitFail(srcPath1, newFilePath, exitCode)
+				}
+				log.Println("[mvWrapper-Info]Rename end, src is file:", srcPath1,
+					"dest is exist file:", newFilePath)
+				plan.Exit(exit_code.Succeed)
 			}
 
 			// src is file and dest is exist dir
@@ -396,25 +650,27 @@ func main() {
 				destDirPath += "/"
 			}
 			srcFileName := filepath.Base(srcPath1)
-			newFilePath := destDirPath + srcFileName
-
-			_, err = os.Stat(newFilePath)
-			if err == nil {
-				// at dest already exist file that same name to src file
-				log.Println("[mvWrapper-Error]New file:", newFilePath,
-					"is already exist in dest dir:", destDirPath)
-				os.Exit(exit_code.ErrFileIsExists)
+			result, isRename, err := resolveConflict(conflictPolicy, plan, srcPath1, destDirPath+srcFileName)
+			if err != nil {
+				log.Println("[mvWrapper-Error]Failed to resolve conflict of new path:", destDirPath+srcFileName,
+					"and err:", err.Error())
+				exitCode = exit_code.ExitCodeConvertWithErr(err)
+				plan.ExitFail(srcPath1, destDirPath+srcFileName, exitCode)
+			}
+			if !isRename {
+				plan.Exit(exit_code.Succeed)
 			}
 
+			newFilePath := result.Path
 			log.Println("[mvWrapper-Info]Rename start, src is file:", srcPath1,
 				"dest is exist dir, new file:", newFilePath)
-			err = os.Rename(srcPath1, newFilePath)
+			err = renameOrMove(srcPath1, result, moveReq, plan)
 			if err != nil {
 				log.Println("[mvWrapper-Error]Failed to rename src file:", srcPath1,
 					"to new file:", newFilePath,
 					"and err:", err.Error())
-				exitCode = exit_code.ExitCodeConvertWithErr(err)
-				os.Exit(exitCode)
+				exitCode = move.ExitCode(err)
+				plan.ExitFail(srcPath1, newFilePath, exitCode)
 			}
 			log.Println("[mvWrapper-Info]Rename end, src is file:", srcPath1,
 				"dest is exist dir, new file:", newFilePath)
@@ -425,10 +681,128 @@ func main() {
 		"[mvWrapper-Info]Succeed to move src:", srcPath1,
 		"to dest:", destPath,
 		"isExcludeSrcDir", *isExcludeSrcDir)
-	os.Exit(exit_code.Succeed)
+	plan.Exit(exit_code.Succeed)
+}
+
+// renameOrMove rename old path to resolved path of target, exist path is replaced only if target allow it,
+// and dest is backed up if required. If they are at different filesystem and move request is not nil,
+// fallback to cross filesystem move. Nothing is changed if dry run.
+func renameOrMove(oldPath string, target filesystem.ConflictResult, moveReq *move.ReqContent, plan *dryrun.Plan) error {
+	if plan.IsEnable() {
+		return planRename(plan, oldPath, target.Path, moveReq)
+	}
+
+	err := checkBeneathMount(oldPath, target.Path, target.BackupPath)
+	if err != nil {
+		return err
+	}
+
+	err = target.Replace(oldPath)
+	if err == nil {
+		if len(target.BackupPath) != 0 {
+			log.Println("[mvWrapper-Info]New path is exist:", target.Path, "backup to:", target.BackupPath)
+		}
+		return nil
+	}
+
+	if moveReq == nil || !errors.Is(err, unix.EXDEV) {
+		return err
+	}
+
+	// backup is done if required, dest is not exist unless overwrite
+	log.Println("[mvWrapper-Warning]Src:", oldPath, "and dest:", target.Path,
+		"are at different filesystem, fallback to cross filesystem move")
+	req := *moveReq
+	req.SrcPath = oldPath
+	req.DestPath = target.Path
+	req.SrcMountPath = mountPointOf(oldPath)
+	req.IsOverwrite = target.IsExist && len(target.BackupPath) == 0
+	return move.CrossFSMove(req)
 }
 
-func renameChild(srcDir, destDir string) error {
+// checkBeneathMount check each path is beneath one of mount points, empty path is ignored.
+func checkBeneathMount(pathList ...string) error {
+	var err error
+	for _, path := range pathList {
+		if len(path) == 0 {
+			continue
+		}
+
+		for _, mountPoint := range mountPointList {
+			err = filesystem.CheckAbsPathBeneath(mountPoint, path)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Println("[mvWrapper-Error]Path is not beneath mount point right before rename:", path,
+				"mount points:", mountPointList, "and err:", err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mountPointOf return the first mount point that path is beneath, path is checked by checkBeneathMount before.
+func mountPointOf(path string) string {
+	for _, mountPoint := range mountPointList {
+		if filesystem.CheckAbsPathBeneath(mountPoint, path) == nil {
+			return mountPoint
+		}
+	}
+
+	return ""
+}
+
+// planRename add rename to plan, it is a move if old path and parent of new path are at different filesystem,
+// itemized changes of copy are added to plan if old path is dir.
+func planRename(plan *dryrun.Plan, oldPath, newPath string, moveReq *move.ReqContent) error {
+	var oldStat, newParentStat unix.Stat_t
+	err := unix.Lstat(oldPath, &oldStat)
+	if err != nil {
+		return &os.PathError{Op: "lstat", Path: oldPath, Err: err}
+	}
+
+	newParentPath := filepath.Dir(filepath.Clean(newPath))
+	err = unix.Stat(newParentPath, &newParentStat)
+	if err != nil {
+		return &os.PathError{Op: "stat", Path: newParentPath, Err: err}
+	}
+
+	if oldStat.Dev == newParentStat.Dev {
+		plan.Add(dryrun.OpRename, oldPath, newPath, "")
+		return nil
+	}
+
+	if moveReq == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: unix.EXDEV}
+	}
+
+	plan.Add(dryrun.OpMove, oldPath, newPath, "different filesystem")
+	if oldStat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return nil
+	}
+
+	itemizeList, exitCode := dir.DryRun(dir.ReqContent{
+		SrcPath:  filepath.Clean(oldPath) + slashStr,
+		DestPath: move.StagingPath(newPath) + slashStr,
+		Preserve: moveReq.Preserve,
+	})
+	plan.Itemize = append(plan.Itemize, itemizeList...)
+	if exitCode != exit_code.Succeed {
+		return &move.CopyError{SrcPath: oldPath, DestPath: newPath, ExitCode: exitCode}
+	}
+	return nil
+}
+
+// renameChild move all children of src dir into dest dir.
+// Conflict of names is resolved by policy before any move, and each move is recorded to undo journal,
+// if failed to move a child, children that already moved will be moved back.
+// Journal is removed if all children moved or rollback complete, otherwise it is kept
+// as machine-readable list of moved children.
+func renameChild(srcDir, destDir, journalPath string, policy filesystem.ConflictPolicy,
+	moveReq *move.ReqContent, plan *dryrun.Plan) error {
 	if len(srcDir) == 0 || len(destDir) == 0 {
 		return fs.ErrNotExist
 	}
@@ -443,70 +817,209 @@ func renameChild(srcDir, destDir string) error {
 		destDir += slashStr
 	}
 
+	srcDirF, err := os.Open(srcDir)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to open src dir:", srcDir, "and err:", err.Error())
+		return err
+	}
+
+	// read all names once, because moving children may cause the OS to reshuffle dir,
+	// and names are required by preflight.
+	nameList, err := srcDirF.Readdirnames(-1)
+	_ = srcDirF.Close()
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to readdirnames of path:", srcDir, "and err:", err.Error())
+		return err
+	}
+
+	log.Println("[mvWrapper-Info]Start preflight name conflict of", len(nameList), "children")
 	var (
-		respSize     int
-		srcDirF      *os.File
-		err          error
-		nameList     []string
-		childname    string
+		conflictErr  error
 		childOldPath string
-		childNewPath string
+		result       filesystem.ConflictResult
+		resultList   []filesystem.ConflictResult
+		oldPathList  []string
 	)
-
-	for {
-		srcDirF, err = os.Open(srcDir)
+	for _, childname := range nameList {
+		childOldPath = srcDir + childname
+		result, err = policy.Resolve(childOldPath, destDir+childname)
 		if err != nil {
-			log.Println("[mvWrapper-Error]Failed to open src dir:", srcDir, "and err:", err.Error())
-			return err
-		}
-
-		nameList, err = srcDirF.Readdirnames(defaultLimtReadDir)
-		if err != nil {
-			_ = srcDirF.Close()
-
-			if errors.Is(err, io.EOF) {
-				return nil
+			if !errors.Is(err, fs.ErrExist) {
+				log.Println("[mvWrapper-Error]Failed to resolve conflict of path:", destDir+childname,
+					"and err:", err.Error())
+				return err
 			}
 
-			log.Println("[mvWrapper-Error]Failed to readdirnames of path:", srcDir, "and err:", err.Error())
-			return err
+			log.Println("[mvWrapper-Error]Path is exist:", destDir+childname)
+			if conflictErr == nil {
+				conflictErr = err
+			}
+			continue
 		}
 
-		respSize = len(nameList)
-		for _, childname = range nameList {
-			childNewPath = destDir + childname
-			_, err = os.Stat(childNewPath)
-			if err == nil {
-				log.Println("[mvWrapper-Error]Path is exist:", childNewPath)
-				return fs.ErrExist
-			}
+		if result.Skip {
+			log.Println("[mvWrapper-Info]Path is exist, skip:", childOldPath, "by conflict policy:", policy.Mode)
+			continue
+		}
+		resultList = append(resultList, result)
+		oldPathList = append(oldPathList, childOldPath)
+	}
+	if conflictErr != nil {
+		return conflictErr
+	}
+	log.Println("[mvWrapper-Info]Preflight name conflict...OK, children to rename:", len(resultList))
 
-			if !errors.Is(err, fs.ErrNotExist) {
-				log.Println("[mvWrapper-Error]Failed to stat path:", childNewPath, "and err:", err.Error())
-				return err
+	if plan.IsEnable() {
+		for i, result := range resultList {
+			if len(result.BackupPath) != 0 {
+				plan.Add(dryrun.OpBackup, result.Path, result.BackupPath, "new path is exist")
 			}
 
-			childOldPath = srcDir + childname
-			err = os.Rename(childOldPath, childNewPath)
+			err = renameOrMove(oldPathList[i], result, moveReq, plan)
 			if err != nil {
-				log.Println("[mvWrapper-Error]Failed to rename from old:", childOldPath,
-					"to new:", childNewPath, "and err:", err.Error())
 				return err
 			}
 		}
+		return nil
+	}
 
-		// Removing files from the directory may have caused
-		// the OS to reshuffle it. Simply calling Readdirnames
-		// again may skip some entries. The only reliable way
-		// to avoid this is to close and re-open the
-		// directory. See issue 20841.
-		_ = srcDirF.Close()
+	journal, err := move.OpenJournal(journalPath)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to create undo journal:", journalPath, "and err:", err.Error())
+		return err
+	}
+	log.Println("[mvWrapper-Info]Undo journal:", journalPath)
+
+	for i, result := range resultList {
+		childOldPath = oldPathList[i]
+		err = nil
 
-		// Finish when the end of the directory is reached
-		if respSize < defaultLimtReadDir {
-			break
+		// backup is recorded as a move, so it is restored by rollback, old backup is replaced
+		if len(result.BackupPath) != 0 {
+			err = renameAndRecord(journal, result.Path,
+				filesystem.ConflictResult{Path: result.BackupPath, IsExist: true}, nil)
+		}
+
+		// dest may be created after preflight, it is not replaced unless resolved as exist
+		if err == nil {
+			err = renameAndRecord(journal, childOldPath, filesystem.ConflictResult{
+				Path:    result.Path,
+				IsExist: result.IsExist && len(result.BackupPath) == 0,
+			}, moveReq)
+		}
+
+		if err != nil {
+			log.Println("[mvWrapper-Error]Failed to rename from old:", childOldPath,
+				"to new:", result.Path, "and err:", err.Error())
+			rollbackChild(journal, moveReq)
+			return err
 		}
 	}
 
+	err = journal.Remove()
+	if err != nil {
+		log.Println("[mvWrapper-Warning]Failed to remove undo journal:", journalPath, "and err:", err.Error())
+	}
+
+	return nil
+}
+
+// renameAndRecord rename old path to resolved path of target and record it to journal,
+// if failed to record, it is kept at memory to rollback.
+func renameAndRecord(journal *move.Journal, oldPath string, target filesystem.ConflictResult,
+	moveReq *move.ReqContent) error {
+	newPath := target.Path
+	err := renameOrMove(oldPath, target, moveReq, nil)
+	if err != nil {
+		return err
+	}
+
+	err = journal.Record(move.JournalOpMove, oldPath, newPath)
+	if err != nil {
+		log.Println("[mvWrapper-Error]Failed to record move from old:", oldPath,
+			"to new:", newPath, "to undo journal:", journal.Path, "and err:", err.Error())
+		journal.Moved = append(journal.Moved, move.JournalEntry{
+			Op:      move.JournalOpMove,
+			OldPath: oldPath,
+			NewPath: newPath,
+		})
+		return err
+	}
+
 	return nil
 }
+
+// resolveConflict resolve conflict of new path by policy, exist new path is backed up by renameOrMove,
+// return resolved path to rename to, and false if rename should be skipped.
+func resolveConflict(policy filesystem.ConflictPolicy, plan *dryrun.Plan,
+	oldPath, newPath string) (filesystem.ConflictResult, bool, error) {
+	result, err := policy.Resolve(oldPath, newPath)
+	if err != nil {
+		return result, false, err
+	}
+
+	if result.Skip {
+		log.Println("[mvWrapper-Info]New path is exist:", newPath, "skip by conflict policy:", policy.Mode)
+		plan.Add(dryrun.OpSkip, oldPath, newPath, "new path is exist, conflict policy: "+policy.Mode)
+		return result, false, nil
+	}
+
+	if result.Path != newPath {
+		log.Println("[mvWrapper-Info]New path is exist:", newPath, "rename to:", result.Path,
+			"by conflict policy:", policy.Mode)
+	}
+
+	if len(result.BackupPath) != 0 {
+		plan.Add(dryrun.OpBackup, newPath, result.BackupPath, "new path is exist")
+	}
+
+	return result, true, nil
+}
+
+// rollbackChild move back children that recorded at journal in reverse order,
+// journal is kept if some children failed to move back.
+// Child that moved back is rolled back even if failed to record it to journal.
+func rollbackChild(journal *move.Journal, moveReq *move.ReqContent) {
+	log.Println("[mvWrapper-Warning]Start rollback", len(journal.Moved), "moved children")
+
+	var (
+		err         error
+		movedList   = append([]move.JournalEntry(nil), journal.Moved...)
+		notRollback []move.JournalEntry // failed to move back
+		notRecorded []move.JournalEntry // moved back, but rollback is not recorded to journal
+	)
+	for i := len(movedList) - 1; i >= 0; i-- {
+		entry := movedList[i]
+		err = renameOrMove(entry.NewPath, filesystem.ConflictResult{Path: entry.OldPath}, moveReq, nil)
+		if err != nil {
+			log.Println("[mvWrapper-Error]Failed to rollback from:", entry.NewPath,
+				"to:", entry.OldPath, "and err:", err.Error())
+			notRollback = append(notRollback, entry)
+			continue
+		}
+
+		err = journal.Record(move.JournalOpRollback, entry.OldPath, entry.NewPath)
+		if err != nil {
+			log.Println("[mvWrapper-Warning]Succeed to rollback from:", entry.NewPath,
+				"to:", entry.OldPath, "but failed to record it to undo journal:", journal.Path,
+				"and err:", err.Error())
+			notRecorded = append(notRecorded, entry)
+		}
+	}
+
+	if len(notRollback) == 0 {
+		log.Println("[mvWrapper-Warning]Rollback complete, nothing is moved")
+		_ = journal.Remove()
+		return
+	}
+
+	_ = journal.Close()
+	for _, entry := range notRecorded {
+		log.Println("[mvWrapper-Warning]Rollback but not recorded at undo journal, old:", entry.OldPath,
+			"new:", entry.NewPath)
+	}
+	for _, entry := range notRollback {
+		log.Println("[mvWrapper-Error]Moved and not rollback, old:", entry.OldPath, "new:", entry.NewPath)
+	}
+	log.Println("[mvWrapper-Error]Rollback is not complete, undo journal is kept:", journal.Path)
+}
@@ -4,6 +4,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"io"
@@ -15,21 +17,35 @@ import (
 	"time"
 
 	"golang.org/x/sys/unix"
+	"transporter/pkg/client"
+	"transporter/pkg/dryrun"
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
+	"transporter/pkg/trash"
 )
 
 const (
 	emptyValue        = "empty"
 	slash             = '/'
 	slashStr          = "/"
-	waitNFSCliUpdate  = 5
-	waitNFSCcliLimit  = 5
 	PathSeparator     = '/' // OS-specific path separator
 	PathListSeparator = ':' // OS-specific path list separator
 	reqSize           = 1024
+
+	trashPurgeAll      = "all"
+	trashPurgeExpired  = "expired"
+	trashRetentionHour = 7 * 24
+
+	reportIntervalDefault = 5 // unit is second
+	patternSeparator      = ","
 )
 
+// reqProgress is progress of remove that reported to report addr, same format as progress of copy.
+type reqProgress struct {
+	CurrentCount int64 `json:"current_count"` // removed entries
+	TotalCount   int64 `json:"total_count"`   // found entries, it grows during remove
+}
+
 func main() {
 	mountPath := flag.String(
 		"mount-path",
@@ -51,11 +67,149 @@ func main() {
 		emptyValue,
 		"suffix of file to remove")
 
+	isCleanup := flag.Bool(
+		"cleanup",
+		false,
+		"remove matched files anywhere in the tree of dir, dir is kept, result is printed to stdout as json")
+
+	includePattern := flag.String(
+		"include",
+		"",
+		"glob patterns of files to remove by cleanup, separated by comma, pattern without slash match name at any depth, "+
+			"pattern with slash match path relative to dir, empty means all files")
+
+	excludePattern := flag.String(
+		"exclude",
+		"",
+		"glob patterns of files or dirs to keep by cleanup, same format as include, children of excluded dir are kept")
+
+	minAge := flag.Int(
+		"min-age",
+		0,
+		"hour, cleanup only remove files older than it, 0 means no limit")
+
+	ageBy := flag.String(
+		"age-by",
+		filesystem.AgeByMtime,
+		"time of file that min-age is compared with: mtime or atime")
+
+	minSize := flag.Int64(
+		"min-size",
+		0,
+		"byte, cleanup only remove files that size is not less than it, 0 means no limit")
+
+	isRemoveEmptyDir := flag.Bool(
+		"remove-empty-dir",
+		false,
+		"cleanup remove dirs that become empty after files removed, dirs that already empty are kept")
+
+	isTrash := flag.Bool(
+		"trash",
+		false,
+		"move path to trash dir of mount point instead of remove, it is able to be restored by trash-restore")
+
+	trashRestoreID := flag.String(
+		"trash-restore",
+		"",
+		"id of trash entry to restore to original path, relative-path is not required")
+
+	trashPurge := flag.String(
+		"trash-purge",
+		"",
+		"id of trash entry to remove permanently, 'expired' remove entries out of retention, 'all' remove all entries")
+
+	isTrashList := flag.Bool(
+		"trash-list",
+		false,
+		"print metadata of trash entries to stdout, one json per line")
+
+	trashRetention := flag.Int(
+		"trash-retention",
+		trashRetentionHour,
+		"hour to keep trash entry, expired entries are removed after each trash operation, negative means keep forever")
+
+	permMode := flag.String(
+		"perm-policy",
+		filesystem.PermPreserve,
+		"permission policy of dirs created by trash and trash-restore: preserve, inherit or enforce[:octal mode], example: enforce:0750, "+
+			"preserve never change exist path, inherit apply permission of parent dir to new path, enforce without mode means 0775")
+
+	conflictMode := flag.String(
+		"conflict",
+		filesystem.ConflictFail,
+		"policy of trash-restore if original path is exist: fail, skip, overwrite, overwrite-if-newer, "+
+			"overwrite-if-different, rename-with-suffix, backup")
+
+	workers := flag.Int(
+		"workers",
+		0,
+		"num of goroutines that remove dir tree in parallel, not used by trash mode, 0 means default")
+
+	isReportProgress := flag.Bool(
+		"progress",
+		false,
+		"report progress of remove, must used with 'report-addr' flag")
+
+	addrReport := flag.String(
+		"report-addr",
+		emptyValue,
+		"addr for report progress info")
+
+	intervalReport := flag.Int(
+		"report-interval",
+		0,
+		"interval for report progress info, time unit is second, must positive integer")
+
+	isDryRun := flag.Bool(
+		"dry-run",
+		false,
+		"run all checks and print plan of changes to stdout as json, exit with code of the real run, nothing is changed")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	mountSource := flag.String(
+		"mount-source",
+		"",
+		"expected source of mount point, example: 10.0.0.1:/export, empty means not check")
+
+	mountOptions := flag.String(
+		"mount-options",
+		"",
+		"expected options of mount point, example: rw,hard, empty means not check")
+
+	nfsWaitInterval := flag.Int(
+		"nfs-wait-interval",
+		-1,
+		"second to wait NFS client cache update between stat of not exist path, negative means default of command")
+
+	nfsWaitAttempts := flag.Int(
+		"nfs-wait-attempts",
+		-1,
+		"max number of stat of not exist path, negative means default of command")
+
+	nfsCacheBust := flag.String(
+		"nfs-cache-bust",
+		"",
+		"bust NFS client cache of parent dir before stat, none, open-parent or list-parent, empty means default of command")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -63,7 +217,34 @@ func main() {
 	log.Println("[rmWrapper-Info]New rm request, relativePath:", *relativePath,
 		"mountPoint:", *mountPath,
 		"isReservedDir:", *isReservedDir,
+		"isCleanup:", *isCleanup,
+		"include:", *includePattern,
+		"exclude:", *excludePattern,
+		"minAge(hour):", *minAge,
+		"ageBy:", *ageBy,
+		"minSize:", *minSize,
+		"isRemoveEmptyDir:", *isRemoveEmptyDir,
+		"isTrash:", *isTrash,
+		"trashRestoreID:", *trashRestoreID,
+		"trashPurge:", *trashPurge,
+		"isTrashList:", *isTrashList,
+		"trashRetention(hour):", *trashRetention,
+		"permPolicy:", *permMode,
+		"conflict:", *conflictMode,
+		"workers:", *workers,
+		"isReportProgress:", *isReportProgress,
+		"reportAddress:", *addrReport,
+		"reportInterval(second):", *intervalReport,
+		"isDryRun:", *isDryRun,
 		"isDebug:", *isDebug,
+		"mountSource:", *mountSource,
+		"mountOptions:", *mountOptions,
+		"nfsWaitInterval(second):", *nfsWaitInterval,
+		"nfsWaitAttempts:", *nfsWaitAttempts,
+		"nfsCacheBust:", *nfsCacheBust,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
 	)
 	log.Println("[rmWrapper-Info]Start check")
 
@@ -71,10 +252,12 @@ func main() {
 	var (
 		isPathAvailable bool
 		path            string
+		rmPath          string
 		err             error
 		exitCode        int
 		isSuffixEmpty   bool
 		suffixList      []string
+		cleanupReq      filesystem.CleanupReq
 	)
 
 	isPathAvailable = filesystem.CheckDirPathFormat(*mountPath)
@@ -83,43 +266,94 @@ func main() {
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
 
-	if *relativePath == emptyValue {
-		log.Println("[rmWrapper-Error]Unavailable format of relative path:", *relativePath)
-		os.Exit(exit_code.ErrInvalidArgument)
-	}
+	// trash command operate entries of trash, not need path
+	isTrashCommand := len(*trashRestoreID) != 0 || len(*trashPurge) != 0 || *isTrashList
+	if !isTrashCommand {
+		if *relativePath == emptyValue {
+			log.Println("[rmWrapper-Error]Unavailable format of relative path:", *relativePath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 
-	if *fileSuffix == emptyValue {
-		isSuffixEmpty = true
-		log.Println("[rmWrapper-Info]Not specify file suffix")
-	} else {
-		suffixList = strings.Split(*fileSuffix, slashStr)
-	}
+		if *fileSuffix == emptyValue {
+			isSuffixEmpty = true
+			log.Println("[rmWrapper-Info]Not specify file suffix")
+		} else {
+			suffixList = strings.Split(*fileSuffix, slashStr)
+		}
 
-	path, err = filesystem.AbsolutePath(*mountPath, *relativePath)
-	if err != nil {
-		log.Println("[rmWrapper-Error]Unavailable format of mount point:", *mountPath,
-			"or relative path:", *relativePath)
-		os.Exit(exit_code.ErrInvalidArgument)
+		path, err = filesystem.AbsolutePath(*mountPath, *relativePath)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Unavailable format of mount point:", *mountPath,
+				"or relative path:", *relativePath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		pathLen := len(path)
+		rmPath = path
+		if rmPath[pathLen-1] == slash {
+			rmPath = rmPath[:pathLen-1]
+		}
+
+		isPathAvailable = filesystem.CheckFilePathFormat(rmPath)
+		if !isPathAvailable {
+			log.Println("[rmWrapper-Error]Unavailable format of path:", rmPath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		if endsWithDot(rmPath) {
+			log.Println("[rmWrapper-Error]Path end with dot:", rmPath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 	}
 
-	pathLen := len(path)
-	rmPath := path
-	if rmPath[pathLen-1] == slash {
-		rmPath = rmPath[:pathLen-1]
+	if *isCleanup {
+		cleanupReq = filesystem.CleanupReq{
+			IncludeList:      splitPattern(*includePattern),
+			ExcludeList:      splitPattern(*excludePattern),
+			MinAge:           time.Duration(*minAge) * time.Hour,
+			AgeBy:            *ageBy,
+			MinSize:          *minSize,
+			IsRemoveEmptyDir: *isRemoveEmptyDir,
+		}
+
+		err = filesystem.CheckCleanupReq(cleanupReq)
+		if err != nil || *minAge < 0 || *minSize < 0 {
+			log.Println("[rmWrapper-Error]Unavailable cleanup request, include:", *includePattern,
+				"exclude:", *excludePattern,
+				"minAge:", *minAge,
+				"ageBy:", *ageBy,
+				"minSize:", *minSize)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 	}
 
-	isPathAvailable = filesystem.CheckFilePathFormat(rmPath)
-	if !isPathAvailable {
-		log.Println("[rmWrapper-Error]Unavailable format of path:", rmPath)
+	log.Println("[rmWrapper-Info]Check path format...OK")
+
+	waitPolicy, err := filesystem.NewQuickWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Unavailable NFS wait policy, err:", err.Error())
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
+	log.Println("[rmWrapper-Info]NFS wait policy, interval:", waitPolicy.Interval.String(),
+		"attempts:", waitPolicy.Attempts,
+		"cache bust:", waitPolicy.CacheBust)
 
-	if endsWithDot(rmPath) {
-		log.Println("[rmWrapper-Error]Path end with dot:", rmPath)
+	permPolicy, err := filesystem.ParsePermPolicy(*permMode)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Unavailable permission policy:", *permMode, "and err:", err.Error())
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
 
-	log.Println("[rmWrapper-Info]Check path format...OK")
+	plan := dryrun.New("rm", *isDryRun)
+
+	log.Println("[rmWrapper-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Failed to load filesystem type policy, err:", err.Error())
+		plan.ExitFail(rmPath, "", exit_code.ErrInvalidArgument)
+	}
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[rmWrapper-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
 
 	if !(*isDebug) {
 		log.Println("[rmWrapper-Info]Start check path mount filesystem")
@@ -127,9 +361,101 @@ func main() {
 		if err != nil {
 			log.Println("[rmWrapper-Error]Failed to check path mount filesystem, err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(*mountPath, "", exitCode)
 		}
 		log.Println("[rmWrapper-Info]Check path mount filesystem...OK")
+
+		log.Println("[rmWrapper-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*mountPath, filesystem.ParseMountExpect(*mountSource, *mountOptions))
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to verify mount point:", *mountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			plan.ExitFail(*mountPath, "", exitCode)
+		}
+		log.Println("[rmWrapper-Info]Verify mount point...OK")
+	}
+
+	trashBin := trash.New(*mountPath, permPolicy)
+	if isTrashCommand {
+		conflictPolicy, err := filesystem.ParseConflictPolicy(*conflictMode, "")
+		if err != nil {
+			log.Println("[rmWrapper-Error]Unavailable conflict policy, err:", err.Error())
+			plan.ExitFail(*mountPath, "", exit_code.ErrInvalidArgument)
+		}
+
+		exitCode = runTrashCommand(trashBin, *trashRestoreID, *trashPurge, *isTrashList,
+			*trashRetention, conflictPolicy, plan)
+		plan.Exit(exitCode)
+	}
+
+	log.Println("[rmWrapper-Info]Start check path is beneath mount point")
+	err = filesystem.CheckPathBeneath(*mountPath, *relativePath)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Failed to check path:", *relativePath,
+			"is beneath mount point:", *mountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(rmPath, "", exitCode)
+	}
+	log.Println("[rmWrapper-Info]Check path is beneath mount point...OK")
+
+	// path is removed relative to fd of parent dir that opened beneath mount point after path is found exist,
+	// so symlink swapped into parent after check is not followed
+	var (
+		rmParentFd int
+		rmName     string
+	)
+
+	if trashBin.Contains(rmPath) {
+		log.Println("[rmWrapper-Error]Path is in trash dir, use trash-purge instead:", rmPath)
+		plan.ExitFail(rmPath, "", exit_code.ErrInvalidArgument)
+	}
+
+	// remove path in parallel, or move it to trash
+	var progress filesystem.RemoveProgress
+	removeReq := filesystem.RemoveReq{
+		Workers:  *workers,
+		Skip:     trashBin.Contains,
+		Progress: &progress,
+	}
+	remove := func(path string) error {
+		if path == rmPath {
+			return filesystem.RemoveAllParallelAt(rmParentFd, rmName, path, removeReq)
+		}
+		// check again right before remove, symlink may be swapped in after the check at start
+		err := filesystem.CheckAbsPathBeneath(*mountPath, path)
+		if err != nil {
+			return err
+		}
+		return filesystem.RemoveAllParallel(path, removeReq)
+	}
+	if *isTrash {
+		log.Println("[rmWrapper-Info]Trash mode, path is moved to trash dir:", trashBin.Path)
+		remove = func(path string) error {
+			err := filesystem.CheckAbsPathBeneath(*mountPath, path)
+			if err != nil {
+				return err
+			}
+
+			info, err := trashBin.Put(path)
+			if err != nil {
+				return err
+			}
+
+			log.Println("[rmWrapper-Info]Succeed to move path:", path, "to trash, id:", info.ID)
+			return nil
+		}
+	}
+
+	if plan.IsEnable() {
+		removeOp := dryrun.OpRemove
+		if *isTrash {
+			removeOp = dryrun.OpTrash
+		}
+		remove = func(path string) error {
+			plan.Add(removeOp, path, "", "")
+			return nil
+		}
 	}
 
 	var (
@@ -137,33 +463,59 @@ func main() {
 		retryNum int
 	)
 	log.Println("[rmWrapper-Info]Start check path is exist")
-	for {
-		if retryNum >= waitNFSCcliLimit {
+	pInfo, retryNum, err = waitPolicy.Stat(rmPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println("[rmWrapper-Info]Path:", rmPath, "is not exist, retry stat num:", retryNum)
 			log.Println("[rmWrapper-Info]Check path is exist...NotExist")
 			log.Println("[rmWrapper-Info]Path that rm is not exist, exit with 0")
-			os.Exit(exit_code.Succeed)
+			plan.Exit(exit_code.Succeed)
 		}
 
-		pInfo, err = os.Stat(rmPath)
-		if err == nil {
-			break
+		log.Println("[rmWrapper-Error]Failed to stat path:", rmPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(rmPath, "", exitCode)
+	}
+	log.Println("[rmWrapper-Info]Check path is exist...Exist")
+
+	rmParentFd, rmName, err = filesystem.OpenParentBeneath(*mountPath, *relativePath)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Failed to open parent dir of path:", *relativePath,
+			"beneath mount point:", *mountPath, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		plan.ExitFail(rmPath, "", exitCode)
+	}
+
+	if *isCleanup {
+		if !pInfo.IsDir() {
+			log.Println("[rmWrapper-Error]Path of cleanup is not dir:", rmPath)
+			plan.ExitFail(rmPath, "", exit_code.ErrNotDirectory)
 		}
 
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println("[rmWrapper-Error]Failed to stat path:", rmPath, "and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+		cleanupReq.Skip = trashBin.Contains
+		if *isTrash || plan.IsEnable() {
+			cleanupReq.Remove = remove
+		} else {
+			cleanupReq.Remove = func(path string) error {
+				// check again right before remove, symlink may be swapped in after the check at start
+				err := filesystem.CheckAbsPathBeneath(*mountPath, path)
+				if err != nil {
+					return err
+				}
+				return os.Remove(path)
+			}
 		}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		retryNum += 1
+		exitCode = runCleanup(rmPath, cleanupReq, plan)
+		if exitCode == exit_code.Succeed && *isTrash {
+			expireTrash(trashBin, *trashRetention, plan)
+		}
+		plan.Exit(exitCode)
 	}
-	log.Println("[rmWrapper-Info]Check path is exist...Exist")
 
 	/*
 		path is not exist -> exit with code 0;
-		path is exist:
+		path is exist(remove means move to trash if trash mode):
 			- path is file -> remove file;
 			- path is dir:
 				- if reserved dir:
@@ -175,50 +527,95 @@ func main() {
 	// rm path is file
 	if !pInfo.IsDir() {
 		log.Println("[rmWrapper-Info]Start remove file:", rmPath)
-		err = os.Remove(rmPath)
+		if *isTrash || plan.IsEnable() {
+			err = remove(rmPath)
+		} else {
+			err = unix.Unlinkat(rmParentFd, rmName, 0)
+			if err != nil {
+				err = &os.PathError{Op: "unlinkat", Path: rmPath, Err: err}
+			}
+		}
 		if err == nil {
 			log.Println("[rmWrapper-Info]End remove file:", rmPath)
-			os.Exit(exit_code.Succeed)
+			if *isTrash {
+				expireTrash(trashBin, *trashRetention, plan)
+			}
+			plan.Exit(exit_code.Succeed)
 		}
 
 		if !errors.Is(err, fs.ErrNotExist) {
 			log.Println("[rmWrapper-Error]Failed to remove file:", rmPath, "and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			plan.ExitFail(rmPath, "", exitCode)
 		}
 
 		log.Println("[rmWrapper-Info]File is not exist, return succeed directly")
-		os.Exit(exit_code.Succeed)
+		plan.Exit(exit_code.Succeed)
 	}
 
 	// rm path is dir
 	log.Println("[rmWrapper-Info]Start remove dir:", rmPath,
 		"isReservedDir:", *isReservedDir,
 		"fileSuffix:", *fileSuffix)
+	// report progress until exit
+	stopReport := func() {}
+	if *isReportProgress && !(*isTrash) && !plan.IsEnable() {
+		stopReport = startReportProgress(&progress, *addrReport, client.NewReportClient(), *intervalReport)
+	}
+
 	if !(*isReservedDir) {
-		err = os.RemoveAll(rmPath)
+		err = remove(rmPath)
 		if err != nil {
 			log.Println("[rmWrapper-Error]Failed to remove dir:", rmPath,
 				"isReservedDir:", *isReservedDir,
 				"fileSuffix:", *fileSuffix,
 				"and err:", err.Error())
 			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+			stopReport()
+			plan.ExitFail(rmPath, "", exitCode)
 		}
 
 		log.Println("[rmWrapper-Info]End remove dir:", rmPath,
 			"isReservedDir:", *isReservedDir,
 			"fileSuffix:", *fileSuffix)
-		os.Exit(exit_code.Succeed)
+		if *isTrash {
+			expireTrash(trashBin, *trashRetention, plan)
+		}
+		stopReport()
+		plan.Exit(exit_code.Succeed)
 	}
 
 	// reserved dir
-	err = removeChild(rmPath, isSuffixEmpty, suffixList)
+	switch {
+	case plan.IsEnable():
+		err = planChild(rmPath, isSuffixEmpty, suffixList, trashBin, remove)
+	case *isTrash:
+		err = removeChild(rmPath, isSuffixEmpty, suffixList, trashBin, remove)
+	default:
+		// children not match suffix are kept
+		removeReq.Skip = func(path string) bool {
+			if trashBin.Contains(path) {
+				return true
+			}
+			return !isSuffixEmpty && filepath.Dir(path) == rmPath && !isNeedRemove(filepath.Base(path), suffixList)
+		}
+		err = filesystem.RemoveChildrenParallelAt(rmParentFd, rmName, rmPath, removeReq)
+	}
 	if err == nil {
-		os.Exit(exit_code.Succeed)
+		log.Println("[rmWrapper-Info]End remove children of dir:", rmPath)
+		if *isTrash {
+			expireTrash(trashBin, *trashRetention, plan)
+		}
+		stopReport()
+		plan.Exit(exit_code.Succeed)
 	}
 
+	log.Println("[rmWrapper-Error]Failed to remove children of dir:", rmPath,
+		"fileSuffix:", *fileSuffix,
+		"and err:", err.Error())
 	exitCode = exit_code.ExitCodeConvertWithErr(err)
+	stopReport()
+	plan.ExitFail(rmPath, "", exitCode)
 }
 
 func isNeedRemove(fileName string, fileSuffixList []string) bool {
@@ -236,7 +633,9 @@ func isNeedRemove(fileName string, fileSuffixList []string) bool {
 	return false
 }
 
-func removeChild(path string, isSuffixEmpty bool, suffixList []string) error {
+// removeChild remove children of path by remove func, trash dir is never removed.
+func removeChild(path string, isSuffixEmpty bool, suffixList []string,
+	trashBin trash.Trash, remove func(string) error) error {
 	if path == "" {
 		// fail silently to retain compatibility with previous behavior
 		// of RemoveAll. See issue 28830.
@@ -302,7 +701,11 @@ func removeChild(path string, isSuffixEmpty bool, suffixList []string) error {
 				}
 
 				childPath = path + childname
-				err = os.RemoveAll(childPath)
+				if trashBin.Contains(childPath) {
+					continue
+				}
+
+				err = remove(childPath)
 				if err != nil {
 					if removeErr == nil {
 						removeErr = err
@@ -356,3 +759,292 @@ func endsWithDot(path string) bool {
 func IsPathSeparator(c uint8) bool {
 	return PathSeparator == c
 }
+
+// runTrashCommand restore, purge or list entries of trash, return exit code.
+func runTrashCommand(trashBin trash.Trash, restoreID, purge string, isList bool,
+	retentionHour int, policy filesystem.ConflictPolicy, plan *dryrun.Plan) int {
+	if plan.IsEnable() && !isList {
+		return planTrashCommand(trashBin, restoreID, purge, retentionHour, policy, plan)
+	}
+
+	var err error
+	switch {
+	case len(restoreID) != 0:
+		log.Println("[rmWrapper-Info]Start restore trash entry:", restoreID)
+		var restoredPath string
+		restoredPath, err = trashBin.Restore(restoreID, policy)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to restore trash entry:", restoreID, "and err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		if len(restoredPath) == 0 {
+			log.Println("[rmWrapper-Info]Original path is exist, skip restore by conflict policy:", policy.Mode)
+		} else {
+			log.Println("[rmWrapper-Info]Succeed to restore trash entry:", restoreID, "to:", restoredPath)
+		}
+
+	case purge == trashPurgeExpired:
+		// expired entries are removed below
+
+	case purge == trashPurgeAll:
+		log.Println("[rmWrapper-Info]Start purge all trash entries")
+		var purged []trash.Info
+		purged, err = trashBin.Expire(0, time.Now().Add(time.Second))
+		log.Println("[rmWrapper-Info]Purge trash entries num:", len(purged))
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to purge all trash entries, err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+	case len(purge) != 0:
+		log.Println("[rmWrapper-Info]Start purge trash entry:", purge)
+		err = trashBin.Purge(purge)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to purge trash entry:", purge, "and err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+		log.Println("[rmWrapper-Info]Succeed to purge trash entry:", purge)
+
+	case isList:
+		var infoList []trash.Info
+		infoList, err = trashBin.List()
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to list trash entries, err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		for i := range infoList {
+			_ = encoder.Encode(&infoList[i])
+		}
+		log.Println("[rmWrapper-Info]List trash entries num:", len(infoList))
+		return exit_code.Succeed
+	}
+
+	expireTrash(trashBin, retentionHour, plan)
+	return exit_code.Succeed
+}
+
+// planTrashCommand add changes of trash command to plan, return exit code of the real run.
+func planTrashCommand(trashBin trash.Trash, restoreID, purge string,
+	retentionHour int, policy filesystem.ConflictPolicy, plan *dryrun.Plan) int {
+	var err error
+	switch {
+	case len(restoreID) != 0:
+		var result filesystem.ConflictResult
+		result, err = trashBin.ResolveRestore(restoreID, policy)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to resolve restore of trash entry:", restoreID, "and err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		if result.Skip {
+			plan.Add(dryrun.OpSkip, trashBin.EntryPath(restoreID), result.Path,
+				"original path is exist, conflict policy: "+policy.Mode)
+			break
+		}
+
+		if len(result.BackupPath) != 0 {
+			plan.Add(dryrun.OpBackup, result.Path, result.BackupPath, "original path is exist")
+		}
+		plan.Add(dryrun.OpRestore, trashBin.EntryPath(restoreID), result.Path, "")
+
+	case purge == trashPurgeExpired:
+		// expired entries are added below
+
+	case purge == trashPurgeAll:
+		var infoList []trash.Info
+		infoList, err = trashBin.List()
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to list trash entries, err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		for _, info := range infoList {
+			plan.Add(dryrun.OpRemove, trashBin.EntryPath(info.ID), "", "purge trash entry of: "+info.OriginalPath)
+		}
+		return exit_code.Succeed
+
+	case len(purge) != 0:
+		var info trash.Info
+		info, err = trashBin.Get(purge)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to get trash entry:", purge, "and err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+		plan.Add(dryrun.OpRemove, trashBin.EntryPath(info.ID), "", "purge trash entry of: "+info.OriginalPath)
+	}
+
+	expireTrash(trashBin, retentionHour, plan)
+	return exit_code.Succeed
+}
+
+// expireTrash remove entries out of retention, failure is only logged.
+func expireTrash(trashBin trash.Trash, retentionHour int, plan *dryrun.Plan) {
+	if retentionHour < 0 {
+		return
+	}
+
+	if plan.IsEnable() {
+		expired, err := trashBin.Expired(time.Duration(retentionHour)*time.Hour, time.Now())
+		if err != nil {
+			log.Println("[rmWrapper-Warning]Failed to list expired trash entries, err:", err.Error())
+		}
+
+		for _, info := range expired {
+			plan.Add(dryrun.OpRemove, trashBin.EntryPath(info.ID), "", "expired trash entry of: "+info.OriginalPath)
+		}
+		return
+	}
+
+	purged, err := trashBin.Expire(time.Duration(retentionHour)*time.Hour, time.Now())
+	for _, info := range purged {
+		log.Println("[rmWrapper-Info]Expired trash entry is removed, id:", info.ID,
+			"originalPath:", info.OriginalPath,
+			"deletedAt:", info.DeletedAt.Format(time.RFC3339))
+	}
+
+	if err != nil {
+		log.Println("[rmWrapper-Warning]Failed to remove expired trash entries, err:", err.Error())
+	}
+}
+
+// planChild remove children of path by remove func that only add action to plan,
+// all names are read at once because nothing is removed.
+func planChild(path string, isSuffixEmpty bool, suffixList []string,
+	trashBin trash.Trash, remove func(string) error) error {
+	dirF, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	nameList, err := dirF.Readdirnames(-1)
+	_ = dirF.Close()
+	if err != nil {
+		return err
+	}
+
+	if path[len(path)-1] != slash {
+		path += slashStr
+	}
+
+	for _, childname := range nameList {
+		if !isSuffixEmpty && !isNeedRemove(childname, suffixList) {
+			continue
+		}
+
+		if trashBin.Contains(path + childname) {
+			continue
+		}
+
+		err = remove(path + childname)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startReportProgress report progress of remove to addr by interval in background,
+// return func that report the last progress and stop.
+func startReportProgress(progress *filesystem.RemoveProgress, addr string,
+	rc *client.ReportClient, reportInterval int) func() {
+	if reportInterval <= 0 {
+		reportInterval = reportIntervalDefault
+	}
+
+	log.Println("[rmWrapper-Info]Report progress to:", addr, "interval:", reportInterval, "second")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(time.Duration(reportInterval) * time.Second)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				reportProgress(progress, addr, rc)
+				return
+			case <-t.C:
+				reportProgress(progress, addr, rc)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func reportProgress(progress *filesystem.RemoveProgress, addr string, rc *client.ReportClient) {
+	var reqContent reqProgress
+	reqContent.CurrentCount, reqContent.TotalCount = progress.Load()
+	reqContentB, err := json.Marshal(&reqContent)
+	if err != nil {
+		log.Println("[rmWrapper-Warning]Failed to marshal progress, err:", err.Error())
+		return
+	}
+
+	err = rc.Report(addr, client.ContentType, reqContentB)
+	if err != nil {
+		log.Println("[rmWrapper-Warning]Failed to report progress, err:", err.Error())
+		return
+	}
+	log.Println("[rmWrapper-Info]Report progress, removed:", reqContent.CurrentCount,
+		"found:", reqContent.TotalCount)
+}
+
+// runCleanup remove matched files in tree of dir, print result to stdout as json if not dry run.
+// Return exit code of the first failure.
+func runCleanup(path string, req filesystem.CleanupReq, plan *dryrun.Plan) int {
+	log.Println("[rmWrapper-Info]Start cleanup dir:", path)
+	result, err := filesystem.Cleanup(path, req)
+	if err != nil {
+		log.Println("[rmWrapper-Error]Failed to cleanup dir:", path, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	for _, failure := range result.Failures {
+		log.Println("[rmWrapper-Warning]Failed to cleanup path:", failure.Path, "and err:", failure.Err)
+	}
+	log.Println("[rmWrapper-Info]End cleanup dir:", path,
+		"scanned:", result.NumScanned,
+		"matched:", result.NumMatched,
+		"removed:", result.NumRemoved,
+		"removedDir:", result.NumRemovedDir,
+		"removedSize:", result.SizeRemoved,
+		"failed:", len(result.Failures))
+
+	if !plan.IsEnable() {
+		if result.Failures == nil {
+			result.Failures = []filesystem.CleanupFailure{}
+		}
+
+		content, err := json.Marshal(&result)
+		if err != nil {
+			log.Println("[rmWrapper-Error]Failed to marshal cleanup result, err:", err.Error())
+			return exit_code.ErrSystem
+		}
+		_, _ = os.Stdout.Write(append(content, '\n'))
+	}
+
+	return exit_code.ExitCodeConvertWithErr(result.Err())
+}
+
+// splitPattern split patterns by comma, empty patterns are dropped.
+func splitPattern(patterns string) []string {
+	var patternList []string
+	for _, pattern := range strings.Split(patterns, patternSeparator) {
+		if len(pattern) != 0 {
+			patternList = append(patternList, pattern)
+		}
+	}
+	return patternList
+}
@@ -1,24 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"flag"
+	"io"
 	"io/fs"
 	"log"
 	"os"
-	"time"
+	"strconv"
+	"strings"
+	"sync"
 
 	"transporter/pkg/exit_code"
 	"transporter/pkg/filesystem"
 )
 
 const (
-	emptyValue       = "empty"
-	typeFile         = "file"
-	typeDir          = "dir"
-	typeAll          = "all"
-	waitNFSCliUpdate = 5
-	waitNFSCcliLimit = 5
+	emptyValue = "empty"
+	typeFile   = "file"
+	typeDir    = "dir"
+	typeAll    = "all"
+
+	delimLF            = '\n'
+	delimCRStr         = "\r"
+	seq                = ","
+	recordDirtyStr     = `"`
+	permFileDefault    = 0775
+	concurrencyDefault = 16
 )
 
 func main() {
@@ -38,11 +48,88 @@ func main() {
 		typeAll,
 		"stat type: file,dir,all")
 
+	inputRecordFile := flag.String(
+		"record-file-in",
+		"",
+		"batch mode, input record file path relative mount point, one path relative mount point per line, "+
+			"path is quoted like copylist record(\"path\" or \"src\",\"dest\", the first path is used) or not")
+
+	outputRecordFile := flag.String(
+		"record-file-out",
+		"",
+		"batch mode, output record file path relative mount point, one result per line with same order as input: "+
+			"\"path\",type,size,errno, errno is exit code of single stat of the path")
+
+	concurrency := flag.Int(
+		"concurrency",
+		concurrencyDefault,
+		"num of paths that stat concurrently at batch mode")
+
+	isJSON := flag.Bool(
+		"json",
+		false,
+		"print metadata of exist path to stdout as json: size, mode, owner, times, inode, nlink, symlink target, xattrs and acl")
+
+	isSummary := flag.Bool(
+		"summary",
+		false,
+		"add summary of all entries beneath dir to json: file count, dir count, total bytes and largest files, imply json")
+
+	summaryWorkers := flag.Int(
+		"summary-workers",
+		0,
+		"num of goroutines that walk dir for summary, 0 means default")
+
+	summaryTop := flag.Int(
+		"summary-top",
+		10,
+		"num of the largest files at summary")
+
 	isDebug := flag.Bool(
 		"debug",
 		false,
 		"enable debug mode")
 
+	mountSource := flag.String(
+		"mount-source",
+		"",
+		"expected source of mount point, example: 10.0.0.1:/export, empty means not check")
+
+	mountOptions := flag.String(
+		"mount-options",
+		"",
+		"expected options of mount point, example: rw,hard, empty means not check")
+
+	nfsWaitInterval := flag.Int(
+		"nfs-wait-interval",
+		-1,
+		"second to wait NFS client cache update between stat of not exist path, negative means default of command")
+
+	nfsWaitAttempts := flag.Int(
+		"nfs-wait-attempts",
+		-1,
+		"max number of stat of not exist path, negative means default of command")
+
+	nfsCacheBust := flag.String(
+		"nfs-cache-bust",
+		"",
+		"bust NFS client cache of parent dir before stat, none, open-parent or list-parent, empty means default of command")
+
+	fsConfig := flag.String(
+		"fs-config",
+		"",
+		"absolute path of filesystem type policy file(json), example: {\"allow\": [\"nfs\", \"ceph\"], \"deny\": [\"tmpfs\"]}")
+
+	fsAllow := flag.String(
+		"fs-allow",
+		"",
+		"allowed filesystem type of mount point, name or magic number, example: nfs,lustre,ceph,0x2fc12fc1, override env "+filesystem.EnvFSTypeAllow+" and fs-config")
+
+	fsDeny := flag.String(
+		"fs-deny",
+		"",
+		"denied filesystem type of mount point, same format as fs-allow, override env "+filesystem.EnvFSTypeDeny+" and fs-config")
+
 	flag.Parse()
 
 	// set output of standard logger to stderr
@@ -50,7 +137,22 @@ func main() {
 	log.Println("[statWrapper-Info]New stat request, relativePath:", *relativePath,
 		"mountPath:", *mountPath,
 		"type:", *typeStat,
+		"inputRecordFile:", *inputRecordFile,
+		"outputRecordFile:", *outputRecordFile,
+		"concurrency:", *concurrency,
+		"isJSON:", *isJSON,
+		"isSummary:", *isSummary,
+		"summaryWorkers:", *summaryWorkers,
+		"summaryTop:", *summaryTop,
 		"isDebug:", *isDebug,
+		"mountSource:", *mountSource,
+		"mountOptions:", *mountOptions,
+		"nfsWaitInterval(second):", *nfsWaitInterval,
+		"nfsWaitAttempts:", *nfsWaitAttempts,
+		"nfsCacheBust:", *nfsCacheBust,
+		"fsConfig:", *fsConfig,
+		"fsAllow:", *fsAllow,
+		"fsDeny:", *fsDeny,
 	)
 	log.Println("[statWrapper-Info]Start check")
 
@@ -68,34 +170,81 @@ func main() {
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
 
-	if *relativePath == emptyValue {
-		log.Println("[statWrapper-Error]Unavailable format of relative path:", *relativePath)
-		os.Exit(exit_code.ErrInvalidArgument)
-	}
+	// batch mode stat paths at input record file, not need relative path
+	isBatch := len(*inputRecordFile) != 0 || len(*outputRecordFile) != 0
+	var inRecordFilePath, outRecordFilePath string
+	if isBatch {
+		inRecordFilePath, err = filesystem.AbsolutePath(*mountPath, *inputRecordFile)
+		if err != nil || !filesystem.CheckFilePathFormat(inRecordFilePath) {
+			log.Println("[statWrapper-Error]Unavailable format of input record file:", *inputRecordFile)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 
-	path, err = filesystem.AbsolutePath(*mountPath, *relativePath)
-	if err != nil {
-		log.Println("[statWrapper-Error]Unavailable format of mount point:", *mountPath,
-			"or relative path:", *relativePath)
-		os.Exit(exit_code.ErrInvalidArgument)
-	}
+		outRecordFilePath, err = filesystem.AbsolutePath(*mountPath, *outputRecordFile)
+		if err != nil || !filesystem.CheckFilePathFormat(outRecordFilePath) {
+			log.Println("[statWrapper-Error]Unavailable format of output record file:", *outputRecordFile)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 
-	switch *typeStat {
-	case typeFile:
-		isPathAvailable = filesystem.CheckFilePathFormat(path)
-	case typeDir, typeAll:
-		isPathAvailable = filesystem.CheckDirPathFormat(path)
+		if *concurrency <= 0 {
+			log.Println("[statWrapper-Error]Unavailable concurrency:", *concurrency)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
 
-	default:
-		log.Println("[statWrapper-Error]Unsupport stat type:", *typeStat, "with path:", path)
+		switch *typeStat {
+		case typeFile, typeDir, typeAll:
+		default:
+			log.Println("[statWrapper-Error]Unsupport stat type:", *typeStat)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	} else {
+		if *relativePath == emptyValue {
+			log.Println("[statWrapper-Error]Unavailable format of relative path:", *relativePath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		path, err = filesystem.AbsolutePath(*mountPath, *relativePath)
+		if err != nil {
+			log.Println("[statWrapper-Error]Unavailable format of mount point:", *mountPath,
+				"or relative path:", *relativePath)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		switch *typeStat {
+		case typeFile:
+			isPathAvailable = filesystem.CheckFilePathFormat(path)
+		case typeDir, typeAll:
+			isPathAvailable = filesystem.CheckDirPathFormat(path)
+
+		default:
+			log.Println("[statWrapper-Error]Unsupport stat type:", *typeStat, "with path:", path)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+
+		if !isPathAvailable {
+			log.Println("[statWrapper-Error]Unavailable format of path:", path, "stat type:", *typeStat)
+			os.Exit(exit_code.ErrInvalidArgument)
+		}
+	}
+	log.Println("[statWrapper-Info]Check path format...OK")
+
+	waitPolicy, err := filesystem.NewQuickWaitPolicy().Override(*nfsWaitInterval, *nfsWaitAttempts, *nfsCacheBust)
+	if err != nil {
+		log.Println("[statWrapper-Error]Unavailable NFS wait policy, err:", err.Error())
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
+	log.Println("[statWrapper-Info]NFS wait policy, interval:", waitPolicy.Interval.String(),
+		"attempts:", waitPolicy.Attempts,
+		"cache bust:", waitPolicy.CacheBust)
 
-	if !isPathAvailable {
-		log.Println("[statWrapper-Error]Unavailable format of path:", path, "stat type:", *typeStat)
+	log.Println("[statWrapper-Info]Start load filesystem type policy")
+	err = filesystem.LoadFSTypePolicy(*fsConfig, *fsAllow, *fsDeny)
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to load filesystem type policy, err:", err.Error())
 		os.Exit(exit_code.ErrInvalidArgument)
 	}
-	log.Println("[statWrapper-Info]Check path format...OK")
+	fsAllowList, fsDenyList := filesystem.EffectiveFSTypePolicy()
+	log.Println("[statWrapper-Info]Load filesystem type policy...OK, allow:", fsAllowList, "deny:", fsDenyList)
 
 	if !(*isDebug) {
 		log.Println("[statWrapper-Info]Start check mount filesystem")
@@ -106,67 +255,332 @@ func main() {
 			os.Exit(exitCode)
 		}
 		log.Println("[statWrapper-Info]Check mount filesystem...OK")
+
+		log.Println("[statWrapper-Info]Start verify mount point")
+		err = filesystem.VerifyMountPoint(*mountPath, filesystem.ParseMountExpect(*mountSource, *mountOptions))
+		if err != nil {
+			log.Println("[statWrapper-Error]Failed to verify mount point:", *mountPath,
+				"and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
+		log.Println("[statWrapper-Info]Verify mount point...OK")
+	}
+
+	log.Println("[statWrapper-Info]Start check path is beneath mount point")
+	checkList := []string{*relativePath}
+	if isBatch {
+		// paths at input record file are checked one by one
+		checkList = []string{*inputRecordFile, *outputRecordFile}
+	}
+	for _, checkPath := range checkList {
+		err = filesystem.CheckPathBeneath(*mountPath, checkPath)
+		if err != nil {
+			log.Println("[statWrapper-Error]Failed to check path:", checkPath,
+				"is beneath mount point:", *mountPath, "and err:", err.Error())
+			exitCode = exit_code.ExitCodeConvertWithErr(err)
+			os.Exit(exitCode)
+		}
 	}
+	log.Println("[statWrapper-Info]Check path is beneath mount point...OK")
 
 	log.Println("[statWrapper-Info]End check")
 
+	if isBatch {
+		exitCode = runBatchStat(*mountPath, inRecordFilePath, outRecordFilePath, *typeStat, waitPolicy, *concurrency)
+		os.Exit(exitCode)
+	}
+
 	var (
 		pInfo    os.FileInfo
 		retryNum int
 	)
 	log.Println("[statWrapper-Info]Start stat path:", path)
-	for {
-		if retryNum >= waitNFSCcliLimit {
+	pInfo, retryNum, err = waitPolicy.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			log.Println("[statWrapper-Info]Stat path:", path,
 				"is not exist, retry stat num:", retryNum)
 			log.Println("[statWrapper-Info]Path that stat is not exist, exit with 2 (No such file or directory)")
 			os.Exit(exit_code.ErrNoSuchFileOrDir)
 		}
 
-		pInfo, err = os.Stat(path)
-		if err == nil {
-			isPathDir := pInfo.IsDir()
-			switch *typeStat {
-			case typeFile:
-				if isPathDir {
-					log.Println("[statWrapper-Error]Stat file:", path,
-						"is exist but is dir, retry stat num:", retryNum)
-					log.Println("[statWrapper-Error]Path that stat is exist but is dir, exit with 21")
-					os.Exit(exit_code.ErrIsDirectory)
-				}
-				log.Println("[statWrapper-Info]Stat file:", path,
-					"is exist and is file, retry stat num:", retryNum)
-				log.Println("[statWrapper-Info]Path that stat is exist and is file, exit with 0")
-				os.Exit(exit_code.Succeed)
-
-			case typeDir:
-				if isPathDir {
-					log.Println("[statWrapper-Info]Stat dir:", path,
-						"is exist and is dir, retry stat num:", retryNum)
-					log.Println("[statWrapper-Info]Path that stat is exist and is dir, exit with 0")
-					os.Exit(exit_code.Succeed)
-				}
-				log.Println("[statWrapper-Error]Stat dir:", path,
-					"is exist but is file, retry stat num:", retryNum)
-				log.Println("[statWrapper-Error]Path that stat is exist but is file, exit with 20")
-				os.Exit(exit_code.ErrNotDirectory)
-
-			default:
-				log.Println("[statWrapper-Info]Stat path:", path,
-					"is exist, retry stat num:", retryNum)
-				log.Println("[statWrapper-Info]Path that stat is exist, exit with 0")
-				os.Exit(exit_code.Succeed)
+		log.Println("[statWrapper-Error]Failed to stat path:", path, "and err:", err.Error())
+		exitCode = exit_code.ExitCodeConvertWithErr(err)
+		os.Exit(exitCode)
+	}
+
+	isPathDir := pInfo.IsDir()
+	if *isJSON || *isSummary {
+		exitCode = printStat(path, *isSummary && isPathDir, *summaryWorkers, *summaryTop)
+		if exitCode != exit_code.Succeed {
+			os.Exit(exitCode)
+		}
+	}
+
+	switch *typeStat {
+	case typeFile:
+		if isPathDir {
+			log.Println("[statWrapper-Error]Stat file:", path,
+				"is exist but is dir, retry stat num:", retryNum)
+			log.Println("[statWrapper-Error]Path that stat is exist but is dir, exit with 21")
+			os.Exit(exit_code.ErrIsDirectory)
+		}
+		log.Println("[statWrapper-Info]Stat file:", path,
+			"is exist and is file, retry stat num:", retryNum)
+		log.Println("[statWrapper-Info]Path that stat is exist and is file, exit with 0")
+		os.Exit(exit_code.Succeed)
+
+	case typeDir:
+		if isPathDir {
+			log.Println("[statWrapper-Info]Stat dir:", path,
+				"is exist and is dir, retry stat num:", retryNum)
+			log.Println("[statWrapper-Info]Path that stat is exist and is dir, exit with 0")
+			os.Exit(exit_code.Succeed)
+		}
+		log.Println("[statWrapper-Error]Stat dir:", path,
+			"is exist but is file, retry stat num:", retryNum)
+		log.Println("[statWrapper-Error]Path that stat is exist but is file, exit with 20")
+		os.Exit(exit_code.ErrNotDirectory)
+
+	default:
+		log.Println("[statWrapper-Info]Stat path:", path,
+			"is exist, retry stat num:", retryNum)
+		log.Println("[statWrapper-Info]Path that stat is exist, exit with 0")
+		os.Exit(exit_code.Succeed)
+	}
+}
+
+// statResult is metadata of path that printed to stdout, summary is only for dir.
+type statResult struct {
+	filesystem.Metadata
+	Summary *filesystem.DirSummary `json:"summary,omitempty"`
+}
+
+// printStat print metadata of path to stdout as json, return exit code.
+func printStat(path string, isSummary bool, summaryWorkers, summaryTop int) int {
+	var (
+		result statResult
+		err    error
+	)
+	result.Metadata, err = filesystem.GetMetadata(path)
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to get metadata of path:", path, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	if isSummary {
+		log.Println("[statWrapper-Info]Start summary dir:", path)
+		summary, err := filesystem.SummarizeDir(path, summaryWorkers, summaryTop)
+		if err != nil {
+			log.Println("[statWrapper-Error]Failed to summary dir:", path, "and err:", err.Error())
+			return exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		if summary.NumFailed != 0 {
+			log.Println("[statWrapper-Warning]Failed to read", summary.NumFailed, "entries of dir:", path)
+		}
+		log.Println("[statWrapper-Info]End summary dir:", path,
+			"files:", summary.NumFile,
+			"dirs:", summary.NumDir,
+			"others:", summary.NumOther,
+			"totalSize:", summary.TotalSize)
+		result.Summary = &summary
+	}
+
+	content, err := json.Marshal(&result)
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to marshal metadata, err:", err.Error())
+		return exit_code.ErrSystem
+	}
+
+	_, _ = os.Stdout.Write(append(content, '\n'))
+	return exit_code.Succeed
+}
+
+// statRecord is result of a path at batch stat.
+type statRecord struct {
+	dirtyPath string // quoted path
+	pathType  string // file, dir, symlink or other, empty if path is not exist or failed to stat
+	size      int64
+	exitCode  int // same as exit code of single stat of the path
+}
+
+// runBatchStat stat paths at input record file concurrently, write results to output record file
+// with same order as input. Return ErrCopylistPartial if any path is not succeed.
+func runBatchStat(mountPath, inRecordFilePath, outRecordFilePath, typeStat string,
+	waitPolicy filesystem.WaitPolicy, concurrency int) int {
+	log.Println("[statWrapper-Info]Start read input record file:", inRecordFilePath)
+	relativePathList, err := readStatRecords(inRecordFilePath)
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to read input record file:", inRecordFilePath, "and err:", err.Error())
+		if errors.Is(err, fs.ErrInvalid) {
+			return exit_code.ErrInvalidListFile
+		}
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+	log.Println("[statWrapper-Info]Read input record file...OK, num of records:", len(relativePathList))
+
+	var (
+		recordList = make([]statRecord, len(relativePathList))
+		indexCh    = make(chan int)
+		wg         sync.WaitGroup
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexCh {
+				recordList[index] = statOne(mountPath, relativePathList[index], typeStat, waitPolicy)
 			}
+		}()
+	}
+	for i := range relativePathList {
+		indexCh <- i
+	}
+	close(indexCh)
+	wg.Wait()
 
+	outputF, err := os.OpenFile(outRecordFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, permFileDefault)
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to open output record file:", outRecordFilePath, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	var (
+		numErrRecord  int
+		recordBuilder strings.Builder
+	)
+	outputWriter := bufio.NewWriter(outputF)
+	for _, record := range recordList {
+		if record.exitCode != exit_code.Succeed {
+			numErrRecord++
 		}
 
-		if !errors.Is(err, fs.ErrNotExist) {
-			log.Println("[statWrapper-Error]Failed to stat path:", path, "and err:", err.Error())
-			exitCode = exit_code.ExitCodeConvertWithErr(err)
-			os.Exit(exitCode)
+		recordBuilder.Reset()
+		recordBuilder.WriteString(record.dirtyPath)
+		recordBuilder.WriteString(seq)
+		recordBuilder.WriteString(record.pathType)
+		recordBuilder.WriteString(seq)
+		recordBuilder.WriteString(strconv.FormatInt(record.size, 10))
+		recordBuilder.WriteString(seq)
+		recordBuilder.WriteString(strconv.Itoa(record.exitCode))
+		recordBuilder.WriteString("\n")
+		_, _ = outputWriter.WriteString(recordBuilder.String())
+	}
+
+	err = outputWriter.Flush()
+	if err == nil {
+		err = outputF.Sync()
+	}
+	closeErr := outputF.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Println("[statWrapper-Error]Failed to write output record file:", outRecordFilePath, "and err:", err.Error())
+		return exit_code.ExitCodeConvertWithErr(err)
+	}
+
+	log.Println("[statWrapper-Info]End batch stat, num of records:", len(recordList),
+		"num of not succeed records:", numErrRecord)
+	if numErrRecord != 0 {
+		return exit_code.ErrCopylistPartial
+	}
+	return exit_code.Succeed
+}
+
+// readStatRecords return relative paths at input record file, empty line is skipped.
+// Path is quoted like copylist record or not, the first path is used if a line has more than one quoted path.
+func readStatRecords(inRecordFilePath string) ([]string, error) {
+	inputF, err := os.Open(inRecordFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer inputF.Close()
+
+	var (
+		line             string
+		relativePathList []string
+	)
+	inputReader := bufio.NewReader(inputF)
+	for {
+		line, err = inputReader.ReadString(delimLF)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		isEOF := err != nil
+
+		line = strings.TrimSuffix(line, string(delimLF))
+		if strings.Contains(line, delimCRStr) {
+			log.Println("[statWrapper-Error]Use unsupport delim: CR or CRLF")
+			return nil, fs.ErrInvalid
+		}
+
+		if len(line) != 0 {
+			if strings.HasPrefix(line, recordDirtyStr) {
+				lastIndex := strings.Index(line[1:], recordDirtyStr)
+				if lastIndex < 0 {
+					log.Println("[statWrapper-Error]Unavailable record: >>", line, "<<")
+					return nil, fs.ErrInvalid
+				}
+				line = line[1 : lastIndex+1]
+			}
+			relativePathList = append(relativePathList, line)
 		}
 
-		time.Sleep(waitNFSCliUpdate * time.Second)
-		retryNum += 1
+		if isEOF {
+			break
+		}
+	}
+
+	if len(relativePathList) == 0 {
+		log.Println("[statWrapper-Error]Empty input record file")
+		return nil, fs.ErrInvalid
+	}
+	return relativePathList, nil
+}
+
+// statOne stat a path relative mount point with same checks as single stat.
+func statOne(mountPath, relativePath, typeStat string, waitPolicy filesystem.WaitPolicy) statRecord {
+	record := statRecord{dirtyPath: recordDirtyStr + relativePath + recordDirtyStr}
+
+	path, err := filesystem.AbsolutePath(mountPath, relativePath)
+	if err != nil {
+		record.exitCode = exit_code.ErrInvalidArgument
+		return record
+	}
+
+	err = filesystem.CheckPathBeneath(mountPath, relativePath)
+	if err != nil {
+		log.Println("[statWrapper-Warning]Failed to check path:", relativePath,
+			"is beneath mount point:", mountPath, "and err:", err.Error())
+		record.exitCode = exit_code.ExitCodeConvertWithErr(err)
+		return record
+	}
+
+	pInfo, retryNum, err := waitPolicy.Stat(path)
+	if err != nil {
+		log.Println("[statWrapper-Warning]Failed to stat path:", path, "retry stat num:", retryNum,
+			"and err:", err.Error())
+		record.exitCode = exit_code.ExitCodeConvertWithErr(err)
+		return record
+	}
+
+	record.size = pInfo.Size()
+	switch {
+	case pInfo.IsDir():
+		record.pathType = filesystem.TypeDir
+	case pInfo.Mode().IsRegular():
+		record.pathType = filesystem.TypeFile
+	default:
+		record.pathType = filesystem.TypeOther
+	}
+
+	if typeStat == typeFile && pInfo.IsDir() {
+		record.exitCode = exit_code.ErrIsDirectory
+	} else if typeStat == typeDir && !pInfo.IsDir() {
+		record.exitCode = exit_code.ErrNotDirectory
 	}
+	return record
 }
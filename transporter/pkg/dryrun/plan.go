@@ -0,0 +1,120 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// Operation of planned action
+const (
+	OpCreateDir  = "create-dir"
+	OpCreateFile = "create-file"
+	OpSymlink    = "symlink"
+	OpHardlink   = "hardlink"
+	OpChmod      = "chmod"
+	OpChown      = "chown"
+	OpAllocate   = "allocate" // preallocate size of file by fallocate
+	OpCopy       = "copy"
+	OpChecksum   = "checksum"
+	OpRename     = "rename"
+	OpMove       = "move" // copy to dest, verify and remove src, it is used if src and dest are at different filesystem
+	OpTruncate   = "truncate"
+	OpBackup     = "backup"
+	OpRemove     = "remove"
+	OpTrash      = "trash"
+	OpRestore    = "restore"
+	OpSkip       = "skip"
+	OpFail       = "fail"
+)
+
+// Action is a change that the real run would make.
+type Action struct {
+	Op       string `json:"op"`
+	Path     string `json:"path"`
+	Dest     string `json:"dest,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"` // exit code of failed action, only for action of record file
+}
+
+// Plan is the preview of a mutating command, it is printed to stdout as json and nothing is changed.
+type Plan struct {
+	Command  string   `json:"command"`
+	Actions  []Action `json:"actions"`
+	Itemize  []string `json:"itemize,omitempty"` // itemized changes of rsync dry run, only for dir copy
+	ExitCode int      `json:"exit_code"`         // exit code that the real run would produce
+}
+
+// New return empty plan of command, nil plan means dry run is disable, all methods of nil plan do nothing.
+func New(command string, isDryRun bool) *Plan {
+	if !isDryRun {
+		return nil
+	}
+
+	log.Println("[dryRun-Info]Dry run of", command, "is enable, nothing is changed")
+	return &Plan{
+		Command: command,
+		Actions: []Action{},
+	}
+}
+
+// IsEnable return true if dry run is enable.
+func (p *Plan) IsEnable() bool {
+	return p != nil
+}
+
+// Add append action to plan.
+func (p *Plan) Add(op, path, dest, reason string) {
+	if p == nil {
+		return
+	}
+
+	p.Actions = append(p.Actions, Action{
+		Op:     op,
+		Path:   path,
+		Dest:   dest,
+		Reason: reason,
+	})
+	log.Println("[dryRun-Info]Plan to", op, "path:", path, "dest:", dest, "reason:", reason)
+}
+
+// AddFail append action that the real run would fail with exit code, but the run continue,
+// like failed record of copylist.
+func (p *Plan) AddFail(path, dest string, exitCode int) {
+	if p == nil {
+		return
+	}
+
+	p.Actions = append(p.Actions, Action{
+		Op:       OpFail,
+		Path:     path,
+		Dest:     dest,
+		ExitCode: exitCode,
+	})
+	log.Println("[dryRun-Info]Plan to fail path:", path, "dest:", dest, "exit code:", exitCode)
+}
+
+// ExitFail add path that the real run would fail at to plan, then exit like Exit.
+func (p *Plan) ExitFail(path, dest string, exitCode int) {
+	p.AddFail(path, dest, exitCode)
+	p.Exit(exitCode)
+}
+
+// Exit print plan to stdout and exit with exit code that the real run would produce,
+// exit directly if dry run is disable.
+func (p *Plan) Exit(exitCode int) {
+	if p == nil {
+		os.Exit(exitCode)
+	}
+
+	p.ExitCode = exitCode
+	content, err := json.Marshal(p)
+	if err != nil {
+		log.Println("[dryRun-Error]Failed to marshal plan, err:", err.Error())
+	} else {
+		_, _ = os.Stdout.Write(append(content, '\n'))
+	}
+
+	log.Println("[dryRun-Info]Dry run end, actions num:", len(p.Actions), "exit code:", exitCode)
+	os.Exit(exitCode)
+}
@@ -54,7 +54,17 @@ const (
 	ErrSrcAndDstAreSameFile  = 203
 	ErrDirectoryNestedItself = 204
 	ErrInvalidListFile       = 205
+	ErrRunTimeout            = 206
 	ErrRetryLimit            = 208
+	ErrNotMountPoint         = 209
+	ErrMountReplaced         = 210
+	ErrMountOptionMismatch   = 211
+	ErrPathEscape            = 212
+	ErrACLUnsupported        = 213 // dest filesystem is not able to preserve acls
+	ErrXattrUnsupported      = 214 // dest filesystem is not able to preserve xattrs
+	ErrOwnerNotPermitted     = 215 // not permitted to preserve owner or group at dest
+	ErrAttrUnsupported       = 216 // dest filesystem is not able to preserve other attributes, like: times, devices
+	ErrDeleteLimit           = 217 // deletions of mirror exceed max delete
 	ErrCopylistPartial       = 252
 	ErrCopyFileSucceed       = 254
 	ErrSystem                = 255
@@ -69,6 +79,9 @@ const (
 	ErrMsgReportAddr      = "report addr is unavailable"
 	ErrMsgMaxLimitRetry   = "retry limit has been reached, but still get an error(can be recovered)"
 	ErrMsgUnrecoverable   = "return a unrecoverable error"
+	ErrMsgRunTimeout      = "deadline of run has been reached, stop retry"
+	ErrMsgVanishedLimit   = "retry limit of vanished file has been reached, but still get file vanished"
+	ErrMsgRetryDuration   = "max duration of retry has been reached, stop retry"
 )
 
 // error code of api
@@ -123,7 +136,17 @@ const (
 	SrcAndDstAreSameFile  = 1403
 	DirectoryNestedItself = 1404
 	InvalidListFile       = 1405
+	RunTimeout            = 1406
 	RetryLimit            = 1408
+	NotMountPoint         = 1409
+	MountReplaced         = 1410
+	MountOptionMismatch   = 1411
+	PathEscape            = 1412
+	ACLUnsupported        = 1413
+	XattrUnsupported      = 1414
+	OwnerNotPermitted     = 1415
+	AttrUnsupported       = 1416
+	DeleteLimit           = 1417
 )
 
 func ExitCodeConvertWithErr(err error) int {
@@ -151,6 +174,22 @@ func ExitCodeConvertWithErr(err error) int {
 		return ErrUnknownFSType
 	}
 
+	if errors.Is(err, filesystem.ErrNotMountPoint) {
+		return ErrNotMountPoint
+	}
+
+	if errors.Is(err, filesystem.ErrMountReplaced) {
+		return ErrMountReplaced
+	}
+
+	if errors.Is(err, filesystem.ErrMountOptionMismatch) {
+		return ErrMountOptionMismatch
+	}
+
+	if errors.Is(err, filesystem.ErrPathEscape) {
+		return ErrPathEscape
+	}
+
 	if errors.Is(err, checksum.ErrNotEqual) {
 		return ErrChecksumRefuse
 	}
@@ -0,0 +1,239 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Time of file that age is compared by
+const (
+	AgeByMtime = "mtime"
+	AgeByAtime = "atime"
+)
+
+var (
+	ErrCleanupPattern = errors.New("unavailable glob pattern of cleanup")
+	ErrCleanupAgeBy   = errors.New("unavailable age of cleanup, must be mtime or atime")
+)
+
+// CleanupReq is request of removing matched files in a tree.
+// Pattern without slash is matched with name of file at any depth,
+// pattern with slash is matched with path relative to root, like: logs/*.log.
+type CleanupReq struct {
+	IncludeList      []string                // file is removed only if it match one of patterns, empty means all files
+	ExcludeList      []string                // file or dir is kept if it match one of patterns, children of excluded dir are kept
+	MinAge           time.Duration           // file is removed only if it is older than it, 0 means no limit
+	AgeBy            string                  // mtime or atime, empty means mtime
+	MinSize          int64                   // file is removed only if size is not less than it, 0 means no limit
+	IsRemoveEmptyDir bool                    // remove dirs that become empty after cleanup, dirs that already empty are kept, root is kept
+	Skip             func(path string) bool  // path and its children are kept if it return true, like trash dir
+	Remove           func(path string) error // remove file or empty dir, nil means os.Remove
+	Now              time.Time               // time that age is compared with, zero means now
+}
+
+// CleanupFailure is a path failed to remove.
+type CleanupFailure struct {
+	Path string `json:"path"`
+	Err  string `json:"err"`
+}
+
+// CleanupResult is counts of cleanup and failures.
+type CleanupResult struct {
+	NumScanned    int              `json:"num_scanned"`     // num of files that scanned
+	NumMatched    int              `json:"num_matched"`     // num of files that match all conditions
+	NumRemoved    int              `json:"num_removed"`     // num of files that removed
+	NumRemovedDir int              `json:"num_removed_dir"` // num of empty dirs that removed
+	SizeRemoved   int64            `json:"size_removed"`    // bytes of removed files
+	Failures      []CleanupFailure `json:"failures"`
+	firstErr      error
+}
+
+// Err return the first err of failures, nil if no failure.
+func (r CleanupResult) Err() error {
+	return r.firstErr
+}
+
+func (r *CleanupResult) addFailure(path string, err error) {
+	if r.firstErr == nil {
+		r.firstErr = err
+	}
+	r.Failures = append(r.Failures, CleanupFailure{Path: path, Err: err.Error()})
+}
+
+// CheckCleanupReq check patterns and age of request.
+func CheckCleanupReq(req CleanupReq) error {
+	for _, pattern := range append(append([]string{}, req.IncludeList...), req.ExcludeList...) {
+		_, err := filepath.Match(pattern, "")
+		if err != nil || len(pattern) == 0 {
+			return ErrCleanupPattern
+		}
+	}
+
+	switch req.AgeBy {
+	case "", AgeByMtime, AgeByAtime:
+	default:
+		return ErrCleanupAgeBy
+	}
+
+	return nil
+}
+
+// Cleanup remove files that match request in tree of root, root must be dir.
+// Entries failed to remove are added to failures of result and others are continued,
+// err is returned only if root is not able to be walked.
+func Cleanup(root string, req CleanupReq) (CleanupResult, error) {
+	var result CleanupResult
+	err := CheckCleanupReq(req)
+	if err != nil {
+		return result, err
+	}
+
+	if req.Remove == nil {
+		req.Remove = os.Remove
+	}
+	if req.Now.IsZero() {
+		req.Now = time.Now()
+	}
+
+	root = filepath.Clean(root)
+	rootInfo, err := os.Lstat(root)
+	if err != nil {
+		return result, err
+	}
+	if !rootInfo.IsDir() {
+		return result, &os.PathError{Op: "cleanup", Path: root, Err: unix.ENOTDIR}
+	}
+
+	var (
+		// num of entries that are kept at dir, dir is empty if it is 0 after cleanup
+		numKept = map[string]int{}
+		// num of entries that are removed from dir, dir becomes empty by cleanup only if it is not 0
+		numRemoved = map[string]int{}
+		dirList    []string
+	)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if path == root {
+			return err
+		}
+
+		parent := filepath.Dir(path)
+		numKept[parent]++
+		if err != nil {
+			result.addFailure(path, err)
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			result.addFailure(path, err)
+			return nil
+		}
+
+		if (req.Skip != nil && req.Skip(path)) || matchAny(req.ExcludeList, relativePath, d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			dirList = append(dirList, path)
+			return nil
+		}
+
+		result.NumScanned++
+		if len(req.IncludeList) != 0 && !matchAny(req.IncludeList, relativePath, d.Name()) {
+			return nil
+		}
+
+		var st unix.Stat_t
+		err = unix.Lstat(path, &st)
+		if err != nil {
+			if err != unix.ENOENT {
+				result.addFailure(path, &os.PathError{Op: "lstat", Path: path, Err: err})
+			}
+			return nil
+		}
+
+		if st.Size < req.MinSize || !isOlder(&st, req) {
+			return nil
+		}
+
+		result.NumMatched++
+		err = req.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			result.addFailure(path, err)
+			return nil
+		}
+
+		numKept[parent]--
+		numRemoved[parent]++
+		result.NumRemoved++
+		result.SizeRemoved += st.Size
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if !req.IsRemoveEmptyDir {
+		return result, nil
+	}
+
+	// children are walked after parent, so remove dirs in reverse order
+	for i := len(dirList) - 1; i >= 0; i-- {
+		path := dirList[i]
+		if numKept[path] != 0 || numRemoved[path] == 0 {
+			continue
+		}
+
+		err = req.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			result.addFailure(path, err)
+			continue
+		}
+
+		numKept[filepath.Dir(path)]--
+		numRemoved[filepath.Dir(path)]++
+		result.NumRemovedDir++
+	}
+
+	return result, nil
+}
+
+// matchAny return true if relative path or name match one of patterns.
+func matchAny(patternList []string, relativePath, name string) bool {
+	var isMatch bool
+	for _, pattern := range patternList {
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			isMatch, _ = filepath.Match(pattern, relativePath)
+		} else {
+			isMatch, _ = filepath.Match(pattern, name)
+		}
+
+		if isMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// isOlder return true if mtime or atime of file is older than min age.
+func isOlder(st *unix.Stat_t, req CleanupReq) bool {
+	if req.MinAge <= 0 {
+		return true
+	}
+
+	ts := st.Mtim
+	if req.AgeBy == AgeByAtime {
+		ts = st.Atim
+	}
+
+	return req.Now.Sub(time.Unix(ts.Unix())) >= req.MinAge
+}
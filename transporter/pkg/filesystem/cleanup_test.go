@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanup(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for path, size := range map[string]int{
+		"a.log":            10,
+		"keep.txt":         10,
+		"logs/b.log":       10,
+		"logs/small.log":   1,
+		"logs/new.log":     10,
+		"logs/deep/c.log":  10,
+		"cache/d.log":      10,
+		"cache/keep/e.log": 10,
+	} {
+		path = filepath.Join(root, path)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		_ = os.WriteFile(path, make([]byte, size), 0644)
+		if filepath.Base(path) != "new.log" {
+			_ = os.Chtimes(path, old, old)
+		}
+	}
+
+	// already empty dir is not removed by cleanup
+	_ = os.MkdirAll(filepath.Join(root, "empty"), 0755)
+
+	_, err := Cleanup(root, CleanupReq{IncludeList: []string{"[a-"}})
+	if !errors.Is(err, ErrCleanupPattern) {
+		t.Error("expect err of pattern, but get:", err)
+	}
+
+	result, err := Cleanup(root, CleanupReq{
+		IncludeList:      []string{"*.log"},
+		ExcludeList:      []string{"cache/keep"},
+		MinAge:           24 * time.Hour,
+		MinSize:          5,
+		IsRemoveEmptyDir: true,
+	})
+	if err != nil {
+		t.Fatal("failed to cleanup:", err)
+	}
+
+	if result.NumRemoved != 4 || result.SizeRemoved != 40 || result.NumRemovedDir != 1 || len(result.Failures) != 0 {
+		t.Error("unexpected result:", result)
+	}
+
+	for _, path := range []string{"keep.txt", "logs/small.log", "logs/new.log", "cache/keep/e.log", "empty"} {
+		_, err = os.Lstat(filepath.Join(root, path))
+		if err != nil {
+			t.Error("path should be kept:", path, "and err:", err)
+		}
+	}
+
+	for _, path := range []string{"a.log", "logs/deep", "cache/d.log"} {
+		_, err = os.Lstat(filepath.Join(root, path))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error("path should be removed:", path, "and err:", err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	parentDir         = ".."
+	parentDirPrefix   = "../"
+	confineRetryLimit = 5
+	confineOpenFlag   = unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC
+)
+
+var ErrPathEscape = errors.New("path escapes the mount point")
+
+// CheckPathBeneath check path that relative mount point is beneath mount point
+// after resolve ".." and symlink, return ErrPathEscape if not.
+// Part of path that is not exist is checked only by lexical, because it can not be a symlink.
+func CheckPathBeneath(mountPoint, relativePath string) error {
+	rel := filepath.Clean(strings.TrimLeft(relativePath, slashStr))
+	if rel == parentDir || strings.HasPrefix(rel, parentDirPrefix) {
+		return fmt.Errorf("%w: %s of mount point: %s", ErrPathEscape, relativePath, mountPoint)
+	}
+
+	return checkBeneath(mountPoint, rel)
+}
+
+// CheckAbsPathBeneath check absolute path is beneath mount point like CheckPathBeneath.
+func CheckAbsPathBeneath(mountPoint, absPath string) error {
+	rel, err := filepath.Rel(mountPoint, absPath)
+	if err != nil || !filepath.IsAbs(absPath) {
+		return fmt.Errorf("%w: %s of mount point: %s", ErrPathEscape, absPath, mountPoint)
+	}
+
+	return CheckPathBeneath(mountPoint, rel)
+}
+
+// CheckLinkTargetBeneath check target of symlink at link path is beneath mount point like CheckAbsPathBeneath,
+// relative target is resolved against parent dir of link path.
+func CheckLinkTargetBeneath(mountPoint, linkPath, target string) error {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkPath), target)
+	}
+
+	return CheckAbsPathBeneath(mountPoint, target)
+}
+
+// OpenParentBeneath open parent dir of path that relative mount point with openat2 RESOLVE_BENEATH,
+// return fd of parent dir and name of path at it. Caller should operate path relative to fd, like: unlinkat,
+// so symlink swapped into path after check is not followed. Parent of mount point is opened if path is
+// mount point itself. Fallback to check with walk and open if openat2 is not supported by kernel.
+func OpenParentBeneath(mountPoint, relativePath string) (int, string, error) {
+	rel := filepath.Clean(strings.TrimLeft(relativePath, slashStr))
+	if rel == parentDir || strings.HasPrefix(rel, parentDirPrefix) {
+		return -1, "", fmt.Errorf("%w: %s of mount point: %s", ErrPathEscape, relativePath, mountPoint)
+	}
+
+	if rel == "." {
+		fd, err := unix.Open(filepath.Dir(filepath.Clean(mountPoint)), confineOpenFlag, 0)
+		if err != nil {
+			return -1, "", &os.PathError{Op: "open", Path: filepath.Dir(mountPoint), Err: err}
+		}
+		return fd, filepath.Base(filepath.Clean(mountPoint)), nil
+	}
+
+	rootFd, err := unix.Open(mountPoint, confineOpenFlag, 0)
+	if err != nil {
+		return -1, "", &os.PathError{Op: "open", Path: mountPoint, Err: err}
+	}
+	defer unix.Close(rootFd)
+
+	how := unix.OpenHow{
+		Flags:   confineOpenFlag,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+
+	parentRel := filepath.Dir(rel)
+	var fd, retryNum int
+	for {
+		fd, err = unix.Openat2(rootFd, parentRel, &how)
+		if err == nil {
+			return fd, filepath.Base(rel), nil
+		}
+
+		switch err {
+		case unix.EINTR:
+			continue
+		case unix.EAGAIN:
+			retryNum += 1
+			if retryNum < confineRetryLimit {
+				continue
+			}
+		case unix.ENOSYS:
+			return openParentWalk(mountPoint, rel)
+		case unix.EXDEV:
+			return -1, "", fmt.Errorf("%w: %s of mount point: %s", ErrPathEscape, rel, mountPoint)
+		}
+		return -1, "", &os.PathError{Op: "openat2", Path: parentRel, Err: err}
+	}
+}
+
+// openParentWalk check parent of rel with walk and open it, symlink swapped between check and open is
+// not able to be detected, it is only used by kernel that not support openat2.
+func openParentWalk(mountPoint, rel string) (int, string, error) {
+	parentRel := filepath.Dir(rel)
+	err := checkBeneathWalk(mountPoint, parentRel)
+	if err != nil {
+		return -1, "", err
+	}
+
+	parentPath := filepath.Join(mountPoint, parentRel)
+	fd, err := unix.Open(parentPath, confineOpenFlag, 0)
+	if err != nil {
+		return -1, "", &os.PathError{Op: "open", Path: parentPath, Err: err}
+	}
+	return fd, filepath.Base(rel), nil
+}
+
+// checkBeneath check the longest exist prefix of rel is beneath mount point with openat2 RESOLVE_BENEATH,
+// fallback to resolve symlink with walk if openat2 is not supported by kernel.
+func checkBeneath(mountPoint, rel string) error {
+	rootFd, err := unix.Open(mountPoint, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: mountPoint, Err: err}
+	}
+	defer unix.Close(rootFd)
+
+	how := unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS,
+	}
+
+	var (
+		fd       int
+		retryNum int
+	)
+	for {
+		fd, err = unix.Openat2(rootFd, rel, &how)
+		if err == nil {
+			unix.Close(fd)
+			return nil
+		}
+
+		switch err {
+		case unix.EINTR:
+			continue
+		case unix.EAGAIN:
+			// rename or mount happened during resolution
+			retryNum += 1
+			if retryNum < confineRetryLimit {
+				continue
+			}
+			return &os.PathError{Op: "openat2", Path: rel, Err: err}
+		case unix.ENOSYS:
+			return checkBeneathWalk(mountPoint, rel)
+		case unix.EXDEV:
+			return fmt.Errorf("%w: %s of mount point: %s", ErrPathEscape, rel, mountPoint)
+		case unix.ENOENT:
+			// check parent, the not exist part can not escape
+			if rel == "." {
+				return &os.PathError{Op: "openat2", Path: mountPoint, Err: err}
+			}
+			rel = filepath.Dir(rel)
+			retryNum = 0
+		default:
+			return &os.PathError{Op: "openat2", Path: rel, Err: err}
+		}
+	}
+}
+
+// checkBeneathWalk resolve symlink of the longest exist prefix of rel and check it is beneath mount point.
+func checkBeneathWalk(mountPoint, rel string) error {
+	root, err := filepath.EvalSymlinks(mountPoint)
+	if err != nil {
+		return err
+	}
+
+	var resolved string
+	for {
+		resolved, err = filepath.EvalSymlinks(filepath.Join(mountPoint, rel))
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, os.ErrNotExist) || rel == "." {
+			return err
+		}
+		rel = filepath.Dir(rel)
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, strings.TrimRight(root, slashStr)+slashStr) {
+		return fmt.Errorf("%w: %s resolved to %s of mount point: %s", ErrPathEscape, rel, resolved, mountPoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckPathBeneath(t *testing.T) {
+	mountPoint := t.TempDir()
+	outside := t.TempDir()
+
+	err := os.Symlink(outside, filepath.Join(mountPoint, "escape"))
+	if err != nil {
+		t.Error("failed to create symlink:", err)
+		t.FailNow()
+	}
+
+	err = os.Symlink("dir", filepath.Join(mountPoint, "inside"))
+	if err != nil {
+		t.Error("failed to create symlink:", err)
+		t.FailNow()
+	}
+
+	err = os.Mkdir(filepath.Join(mountPoint, "dir"), 0755)
+	if err != nil {
+		t.Error("failed to create dir:", err)
+		t.FailNow()
+	}
+
+	for _, rel := range []string{"/", "dir", "dir/not/exist", "inside/file", "dir/../dir"} {
+		err = CheckPathBeneath(mountPoint, rel)
+		if err != nil {
+			t.Error("path:", rel, "should be beneath mount point, but get err:", err)
+		}
+
+		err = checkBeneathWalk(mountPoint, filepath.Clean(rel))
+		if err != nil {
+			t.Error("path:", rel, "should be beneath mount point by walk, but get err:", err)
+		}
+	}
+
+	for _, rel := range []string{"..", "../etc", "dir/../../etc", "escape", "escape/file"} {
+		err = CheckPathBeneath(mountPoint, rel)
+		if !errors.Is(err, ErrPathEscape) {
+			t.Error("path:", rel, "should escape mount point, but get err:", err)
+		}
+	}
+
+	err = checkBeneathWalk(mountPoint, "escape/file")
+	if !errors.Is(err, ErrPathEscape) {
+		t.Error("path: escape/file should escape mount point by walk, but get err:", err)
+	}
+
+	err = CheckAbsPathBeneath(mountPoint, filepath.Join(mountPoint, "dir"))
+	if err != nil {
+		t.Error("absolute path of dir should be beneath mount point, but get err:", err)
+	}
+
+	for _, absPath := range []string{outside, filepath.Join(mountPoint, "escape"), "dir"} {
+		err = CheckAbsPathBeneath(mountPoint, absPath)
+		if !errors.Is(err, ErrPathEscape) {
+			t.Error("absolute path:", absPath, "should escape mount point, but get err:", err)
+		}
+	}
+
+	linkPath := filepath.Join(mountPoint, "dir", "link")
+	for _, target := range []string{"file", "../inside", filepath.Join(mountPoint, "dir")} {
+		err = CheckLinkTargetBeneath(mountPoint, linkPath, target)
+		if err != nil {
+			t.Error("link target:", target, "should be beneath mount point, but get err:", err)
+		}
+	}
+
+	for _, target := range []string{"../..", "../../other", "/etc", "../escape", outside} {
+		err = CheckLinkTargetBeneath(mountPoint, linkPath, target)
+		if !errors.Is(err, ErrPathEscape) {
+			t.Error("link target:", target, "should escape mount point, but get err:", err)
+		}
+	}
+}
+
+func TestOpenParentBeneath(t *testing.T) {
+	mountPoint := t.TempDir()
+	outside := t.TempDir()
+
+	err := os.Mkdir(filepath.Join(mountPoint, "dir"), 0755)
+	if err != nil {
+		t.Fatal("failed to create dir:", err)
+	}
+
+	for _, dir := range []string{filepath.Join(mountPoint, "dir"), outside} {
+		err = os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+		if err != nil {
+			t.Fatal("failed to write file:", err)
+		}
+	}
+
+	fd, name, err := OpenParentBeneath(mountPoint, "dir/file")
+	if err != nil {
+		t.Fatal("failed to open parent beneath mount point:", err)
+	}
+	defer unix.Close(fd)
+
+	// swap parent with symlink to outside after open
+	err = os.Rename(filepath.Join(mountPoint, "dir"), filepath.Join(mountPoint, "moved"))
+	if err == nil {
+		err = os.Symlink(outside, filepath.Join(mountPoint, "dir"))
+	}
+	if err != nil {
+		t.Fatal("failed to swap parent with symlink:", err)
+	}
+
+	err = RemoveAllParallelAt(fd, name, filepath.Join(mountPoint, "dir/file"), RemoveReq{})
+	if err != nil {
+		t.Error("failed to remove relative to parent fd:", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(outside, "file"))
+	if err != nil {
+		t.Error("file outside mount point should be kept, but get err:", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(mountPoint, "moved", "file"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("file at opened parent should be removed, but get err:", err)
+	}
+
+	_, _, err = OpenParentBeneath(mountPoint, "dir/file")
+	if !errors.Is(err, ErrPathEscape) {
+		t.Error("parent that is symlink to outside should escape, but get err:", err)
+	}
+}
@@ -0,0 +1,247 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"transporter/pkg/checksum"
+)
+
+// Policy of resolving name conflict if dest path is exist
+const (
+	ConflictFail                 = "fail"                   // return EEXIST
+	ConflictSkip                 = "skip"                   // keep dest, do nothing
+	ConflictOverwrite            = "overwrite"              // replace dest
+	ConflictOverwriteIfNewer     = "overwrite-if-newer"     // replace dest if mtime of src is newer, otherwise skip
+	ConflictOverwriteIfDifferent = "overwrite-if-different" // replace dest if src is different, otherwise skip
+	ConflictRenameWithSuffix     = "rename-with-suffix"     // write to new name like: file (1).txt
+	ConflictBackup               = "backup"                 // rename dest to backup name, then replace dest
+)
+
+// Method of comparing src and dest for overwrite-if-different
+const (
+	CompareSizeMtime = "size-mtime"
+	CompareChecksum  = "checksum"
+)
+
+const (
+	backupSuffixDefault = "~"
+	renameSuffixLimit   = 1000
+)
+
+var (
+	ErrConflictPolicy  = errors.New("unavailable conflict policy, must be fail, skip, overwrite, overwrite-if-newer, overwrite-if-different, rename-with-suffix or backup")
+	ErrConflictCompare = errors.New("unavailable conflict compare method, must be size-mtime or checksum")
+)
+
+// ConflictPolicy decide what to do if dest path is exist.
+type ConflictPolicy struct {
+	Mode         string
+	Compare      string
+	BackupSuffix string
+}
+
+// ConflictResult is the resolved dest of a conflict, it is resolved without changing anything.
+type ConflictResult struct {
+	Path       string // path to write, may be different to dest if rename with suffix
+	Skip       bool   // true if nothing should be written
+	IsExist    bool   // true if Path is exist and will be replaced
+	BackupPath string // not empty if dest should be renamed to it before replaced
+}
+
+// ParseConflictPolicy return policy of mode and compare method, empty compare means size-mtime.
+func ParseConflictPolicy(mode, compare string) (ConflictPolicy, error) {
+	switch mode {
+	case ConflictFail, ConflictSkip, ConflictOverwrite, ConflictOverwriteIfNewer,
+		ConflictOverwriteIfDifferent, ConflictRenameWithSuffix, ConflictBackup:
+	default:
+		return ConflictPolicy{}, ErrConflictPolicy
+	}
+
+	switch compare {
+	case "":
+		compare = CompareSizeMtime
+	case CompareSizeMtime, CompareChecksum:
+	default:
+		return ConflictPolicy{}, ErrConflictCompare
+	}
+
+	return ConflictPolicy{
+		Mode:         mode,
+		Compare:      compare,
+		BackupSuffix: backupSuffixDefault,
+	}, nil
+}
+
+// Resolve decide how to write src to dest, it does not change anything.
+// If dest is not exist, dest is returned directly.
+func (p ConflictPolicy) Resolve(srcPath, destPath string) (ConflictResult, error) {
+	result := ConflictResult{Path: destPath}
+
+	destInfo, err := os.Lstat(destPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return result, nil
+		}
+		return result, err
+	}
+
+	switch p.Mode {
+	case ConflictSkip:
+		result.Skip = true
+		return result, nil
+
+	case ConflictOverwrite:
+		result.IsExist = true
+		return result, nil
+
+	case ConflictOverwriteIfNewer:
+		srcInfo, err := os.Stat(srcPath)
+		if err != nil {
+			return result, err
+		}
+
+		result.Skip = !srcInfo.ModTime().After(destInfo.ModTime())
+		result.IsExist = !result.Skip
+		return result, nil
+
+	case ConflictOverwriteIfDifferent:
+		isDiff, err := p.isDifferent(srcPath, destPath, destInfo)
+		if err != nil {
+			return result, err
+		}
+
+		result.Skip = !isDiff
+		result.IsExist = isDiff
+		return result, nil
+
+	case ConflictRenameWithSuffix:
+		result.Path, err = suffixPath(destPath)
+		return result, err
+
+	case ConflictBackup:
+		result.IsExist = true
+		result.BackupPath = destPath + p.BackupSuffix
+		return result, nil
+	}
+
+	return result, &os.PathError{Op: "conflict", Path: destPath, Err: fs.ErrExist}
+}
+
+// Backup rename dest to backup path if backup is required, old backup is replaced.
+func (r ConflictResult) Backup() error {
+	if len(r.BackupPath) == 0 {
+		return nil
+	}
+
+	return os.Rename(r.Path, r.BackupPath)
+}
+
+// Replace rename src to resolved path, exist path is replaced only if the result allow it,
+// otherwise rename fail with EEXIST even if path is created after resolve.
+// If backup is required, src and path are swapped atomically where supported, so path is never missing,
+// then old content of path is renamed from src to backup path.
+func (r ConflictResult) Replace(srcPath string) error {
+	if r.Skip {
+		return nil
+	}
+
+	if len(r.BackupPath) == 0 {
+		if r.IsExist {
+			return os.Rename(srcPath, r.Path)
+		}
+		return RenameNoReplace(srcPath, r.Path)
+	}
+
+	err := RenameExchange(srcPath, r.Path)
+	if err == nil {
+		err = os.Rename(srcPath, r.BackupPath)
+		if err != nil {
+			// swap back, src and path are both kept
+			_ = RenameExchange(srcPath, r.Path)
+		}
+		return err
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		// path is removed after resolve, nothing to backup
+		return RenameNoReplace(srcPath, r.Path)
+	}
+
+	if !IsRenameExchangeUnsupported(err) {
+		return err
+	}
+
+	err = r.Backup()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return RenameNoReplace(srcPath, r.Path)
+}
+
+// isDifferent compare src and dest, dir is compared by mtime only.
+func (p ConflictPolicy) isDifferent(srcPath, destPath string, destInfo os.FileInfo) (bool, error) {
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	if srcInfo.IsDir() != destInfo.IsDir() {
+		return true, nil
+	}
+
+	if srcInfo.IsDir() {
+		return !srcInfo.ModTime().Equal(destInfo.ModTime()), nil
+	}
+
+	if srcInfo.Size() != destInfo.Size() {
+		return true, nil
+	}
+
+	if p.Compare != CompareChecksum {
+		return !srcInfo.ModTime().Equal(destInfo.ModTime()), nil
+	}
+
+	srcSum, err := checksum.MD5(srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	destSum, err := checksum.MD5(destPath)
+	if err != nil {
+		return false, err
+	}
+
+	return !checksum.Compare(srcSum, destSum), nil
+}
+
+// suffixPath return the first not exist path like: dir/file (1).txt,
+// suffix is inserted before extension of file, dot file has no extension.
+func suffixPath(path string) (string, error) {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	var newPath string
+	for i := 1; i <= renameSuffixLimit; i++ {
+		newPath = dir + base + " (" + strconv.Itoa(i) + ")" + ext
+		_, err := os.Lstat(newPath)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return newPath, nil
+		}
+		return "", err
+	}
+
+	return "", &os.PathError{Op: "conflict", Path: path, Err: fs.ErrExist}
+}
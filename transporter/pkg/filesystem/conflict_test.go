@@ -0,0 +1,126 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	_ = os.WriteFile(src, []byte("src"), 0644)
+	_ = os.WriteFile(dest, []byte("old"), 0644)
+	_ = os.Chtimes(dest, time.Unix(0, 0), time.Unix(0, 0))
+
+	_, err := ParseConflictPolicy("unknown", "")
+	if !errors.Is(err, ErrConflictPolicy) {
+		t.Error("expect err of conflict policy, but get:", err)
+	}
+
+	p, _ := ParseConflictPolicy(ConflictFail, "")
+	_, err = p.Resolve(src, dest)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Error("expect exist err, but get:", err)
+	}
+
+	r, err := p.Resolve(src, filepath.Join(dir, "not-exist"))
+	if err != nil || r.Skip || r.IsExist {
+		t.Error("not exist dest should be written directly:", r, err)
+	}
+
+	p, _ = ParseConflictPolicy(ConflictOverwriteIfNewer, "")
+	r, _ = p.Resolve(src, dest)
+	if r.Skip || !r.IsExist {
+		t.Error("newer src should overwrite dest:", r)
+	}
+
+	r, _ = p.Resolve(dest, src)
+	if !r.Skip {
+		t.Error("older src should be skipped:", r)
+	}
+
+	// same size and content, only mtime is different
+	_ = os.WriteFile(dest, []byte("src"), 0644)
+	_ = os.Chtimes(dest, time.Unix(0, 0), time.Unix(0, 0))
+	p, _ = ParseConflictPolicy(ConflictOverwriteIfDifferent, CompareSizeMtime)
+	r, _ = p.Resolve(src, dest)
+	if r.Skip {
+		t.Error("different mtime should overwrite dest:", r)
+	}
+
+	p, _ = ParseConflictPolicy(ConflictOverwriteIfDifferent, CompareChecksum)
+	r, _ = p.Resolve(src, dest)
+	if !r.Skip {
+		t.Error("same checksum should be skipped:", r)
+	}
+
+	_ = os.WriteFile(filepath.Join(dir, "dest (1).txt"), nil, 0644)
+	p, _ = ParseConflictPolicy(ConflictRenameWithSuffix, "")
+	r, _ = p.Resolve(src, dest)
+	if r.Path != filepath.Join(dir, "dest (2).txt") {
+		t.Error("unexpected path with suffix:", r.Path)
+	}
+
+	p, _ = ParseConflictPolicy(ConflictBackup, "")
+	r, _ = p.Resolve(src, dest)
+	err = r.Backup()
+	if err != nil || r.BackupPath != dest+backupSuffixDefault {
+		t.Error("failed to backup dest:", r, err)
+	}
+
+	_, err = os.Stat(dest + backupSuffixDefault)
+	if err != nil {
+		t.Error("backup is not exist:", err)
+	}
+}
+
+func TestConflictResultReplaceVanished(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	_ = os.WriteFile(src, []byte("src"), 0644)
+	_ = os.WriteFile(dest, []byte("old"), 0644)
+
+	p, _ := ParseConflictPolicy(ConflictBackup, "")
+	r, err := p.Resolve(src, dest)
+	if err != nil || len(r.BackupPath) == 0 {
+		t.Fatal("dest should be backed up:", r, err)
+	}
+
+	// dest is removed after resolve
+	_ = os.Remove(dest)
+	err = r.Replace(src)
+	if err != nil {
+		t.Error("failed to replace vanished dest:", err)
+	}
+
+	content, _ := os.ReadFile(dest)
+	if string(content) != "src" {
+		t.Error("unexpected content of dest:", string(content))
+	}
+
+	_, err = os.Lstat(r.BackupPath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("nothing should be backed up, but get:", err)
+	}
+}
+
+func TestSuffixPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, expect := range map[string]string{
+		"file.txt": "file (1).txt",
+		"file":     "file (1)",
+		".hidden":  ".hidden (1)",
+		"a.tar.gz": "a.tar (1).gz",
+	} {
+		path, err := suffixPath(filepath.Join(dir, name))
+		if err != nil || path != filepath.Join(dir, expect) {
+			t.Error("expect:", expect, "but get:", path, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Type of path at create, file and dir are same as metadata
+const (
+	TypeHardlink = "hardlink"
+)
+
+// NoChange means mode, uid, gid or umask of create request is not set.
+const NoChange = -1
+
+const linkTempSuffix = ".transporter-link"
+
+// CreateReq is request of creating a file, dir, symlink or hardlink.
+// Parent dirs are created with default permission if they are not exist.
+type CreateReq struct {
+	Type           string // file, dir, symlink or hardlink
+	Target         string // target of symlink or hardlink, hardlink target must be absolute
+	Mode           int    // permission with special bits, like: 0640, it override policy, NoChange means not set
+	UID            int    // owner of path, NoChange means not change
+	GID            int    // group of path, NoChange means not change
+	Umask          int    // umask of process during create, NoChange means not change
+	Size           int64  // preallocate size of file by fallocate, 0 means no preallocate
+	IsOverWrite    bool   // truncate exist file, or replace exist symlink and hardlink
+	IsKeepExisting bool   // not change permission, owner and size of exist path
+	Policy         PermPolicy
+}
+
+// NewCreateReq return request of type with nothing changed but default permission.
+func NewCreateReq(typeCreate string) CreateReq {
+	return CreateReq{
+		Type:   typeCreate,
+		Mode:   NoChange,
+		UID:    NoChange,
+		GID:    NoChange,
+		Umask:  NoChange,
+		Policy: PreservePolicy,
+	}
+}
+
+// PermPolicy return policy of path, mode is enforced if it is set.
+// Symlink and hardlink have no own permission, hardlink shares permission with target.
+func (req CreateReq) PermPolicy() PermPolicy {
+	switch {
+	case req.Type != TypeDir && req.Type != TypeFile:
+		return PreservePolicy
+	case req.Mode != NoChange:
+		return PermPolicy{Type: PermEnforce, Mode: fileModeOf(uint32(req.Mode))}
+	}
+	return req.Policy
+}
+
+// Create create path according request, exist path is kept and its owner and size are reset
+// unless IsKeepExisting, its permission is handled by policy. Return unix.EEXIST if path is
+// exist with other type or other target and it is not overwritten.
+// Parent dirs are created by policy too, return permission changes that policy made.
+func Create(path string, req CreateReq) ([]PermChange, error) {
+	if req.Umask != NoChange {
+		oldUmask := unix.Umask(req.Umask)
+		defer unix.Umask(oldUmask)
+	}
+
+	var changes []PermChange
+	err := mkdirAll(filepath.Dir(path), req.Policy, &changes)
+	if err != nil {
+		return changes, err
+	}
+
+	var isCreated bool
+	switch req.Type {
+	case TypeDir:
+		isCreated, err = createDir(path)
+	case TypeFile:
+		isCreated, err = createFile(path, req)
+	case TypeSymlink:
+		isCreated, err = createSymlink(path, req)
+	case TypeHardlink:
+		isCreated, err = createHardlink(path, req)
+	default:
+		return changes, unix.EINVAL
+	}
+	if err != nil {
+		return changes, err
+	}
+
+	if !isCreated && req.IsKeepExisting {
+		return changes, nil
+	}
+
+	err = chownPath(path, req)
+	if err != nil {
+		return changes, err
+	}
+
+	if req.Type != TypeDir && req.Type != TypeFile {
+		return changes, nil
+	}
+
+	// chown may clear setuid and setgid, so chmod at last
+	err = applyPerm(path, isCreated, req.PermPolicy(), &changes)
+	return changes, err
+}
+
+func createDir(path string) (bool, error) {
+	// symlink to dir is kept as CheckOrCreateDir does
+	pInfo, err := os.Stat(path)
+	if err == nil {
+		if !pInfo.IsDir() {
+			return false, unix.ENOTDIR
+		}
+		return false, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	err = os.Mkdir(path, permDirDefault)
+	if errors.Is(err, fs.ErrExist) {
+		// created by others after stat
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func createFile(path string, req CreateReq) (bool, error) {
+	openFlag := unix.O_RDWR | unix.O_CREAT
+	if req.IsOverWrite && !req.IsKeepExisting {
+		openFlag |= unix.O_TRUNC
+	}
+
+	_, err := os.Stat(path)
+	isCreated := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !isCreated {
+		return false, err
+	}
+
+	f, err := os.OpenFile(path, openFlag, permFileDefault)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if req.Size > 0 && (isCreated || !req.IsKeepExisting) {
+		err = unix.Fallocate(int(f.Fd()), 0, 0, req.Size)
+		if err != nil {
+			return isCreated, &os.PathError{Op: "fallocate", Path: path, Err: err}
+		}
+	}
+	return isCreated, nil
+}
+
+func createSymlink(path string, req CreateReq) (bool, error) {
+	if len(req.Target) == 0 {
+		return false, unix.EINVAL
+	}
+
+	target, err := os.Readlink(path)
+	if err == nil && target == req.Target {
+		return false, nil
+	}
+
+	return replaceLink(path, req.IsOverWrite, func(linkPath string) error {
+		return os.Symlink(req.Target, linkPath)
+	})
+}
+
+func createHardlink(path string, req CreateReq) (bool, error) {
+	if len(req.Target) == 0 {
+		return false, unix.EINVAL
+	}
+
+	targetInfo, err := os.Lstat(req.Target)
+	if err != nil {
+		return false, err
+	}
+
+	pInfo, err := os.Lstat(path)
+	if err == nil && os.SameFile(pInfo, targetInfo) {
+		return false, nil
+	}
+
+	return replaceLink(path, req.IsOverWrite, func(linkPath string) error {
+		return os.Link(req.Target, linkPath)
+	})
+}
+
+// replaceLink create link at path, exist path is replaced atomically by rename if overwrite,
+// dir is never replaced.
+func replaceLink(path string, isOverWrite bool, link func(linkPath string) error) (bool, error) {
+	err := link(path)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, fs.ErrExist) || !isOverWrite {
+		return false, err
+	}
+
+	pInfo, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	if pInfo.IsDir() {
+		return false, unix.EISDIR
+	}
+
+	tempPath := path + linkTempSuffix
+	_ = os.Remove(tempPath)
+	err = link(tempPath)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return false, err
+	}
+	return true, nil
+}
+
+// chownPath change owner of path, symlink is followed except type symlink.
+func chownPath(path string, req CreateReq) error {
+	if req.UID == NoChange && req.GID == NoChange {
+		return nil
+	}
+
+	if req.Type == TypeSymlink {
+		return os.Lchown(path, req.UID, req.GID)
+	}
+	return os.Chown(path, req.UID, req.GID)
+}
@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCreate(t *testing.T) {
+	root := t.TempDir()
+
+	dirPath := filepath.Join(root, "a/b/dir")
+	req := NewCreateReq(TypeDir)
+	req.Mode = 0750
+	_, err := Create(dirPath, req)
+	if err != nil {
+		t.Fatal("failed to create dir:", err)
+	}
+	pInfo, err := os.Stat(dirPath)
+	if err != nil || pInfo.Mode().Perm() != 0750 {
+		t.Error("unexpected dir:", pInfo, err)
+	}
+
+	// exist dir is kept
+	req = NewCreateReq(TypeDir)
+	req.IsKeepExisting = true
+	_, err = Create(dirPath, req)
+	pInfo, _ = os.Stat(dirPath)
+	if err != nil || pInfo.Mode().Perm() != 0750 {
+		t.Error("exist dir should be kept:", pInfo.Mode(), err)
+	}
+
+	filePath := filepath.Join(root, "file")
+	req = NewCreateReq(TypeFile)
+	req.Umask = 0027
+	req.Size = 4096
+	_, err = Create(filePath, req)
+	if err != nil {
+		t.Fatal("failed to create file:", err)
+	}
+	pInfo, err = os.Stat(filePath)
+	if err != nil || pInfo.Mode().Perm() != 0750 || pInfo.Size() != 4096 {
+		t.Error("unexpected file:", pInfo.Mode(), pInfo.Size(), err)
+	}
+
+	_, err = Create(filePath, NewCreateReq(TypeDir))
+	if !errors.Is(err, unix.ENOTDIR) {
+		t.Error("expect err of not dir, but get:", err)
+	}
+
+	linkPath := filepath.Join(root, "link")
+	req = NewCreateReq(TypeSymlink)
+	req.Target = "file"
+	_, err = Create(linkPath, req)
+	target, _ := os.Readlink(linkPath)
+	if err != nil || target != "file" {
+		t.Error("unexpected symlink:", target, err)
+	}
+
+	req.Target = "dir"
+	_, err = Create(linkPath, req)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Error("expect err of exist, but get:", err)
+	}
+
+	req.IsOverWrite = true
+	_, err = Create(linkPath, req)
+	target, _ = os.Readlink(linkPath)
+	if err != nil || target != "dir" {
+		t.Error("symlink should be replaced:", target, err)
+	}
+
+	hardlinkPath := filepath.Join(root, "hardlink")
+	req = NewCreateReq(TypeHardlink)
+	req.Target = filePath
+	_, err = Create(hardlinkPath, req)
+	if err != nil {
+		t.Fatal("failed to create hardlink:", err)
+	}
+	_, err = Create(hardlinkPath, req)
+	if err != nil {
+		t.Error("same hardlink should be kept, but get:", err)
+	}
+	fInfo, _ := os.Stat(filePath)
+	pInfo, _ = os.Stat(hardlinkPath)
+	if !os.SameFile(fInfo, pInfo) {
+		t.Error("hardlink should be same file as target")
+	}
+}
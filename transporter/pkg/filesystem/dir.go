@@ -21,35 +21,24 @@ func CheckDirPathFormat(path string) bool {
 }
 
 
-// CheckOrCreateDir check path is a dir, if not exist, create dir.
-// If path is a exist dir or create a new dir according path, return nil.
-func CheckOrCreateDir(dirPath string) error {
+// CheckOrCreateDir check path is a dir, if not exist, create dir and its parents.
+// Permission of exist or created dirs is handled by policy, return changes that policy made.
+func CheckOrCreateDir(dirPath string, policy PermPolicy) ([]PermChange, error) {
+	var changes []PermChange
 	dirInfo, err := os.Stat(dirPath)
 	if err != nil {
 		if !errors.Is(err, fs.ErrNotExist) {
-			return err
+			return nil, err
 		}
 
-		err = os.MkdirAll(dirPath, permDirDefault)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		err = mkdirAll(dirPath, policy, &changes)
+		return changes, err
 	}
 
 	if !dirInfo.IsDir() {
-		return unix.ENOTDIR
-	}
-
-	if dirInfo.Mode().Perm() == permDirDefault {
-		return nil
-	}
-
-	err = os.Chmod(dirPath, permDirDefault)
-	if err != nil {
-		return err
+		return nil, unix.ENOTDIR
 	}
 
-	return nil
+	err = applyPerm(dirPath, false, policy, &changes)
+	return changes, err
 }
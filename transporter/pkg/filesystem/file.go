@@ -4,7 +4,7 @@ import (
 	"errors"
 	"io/fs"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"golang.org/x/sys/unix"
 )
@@ -56,42 +56,42 @@ func CheckFilePathFormat(path string) bool {
 }
 
 
-func CheckOrCreateFile(filePath string, isOverWrite bool) error {
-	fInfo, err := os.Stat(filePath)
+// CheckOrCreateFile check or create file, parent dirs are created if not exist. Exist file is not truncated,
+// isOverWrite only truncate file that created by others during create.
+// Permission of exist or created paths is handled by policy, return changes that policy made.
+func CheckOrCreateFile(filePath string, isOverWrite bool, policy PermPolicy) ([]PermChange, error) {
+	var changes []PermChange
+	_, err := os.Stat(filePath)
 	if err == nil {
-		if fInfo.Mode().Perm() == permFileDefault {
-			return nil
-		}
-
-		err = os.Chmod(filePath, permFileDefault)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		err = applyPerm(filePath, false, policy, &changes)
+		return changes, err
 	}
 
 	if !errors.Is(err, fs.ErrNotExist) {
-		return err
+		return nil, err
 	}
 
-	parentDirIndex := strings.LastIndex(filePath, slashStr)
-	if parentDirIndex > 1 {
-		parentDirPath := filePath[:parentDirIndex]
-		err = os.MkdirAll(parentDirPath, permDirDefault)
-		if err != nil {
-			return err
-		}
+	err = mkdirAll(filepath.Dir(filePath), policy, &changes)
+	if err != nil {
+		return changes, err
 	}
 
-	var openFlag int = unix.O_RDWR|unix.O_CREAT
-	if isOverWrite {
-		openFlag = openFlag|unix.O_TRUNC
+	isCreated := true
+	f, err := os.OpenFile(filePath, unix.O_RDWR|unix.O_CREAT|unix.O_EXCL, permFileDefault)
+	if errors.Is(err, fs.ErrExist) {
+		// created by others after stat
+		isCreated = false
+		openFlag := unix.O_RDWR
+		if isOverWrite {
+			openFlag |= unix.O_TRUNC
+		}
+		f, err = os.OpenFile(filePath, openFlag, permFileDefault)
 	}
-	_, err = os.OpenFile(filePath, openFlag, permFileDefault)
 	if err != nil {
-		return err
+		return changes, err
 	}
+	_ = f.Close()
 
-	return nil
+	err = applyPerm(filePath, isCreated, policy, &changes)
+	return changes, err
 }
\ No newline at end of file
@@ -0,0 +1,239 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Magic number of filesystem type that returned by statfs
+const (
+	EXT4      = 0xEF53
+	XFS       = 0x58465342
+	BTRFS     = 0x9123683E
+	TMPFS     = 0x01021994
+	CEPH      = 0x00C36400
+	GPFS      = 0x47504653
+	BEEGFS    = 0x19830326
+	FUSE      = 0x65735546
+	CIFS      = 0xFF534D42
+	SMB2      = 0xFE534D42
+	OVERLAYFS = 0x794C7630
+	ZFS       = 0x2FC12FC1
+	PANFS     = 0xAAD7AAEA
+)
+
+// Name of filesystem type at catalogue
+const (
+	FSNameNFS       = "nfs"
+	FSNameLustre    = "lustre"
+	FSNameExt4      = "ext4"
+	FSNameXFS       = "xfs"
+	FSNameBtrfs     = "btrfs"
+	FSNameTmpfs     = "tmpfs"
+	FSNameCeph      = "ceph"
+	FSNameGPFS      = "gpfs"
+	FSNameBeeGFS    = "beegfs"
+	FSNameFuse      = "fuse"
+	FSNameCIFS      = "cifs"
+	FSNameSMB2      = "smb2"
+	FSNameOverlayFS = "overlayfs"
+	FSNameZFS       = "zfs"
+	FSNamePanFS     = "panfs"
+)
+
+const (
+	// EnvFSTypeAllow and EnvFSTypeDeny is env of filesystem type policy, format: nfs,lustre,0x2fc12fc1
+	EnvFSTypeAllow = "TRANSPORTER_FS_ALLOW"
+	EnvFSTypeDeny  = "TRANSPORTER_FS_DENY"
+
+	sepFSType       = ","
+	prefixFSTypeHex = "0x"
+	fsNameUnknown   = "unknown"
+)
+
+// fsTypeCatalogue is name of known filesystem type, ext2 and ext3 share magic number with ext4.
+var fsTypeCatalogue = map[int64]string{
+	NFS:       FSNameNFS,
+	LUSTRE0:   FSNameLustre,
+	LUSTRE1:   FSNameLustre,
+	EXT4:      FSNameExt4,
+	XFS:       FSNameXFS,
+	BTRFS:     FSNameBtrfs,
+	TMPFS:     FSNameTmpfs,
+	CEPH:      FSNameCeph,
+	GPFS:      FSNameGPFS,
+	BEEGFS:    FSNameBeeGFS,
+	FUSE:      FSNameFuse,
+	CIFS:      FSNameCIFS,
+	SMB2:      FSNameSMB2,
+	OVERLAYFS: FSNameOverlayFS,
+	ZFS:       FSNameZFS,
+	PANFS:     FSNamePanFS,
+}
+
+var ErrUnknownFSTypeName = errors.New("unknown filesystem type name, must be name of catalogue or magic number like 0x6969")
+
+// FSTypeError is returned if filesystem type of path is not allowed.
+type FSTypeError struct {
+	Path string
+	Type int64
+}
+
+func (e *FSTypeError) Error() string {
+	return fmt.Sprintf("%s: %s of path: %s", ErrUnavailableFileSystem.Error(), FSTypeName(e.Type), e.Path)
+}
+
+func (e *FSTypeError) Unwrap() error {
+	return ErrUnavailableFileSystem
+}
+
+// FSTypePolicy decide which filesystem type is available, deny has higher priority than allow.
+type FSTypePolicy struct {
+	Allow []int64
+	Deny  []int64
+}
+
+// fsTypePolicyFile is content format of filesystem type policy file, for example:
+//
+//	{"allow": ["nfs", "lustre", "ceph"], "deny": ["tmpfs"]}
+type fsTypePolicyFile struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// fsPolicy is the effective filesystem type policy, only NFS and Lustre are allowed by default.
+var fsPolicy = FSTypePolicy{
+	Allow: fsList,
+}
+
+// FSTypeName return name of filesystem type with magic number.
+func FSTypeName(fsType int64) string {
+	name, ok := fsTypeCatalogue[fsType]
+	if !ok {
+		name = fsNameUnknown
+	}
+
+	return fmt.Sprintf("%s(0x%x)", name, fsType)
+}
+
+// ParseFSTypeList parse list of filesystem type name or magic number, format: nfs,lustre,0x2fc12fc1
+func ParseFSTypeList(s string) ([]int64, error) {
+	var fsTypes []int64
+	for _, item := range strings.Split(s, sepFSType) {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if len(item) == 0 {
+			continue
+		}
+
+		types, err := parseFSType(item)
+		if err != nil {
+			return nil, err
+		}
+		fsTypes = append(fsTypes, types...)
+	}
+
+	return fsTypes, nil
+}
+
+// parseFSType return all magic number of filesystem type name, or magic number self.
+func parseFSType(item string) ([]int64, error) {
+	if strings.HasPrefix(item, prefixFSTypeHex) {
+		fsType, err := strconv.ParseInt(item[len(prefixFSTypeHex):], 16, 64)
+		if err != nil {
+			return nil, ErrUnknownFSTypeName
+		}
+
+		return []int64{fsType}, nil
+	}
+
+	var fsTypes []int64
+	for fsType, name := range fsTypeCatalogue {
+		if name == item {
+			fsTypes = append(fsTypes, fsType)
+		}
+	}
+
+	if len(fsTypes) == 0 {
+		return nil, ErrUnknownFSTypeName
+	}
+
+	return fsTypes, nil
+}
+
+// LoadFSTypePolicy load filesystem type policy from file, env and flag,
+// source at the back override the front one, empty value means not specified.
+func LoadFSTypePolicy(configPath, allowFlag, denyFlag string) error {
+	p := FSTypePolicy{
+		Allow: fsList,
+	}
+
+	var (
+		allowList []string
+		denyList  []string
+	)
+	if len(configPath) != 0 {
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+
+		var pf fsTypePolicyFile
+		err = json.Unmarshal(content, &pf)
+		if err != nil {
+			return err
+		}
+
+		allowList = appendFSTypeValue(allowList, strings.Join(pf.Allow, sepFSType))
+		denyList = appendFSTypeValue(denyList, strings.Join(pf.Deny, sepFSType))
+	}
+
+	allowList = appendFSTypeValue(allowList, os.Getenv(EnvFSTypeAllow))
+	denyList = appendFSTypeValue(denyList, os.Getenv(EnvFSTypeDeny))
+
+	allowList = appendFSTypeValue(allowList, allowFlag)
+	denyList = appendFSTypeValue(denyList, denyFlag)
+
+	var err error
+	if len(allowList) != 0 {
+		p.Allow, err = ParseFSTypeList(allowList[len(allowList)-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(denyList) != 0 {
+		p.Deny, err = ParseFSTypeList(denyList[len(denyList)-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	fsPolicy = p
+	return nil
+}
+
+// appendFSTypeValue append value of a source to list if it is specified, value without any item is not specified.
+func appendFSTypeValue(list []string, value string) []string {
+	if len(strings.Trim(value, sepFSType+" ")) == 0 {
+		return list
+	}
+
+	return append(list, value)
+}
+
+// EffectiveFSTypePolicy return name of allowed and denied filesystem type at current.
+func EffectiveFSTypePolicy() (allow, deny []string) {
+	for _, fsType := range fsPolicy.Allow {
+		allow = append(allow, FSTypeName(fsType))
+	}
+
+	for _, fsType := range fsPolicy.Deny {
+		deny = append(deny, FSTypeName(fsType))
+	}
+
+	return allow, deny
+}
@@ -0,0 +1,91 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFSTypeList(t *testing.T) {
+	fsTypes, err := ParseFSTypeList(" NFS, ceph,,0x2fc12fc1 ")
+	if err != nil {
+		t.Fatal("failed to parse filesystem type list:", err)
+	}
+
+	expect := []int64{NFS, CEPH, ZFS}
+	if len(fsTypes) != len(expect) {
+		t.Fatal("expect filesystem types:", expect, "but get:", fsTypes)
+	}
+	for i := range expect {
+		if fsTypes[i] != expect[i] {
+			t.Error("expect filesystem types:", expect, "but get:", fsTypes)
+		}
+	}
+
+	fsTypes, _ = ParseFSTypeList("lustre")
+	if len(fsTypes) != 2 {
+		t.Error("lustre should have 2 magic numbers, but get:", fsTypes)
+	}
+
+	for _, s := range []string{"unknownfs", "0xzz", "nfs,foo"} {
+		_, err = ParseFSTypeList(s)
+		if !errors.Is(err, ErrUnknownFSTypeName) {
+			t.Error("expect err of unknown name:", s, "but get:", err)
+		}
+	}
+}
+
+func TestLoadFSTypePolicy(t *testing.T) {
+	defer func(p FSTypePolicy) { fsPolicy = p }(fsPolicy)
+
+	configPath := filepath.Join(t.TempDir(), "fs.json")
+	err := os.WriteFile(configPath, []byte(`{"allow": ["ceph"], "deny": ["tmpfs"]}`), 0644)
+	if err != nil {
+		t.Fatal("failed to write policy file:", err)
+	}
+
+	tests := []struct {
+		name      string
+		allowEnv  string
+		allowFlag string
+		available []int64
+		denied    []int64
+	}{
+		{"default", "", "", []int64{NFS, LUSTRE0}, []int64{CEPH, TMPFS}},
+		{"file", "", "", []int64{CEPH}, []int64{NFS, TMPFS}},
+		{"empty env", " ", "", []int64{CEPH}, []int64{NFS}},
+		{"env override file", "nfs", "", []int64{NFS}, []int64{CEPH}},
+		{"flag override env", "nfs", "xfs,tmpfs", []int64{XFS}, []int64{NFS, TMPFS}},
+	}
+
+	for _, tt := range tests {
+		path := configPath
+		if tt.name == "default" {
+			path = ""
+		}
+		t.Setenv(EnvFSTypeAllow, tt.allowEnv)
+
+		err = LoadFSTypePolicy(path, tt.allowFlag, "")
+		if err != nil {
+			t.Error(tt.name, "failed to load policy:", err)
+			continue
+		}
+
+		for _, fsType := range tt.available {
+			if !IsAvailableFileSystem(fsType) {
+				t.Error(tt.name, "filesystem type should be available:", FSTypeName(fsType))
+			}
+		}
+		for _, fsType := range tt.denied {
+			if IsAvailableFileSystem(fsType) {
+				t.Error(tt.name, "filesystem type should not be available:", FSTypeName(fsType))
+			}
+		}
+	}
+
+	err = LoadFSTypePolicy("", "nfs,foo", "")
+	if !errors.Is(err, ErrUnknownFSTypeName) {
+		t.Error("expect err of unknown name, but get:", err)
+	}
+}
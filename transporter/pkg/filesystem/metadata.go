@@ -0,0 +1,281 @@
+package filesystem
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// Type of path at metadata
+const (
+	TypeFile    = "file"
+	TypeDir     = "dir"
+	TypeSymlink = "symlink"
+	TypeOther   = "other"
+)
+
+const (
+	xattrBufSize       = 4096
+	xattrBinaryPrefix  = "0s" // same as getfattr, value is base64 encoded
+	xattrACLAccess     = "system.posix_acl_access"
+	xattrACLDefault    = "system.posix_acl_default"
+	aclXattrVersion    = 2
+	aclXattrHeaderSize = 4
+	aclXattrEntrySize  = 8
+)
+
+// tag of posix acl entry at xattr
+const (
+	aclUserObj  = 0x01
+	aclUser     = 0x02
+	aclGroupObj = 0x04
+	aclGroup    = 0x08
+	aclMask     = 0x10
+	aclOther    = 0x20
+)
+
+// Metadata is metadata of path, symlink is not followed.
+type Metadata struct {
+	Path          string            `json:"path"`
+	Type          string            `json:"type"`
+	Size          int64             `json:"size"`
+	Mode          string            `json:"mode"` // like: -rw-r--r--
+	Perm          string            `json:"perm"` // octal with special bits, like: 0644
+	UID           uint32            `json:"uid"`
+	GID           uint32            `json:"gid"`
+	User          string            `json:"user"`  // empty if uid has no name
+	Group         string            `json:"group"` // empty if gid has no name
+	Mtime         time.Time         `json:"mtime"`
+	Atime         time.Time         `json:"atime"`
+	Ctime         time.Time         `json:"ctime"`
+	Inode         uint64            `json:"inode"`
+	Nlink         uint64            `json:"nlink"`
+	SymlinkTarget string            `json:"symlink_target,omitempty"`
+	Xattrs        map[string]string `json:"xattrs,omitempty"` // binary value is base64 with prefix 0s
+	ACL           string            `json:"acl,omitempty"`    // posix access acl, like: user::rw-,group::r--,other::r--
+	DefaultACL    string            `json:"default_acl,omitempty"`
+}
+
+var (
+	nameCacheLock  sync.Mutex
+	userNameCache  = map[uint32]string{}
+	groupNameCache = map[uint32]string{}
+)
+
+// GetMetadata return metadata of path, symlink is not followed.
+// Xattrs that failed to read are skipped, because they may be not supported by filesystem.
+func GetMetadata(path string) (Metadata, error) {
+	var st unix.Stat_t
+	err := unix.Lstat(path, &st)
+	if err != nil {
+		return Metadata{}, &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+
+	pInfo, err := os.Lstat(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	m := Metadata{
+		Path:  path,
+		Size:  st.Size,
+		Mode:  pInfo.Mode().String(),
+		Perm:  fmt.Sprintf("%04o", st.Mode&^unix.S_IFMT),
+		UID:   st.Uid,
+		GID:   st.Gid,
+		User:  userName(st.Uid),
+		Group: groupName(st.Gid),
+		Mtime: time.Unix(st.Mtim.Unix()),
+		Atime: time.Unix(st.Atim.Unix()),
+		Ctime: time.Unix(st.Ctim.Unix()),
+		Inode: st.Ino,
+		Nlink: uint64(st.Nlink),
+	}
+
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		m.Type = TypeFile
+	case unix.S_IFDIR:
+		m.Type = TypeDir
+	case unix.S_IFLNK:
+		m.Type = TypeSymlink
+		m.SymlinkTarget, err = os.Readlink(path)
+		if err != nil {
+			return m, err
+		}
+	default:
+		m.Type = TypeOther
+	}
+
+	m.Xattrs = readXattrs(path)
+	if value, ok := m.Xattrs[xattrACLAccess]; ok {
+		m.ACL = formatACL(value)
+		delete(m.Xattrs, xattrACLAccess)
+	}
+	if value, ok := m.Xattrs[xattrACLDefault]; ok {
+		m.DefaultACL = formatACL(value)
+		delete(m.Xattrs, xattrACLDefault)
+	}
+	for name, value := range m.Xattrs {
+		m.Xattrs[name] = encodeXattrValue(value)
+	}
+
+	return m, nil
+}
+
+// readXattrs return all xattrs of path, value is raw bytes as string.
+func readXattrs(path string) map[string]string {
+	buf := make([]byte, xattrBufSize)
+	size, err := unix.Llistxattr(path, buf)
+	if err == unix.ERANGE {
+		size, err = unix.Llistxattr(path, nil)
+		if err == nil {
+			buf = make([]byte, size)
+			size, err = unix.Llistxattr(path, buf)
+		}
+	}
+	if err != nil || size == 0 {
+		return nil
+	}
+
+	xattrs := map[string]string{}
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if len(name) == 0 {
+			continue
+		}
+
+		value, err := readXattr(path, name)
+		if err != nil {
+			continue
+		}
+		xattrs[name] = value
+	}
+	return xattrs
+}
+
+func readXattr(path, name string) (string, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:size]), nil
+}
+
+// encodeXattrValue return value as text if it is printable utf-8, otherwise base64 with prefix 0s.
+func encodeXattrValue(value string) string {
+	text := strings.TrimSuffix(value, "\x00")
+	if !utf8.ValidString(text) || strings.IndexFunc(text, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return xattrBinaryPrefix + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return text
+}
+
+// formatACL convert posix acl at xattr to text like: user::rw-,user:1000:r--,group::r--,mask::r--,other::r--,
+// it return encoded raw value if format is unknown.
+func formatACL(value string) string {
+	raw := []byte(value)
+	if len(raw) < aclXattrHeaderSize || binary.LittleEndian.Uint32(raw) != aclXattrVersion ||
+		(len(raw)-aclXattrHeaderSize)%aclXattrEntrySize != 0 {
+		return encodeXattrValue(value)
+	}
+
+	var entryList []string
+	for i := aclXattrHeaderSize; i < len(raw); i += aclXattrEntrySize {
+		tag := binary.LittleEndian.Uint16(raw[i:])
+		perm := binary.LittleEndian.Uint16(raw[i+2:])
+		id := binary.LittleEndian.Uint32(raw[i+4:])
+
+		var qualifier string
+		switch tag {
+		case aclUserObj:
+			qualifier = "user:"
+		case aclUser:
+			qualifier = "user:" + nameOrID(userName(id), id)
+		case aclGroupObj:
+			qualifier = "group:"
+		case aclGroup:
+			qualifier = "group:" + nameOrID(groupName(id), id)
+		case aclMask:
+			qualifier = "mask:"
+		case aclOther:
+			qualifier = "other:"
+		default:
+			return encodeXattrValue(value)
+		}
+		entryList = append(entryList, qualifier+":"+permString(perm))
+	}
+	return strings.Join(entryList, ",")
+}
+
+func permString(perm uint16) string {
+	b := []byte("---")
+	if perm&4 != 0 {
+		b[0] = 'r'
+	}
+	if perm&2 != 0 {
+		b[1] = 'w'
+	}
+	if perm&1 != 0 {
+		b[2] = 'x'
+	}
+	return string(b)
+}
+
+func nameOrID(name string, id uint32) string {
+	if len(name) != 0 {
+		return name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// userName return name of uid, empty if not found.
+func userName(uid uint32) string {
+	nameCacheLock.Lock()
+	defer nameCacheLock.Unlock()
+
+	name, ok := userNameCache[uid]
+	if ok {
+		return name
+	}
+
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err == nil {
+		name = u.Username
+	}
+	userNameCache[uid] = name
+	return name
+}
+
+// groupName return name of gid, empty if not found.
+func groupName(gid uint32) string {
+	nameCacheLock.Lock()
+	defer nameCacheLock.Unlock()
+
+	name, ok := groupNameCache[gid]
+	if ok {
+		return name
+	}
+
+	g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+	if err == nil {
+		name = g.Name
+	}
+	groupNameCache[gid] = name
+	return name
+}
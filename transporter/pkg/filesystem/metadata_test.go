@@ -0,0 +1,94 @@
+package filesystem
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestGetMetadata(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	link := filepath.Join(dir, "link")
+	_ = os.WriteFile(file, []byte("hello"), 0640)
+	_ = os.Chmod(file, 0640)
+	_ = os.Symlink("file", link)
+
+	m, err := GetMetadata(file)
+	if err != nil {
+		t.Fatal("failed to get metadata:", err)
+	}
+	if m.Type != TypeFile || m.Size != 5 || m.Perm != "0640" || m.Mode != "-rw-r-----" || m.Nlink != 1 {
+		t.Error("unexpected metadata of file:", m)
+	}
+
+	m, err = GetMetadata(link)
+	if err != nil {
+		t.Fatal("failed to get metadata:", err)
+	}
+	if m.Type != TypeSymlink || m.SymlinkTarget != "file" {
+		t.Error("unexpected metadata of symlink:", m)
+	}
+
+	m, _ = GetMetadata(dir)
+	if m.Type != TypeDir {
+		t.Error("unexpected metadata of dir:", m)
+	}
+}
+
+func TestFormatACL(t *testing.T) {
+	raw := make([]byte, aclXattrHeaderSize)
+	binary.LittleEndian.PutUint32(raw, aclXattrVersion)
+	for _, entry := range []struct {
+		tag  uint16
+		perm uint16
+		id   uint32
+	}{
+		{aclUserObj, 6, 0xffffffff},
+		{aclUser, 4, 4242424},
+		{aclGroupObj, 4, 0xffffffff},
+		{aclMask, 5, 0xffffffff},
+		{aclOther, 0, 0xffffffff},
+	} {
+		b := make([]byte, aclXattrEntrySize)
+		binary.LittleEndian.PutUint16(b, entry.tag)
+		binary.LittleEndian.PutUint16(b[2:], entry.perm)
+		binary.LittleEndian.PutUint32(b[4:], entry.id)
+		raw = append(raw, b...)
+	}
+
+	acl := formatACL(string(raw))
+	expect := "user::rw-,user:" + strconv.Itoa(4242424) + ":r--,group::r--,mask::r-x,other::---"
+	if acl != expect {
+		t.Error("expect acl:", expect, "but get:", acl)
+	}
+
+	if encodeXattrValue("\x01\x02") != "0sAQI=" {
+		t.Error("binary value should be base64 encoded:", encodeXattrValue("\x01\x02"))
+	}
+}
+
+func TestSummarizeDir(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 5; i++ {
+		dir := filepath.Join(root, "d"+strconv.Itoa(i), "sub")
+		_ = os.MkdirAll(dir, 0755)
+		_ = os.WriteFile(filepath.Join(dir, "f"), make([]byte, i*10), 0644)
+	}
+	_ = os.Symlink("d0", filepath.Join(root, "link"))
+
+	summary, err := SummarizeDir(root, 2, 2)
+	if err != nil {
+		t.Fatal("failed to summarize dir:", err)
+	}
+
+	if summary.NumFile != 5 || summary.NumDir != 10 || summary.NumOther != 1 || summary.TotalSize != 100 {
+		t.Error("unexpected summary:", summary)
+	}
+
+	if len(summary.Largest) != 2 || summary.Largest[0].Size != 40 || summary.Largest[1].Size != 30 {
+		t.Error("unexpected largest files:", summary.Largest)
+	}
+}
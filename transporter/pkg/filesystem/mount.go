@@ -3,12 +3,13 @@ package filesystem
 import (
 	"errors"
 	"io/fs"
+	"log"
 	"strings"
 
 	"golang.org/x/sys/unix"
 )
 
-// Available mount filesystem
+// Available mount filesystem by default
 const (
 	NFS     = 0x6969
 	LUSTRE0 = 0x0BD00BD0
@@ -23,8 +24,15 @@ var fsList = []int64{
 
 var ErrUnavailableFileSystem = errors.New("unavailable filesystem")
 
+// IsAvailableFileSystem return true if filesystem type is allowed and not denied by the effective policy.
 func IsAvailableFileSystem(fsType int64) bool {
-	for _, avfstype := range fsList {
+	for _, denyType := range fsPolicy.Deny {
+		if fsType == denyType {
+			return false
+		}
+	}
+
+	for _, avfstype := range fsPolicy.Allow {
 		if fsType == avfstype {
 			return true
 		}
@@ -51,9 +59,10 @@ func IsMountPath(path string) error {
 		return err
 	}
 
+	log.Println("[Filesystem-Info]Path:", path, "filesystem type:", FSTypeName(fsInfo.Type))
 	isAvailableFS := IsAvailableFileSystem(fsInfo.Type)
 	if !isAvailableFS {
-		return ErrUnavailableFileSystem
+		return &FSTypeError{Path: path, Type: fsInfo.Type}
 	}
 
 	return nil
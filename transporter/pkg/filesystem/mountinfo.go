@@ -0,0 +1,266 @@
+package filesystem
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	mountInfoPath      = "/proc/self/mountinfo"
+	mountInfoSeparator = "-"
+	mountInfoFieldMin  = 10 // fields of line at least, include separator
+	sepMountOption     = ","
+	sepMajorMinor      = ":"
+)
+
+var (
+	ErrNotMountPoint       = errors.New("path is not a mount point")
+	ErrMountReplaced       = errors.New("mount point has been replaced")
+	ErrMountOptionMismatch = errors.New("option of mount point is not expected")
+	ErrMountInfoFormat     = errors.New("unavailable format of mountinfo")
+)
+
+// MountInfo is a line of /proc/self/mountinfo, for example:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - nfs 10.0.0.1:/export rw,hard,vers=3
+type MountInfo struct {
+	ID           int
+	ParentID     int
+	Major        uint32
+	Minor        uint32
+	Root         string
+	MountPoint   string
+	Options      []string // per mount options
+	FSType       string
+	Source       string
+	SuperOptions []string // per super block options
+}
+
+// MountExpect is expectation of mount point, empty value means not check.
+type MountExpect struct {
+	Source  string   // mount source, like: 10.0.0.1:/export
+	Options []string // each option should be found at mount options or super options, like: rw,hard
+}
+
+// ParseMountExpect return expectation of mount point, options format: rw,hard
+func ParseMountExpect(source, options string) MountExpect {
+	e := MountExpect{
+		Source: source,
+	}
+
+	for _, opt := range strings.Split(options, sepMountOption) {
+		opt = strings.TrimSpace(opt)
+		if len(opt) != 0 {
+			e.Options = append(e.Options, opt)
+		}
+	}
+
+	return e
+}
+
+// ParseMountInfo parse content format of /proc/self/mountinfo.
+func ParseMountInfo(r io.Reader) ([]MountInfo, error) {
+	var mounts []MountInfo
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < mountInfoFieldMin {
+			return nil, ErrMountInfoFormat
+		}
+
+		// optional fields end with separator
+		sepIndex := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == mountInfoSeparator {
+				sepIndex = i
+				break
+			}
+		}
+		if sepIndex < 0 || sepIndex+2 >= len(fields) {
+			return nil, ErrMountInfoFormat
+		}
+
+		var (
+			m   MountInfo
+			err error
+		)
+		m.ID, err = strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, ErrMountInfoFormat
+		}
+
+		m.ParentID, err = strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, ErrMountInfoFormat
+		}
+
+		majorMinor := strings.Split(fields[2], sepMajorMinor)
+		if len(majorMinor) != 2 {
+			return nil, ErrMountInfoFormat
+		}
+		major, err := strconv.ParseUint(majorMinor[0], 10, 32)
+		if err != nil {
+			return nil, ErrMountInfoFormat
+		}
+		minor, err := strconv.ParseUint(majorMinor[1], 10, 32)
+		if err != nil {
+			return nil, ErrMountInfoFormat
+		}
+		m.Major = uint32(major)
+		m.Minor = uint32(minor)
+
+		m.Root = unescapeMountInfo(fields[3])
+		m.MountPoint = unescapeMountInfo(fields[4])
+		m.Options = strings.Split(fields[5], sepMountOption)
+		m.FSType = fields[sepIndex+1]
+		m.Source = unescapeMountInfo(fields[sepIndex+2])
+		if sepIndex+3 < len(fields) {
+			m.SuperOptions = strings.Split(fields[sepIndex+3], sepMountOption)
+		}
+
+		mounts = append(mounts, m)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountInfo decode octal escape of space, tab, newline and backslash, like: \040
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			c, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// readMountInfo parse mountinfo of current process.
+func readMountInfo() ([]MountInfo, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseMountInfo(f)
+}
+
+// FindMountPoint return the visible mount of path, path must be the mount point.
+func FindMountPoint(path string) (MountInfo, error) {
+	mounts, err := readMountInfo()
+	if err != nil {
+		return MountInfo{}, err
+	}
+
+	// mount at the back hide the front one with same mount point
+	path = filepath.Clean(path)
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].MountPoint == path {
+			return mounts[i], nil
+		}
+	}
+
+	return MountInfo{}, fmt.Errorf("%w: %s", ErrNotMountPoint, path)
+}
+
+// FindMountByDevice return the last mount with the device number.
+func FindMountByDevice(major, minor uint32) (MountInfo, error) {
+	mounts, err := readMountInfo()
+	if err != nil {
+		return MountInfo{}, err
+	}
+
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].Major == major && mounts[i].Minor == minor {
+			return mounts[i], nil
+		}
+	}
+
+	return MountInfo{}, fmt.Errorf("%w: device %d:%d", ErrNotMountPoint, major, minor)
+}
+
+// VerifyMountPoint check path is a mount point at /proc/self/mountinfo and match the expectation.
+// Return ESTALE if mount is stale, ErrMountReplaced if device of path is not the mount
+// or source is not the expected one.
+func VerifyMountPoint(path string, expect MountExpect) error {
+	var (
+		st  unix.Stat_t
+		err error
+	)
+	for {
+		err = unix.Stat(path, &st)
+		if err == nil {
+			break
+		}
+
+		// We have to check EINTR here, per issues 11180 and 39237.
+		if err == unix.EINTR {
+			continue
+		}
+
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	m, err := FindMountPoint(path)
+	if err != nil {
+		return err
+	}
+
+	if unix.Major(st.Dev) != m.Major || unix.Minor(st.Dev) != m.Minor {
+		return fmt.Errorf("%w: device of %s is %d:%d but mount is %d:%d",
+			ErrMountReplaced, path, unix.Major(st.Dev), unix.Minor(st.Dev), m.Major, m.Minor)
+	}
+
+	if len(expect.Source) != 0 && m.Source != expect.Source {
+		return fmt.Errorf("%w: source of %s is %s but expect %s", ErrMountReplaced, path, m.Source, expect.Source)
+	}
+
+	for _, opt := range expect.Options {
+		if !containsStr(m.Options, opt) && !containsStr(m.SuperOptions, opt) {
+			return fmt.Errorf("%w: %s of %s, options: %s, super options: %s", ErrMountOptionMismatch, opt, path,
+				strings.Join(m.Options, sepMountOption), strings.Join(m.SuperOptions, sepMountOption))
+		}
+	}
+
+	return nil
+}
+
+func containsStr(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
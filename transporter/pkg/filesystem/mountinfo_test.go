@@ -0,0 +1,34 @@
+package filesystem
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	content := `23 28 0:22 / /proc rw,relatime - proc proc rw
+36 35 0:52 / /mnt/nfs\040data rw,noatime shared:1 master:2 - nfs 10.0.0.1:/export rw,hard,vers=3
+`
+	mounts, err := ParseMountInfo(strings.NewReader(content))
+	if err != nil {
+		t.Error("failed to parse mountinfo:", err)
+		t.FailNow()
+	}
+
+	if len(mounts) != 2 {
+		t.Error("expect 2 mounts, but get:", mounts)
+		t.FailNow()
+	}
+
+	m := mounts[1]
+	if m.ID != 36 || m.ParentID != 35 || m.Major != 0 || m.Minor != 52 ||
+		m.MountPoint != "/mnt/nfs data" || m.FSType != "nfs" || m.Source != "10.0.0.1:/export" ||
+		!containsStr(m.Options, "noatime") || !containsStr(m.SuperOptions, "hard") {
+		t.Error("unexpected mount:", m)
+	}
+
+	_, err = ParseMountInfo(strings.NewReader("23 28 0:22 / /proc rw,relatime proc proc rw\n"))
+	if err == nil {
+		t.Error("expect err of line without separator")
+	}
+}
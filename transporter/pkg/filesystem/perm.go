@@ -0,0 +1,235 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Type of permission policy
+const (
+	PermPreserve = "preserve" // exist path is not changed, new path is created with default permission under umask
+	PermEnforce  = "enforce"  // new and exist path are changed to mode of policy
+	PermInherit  = "inherit"  // new path is changed to permission of parent dir, exist path is not changed
+)
+
+// Operation of permission change
+const (
+	PermOpCreate = "create"
+	PermOpChmod  = "chmod"
+)
+
+const (
+	permPolicySep = ":"
+	permMask      = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	permExecBits  = 0111
+	permModeMax   = 07777
+)
+
+var ErrPermPolicy = errors.New("unavailable permission policy, must be preserve, inherit or enforce[:octal mode]")
+
+// PermPolicy is how permission of created or exist path is handled.
+type PermPolicy struct {
+	Type string
+	Mode os.FileMode // only for enforce
+}
+
+// PreservePolicy never change permission of exist path.
+var PreservePolicy = PermPolicy{Type: PermPreserve}
+
+// PermChange is a permission change made by policy.
+type PermChange struct {
+	Path    string `json:"path"`
+	Op      string `json:"op"`                 // create or chmod
+	Mode    string `json:"mode"`               // octal with special bits after change, like: 0755
+	OldMode string `json:"old_mode,omitempty"` // only for chmod
+}
+
+func (c PermChange) String() string {
+	if c.Op == PermOpChmod {
+		return fmt.Sprint(c.Op, " path: ", c.Path, " mode: ", c.OldMode, " -> ", c.Mode)
+	}
+	return fmt.Sprint(c.Op, " path: ", c.Path, " mode: ", c.Mode)
+}
+
+// ParsePermPolicy parse policy like: preserve, inherit, enforce or enforce:0750,
+// enforce without mode means 0775. Empty means preserve.
+func ParsePermPolicy(s string) (PermPolicy, error) {
+	policyType, modeStr, hasMode := s, "", false
+	if i := strings.Index(s, permPolicySep); i >= 0 {
+		policyType, modeStr, hasMode = s[:i], s[i+1:], true
+	}
+	switch policyType {
+	case "", PermPreserve, PermInherit:
+		if hasMode {
+			return PermPolicy{}, ErrPermPolicy
+		}
+		if len(policyType) == 0 {
+			return PreservePolicy, nil
+		}
+		return PermPolicy{Type: policyType}, nil
+
+	case PermEnforce:
+		if !hasMode {
+			return PermPolicy{Type: PermEnforce, Mode: permDirDefault}, nil
+		}
+
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil || mode > permModeMax {
+			return PermPolicy{}, ErrPermPolicy
+		}
+		return PermPolicy{Type: PermEnforce, Mode: fileModeOf(uint32(mode))}, nil
+	}
+
+	return PermPolicy{}, ErrPermPolicy
+}
+
+func (p PermPolicy) String() string {
+	if p.Type == PermEnforce {
+		return p.Type + permPolicySep + permOctal(p.Mode)
+	}
+	return p.Type
+}
+
+// PermOf return permission that path is changed to by policy, ok is false if permission is not changed.
+// Inherit keep setgid of parent for dir and drop exec bits for file, and it does nothing if parent
+// has default acl, because acl has been applied by kernel at create.
+func (p PermPolicy) PermOf(path string, isDir, isCreated bool) (perm os.FileMode, ok bool, err error) {
+	switch p.Type {
+	case PermEnforce:
+		return p.Mode, true, nil
+
+	case PermInherit:
+		if !isCreated {
+			return 0, false, nil
+		}
+
+		parent := filepath.Dir(path)
+		if hasDefaultACL(parent) {
+			return 0, false, nil
+		}
+
+		parentInfo, err := os.Stat(parent)
+		if err != nil {
+			return 0, false, err
+		}
+
+		perm = parentInfo.Mode() & (os.ModePerm | os.ModeSetgid)
+		if !isDir {
+			perm &^= permExecBits | os.ModeSetgid
+		}
+		return perm, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// applyPerm change permission of path by policy and append change to changes,
+// created path is always appended.
+func applyPerm(path string, isCreated bool, policy PermPolicy, changes *[]PermChange) error {
+	pInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	oldPerm := pInfo.Mode() & permMask
+	perm, ok, err := policy.PermOf(path, pInfo.IsDir(), isCreated)
+	if err != nil {
+		return err
+	}
+
+	if !ok || perm == oldPerm {
+		if isCreated {
+			*changes = append(*changes, PermChange{Path: path, Op: PermOpCreate, Mode: permOctal(oldPerm)})
+		}
+		return nil
+	}
+
+	err = os.Chmod(path, perm)
+	if err != nil {
+		return err
+	}
+
+	if isCreated {
+		*changes = append(*changes, PermChange{Path: path, Op: PermOpCreate, Mode: permOctal(perm)})
+	} else {
+		*changes = append(*changes, PermChange{Path: path, Op: PermOpChmod, Mode: permOctal(perm), OldMode: permOctal(oldPerm)})
+	}
+	return nil
+}
+
+// mkdirAll is same as os.MkdirAll, but each created dir is changed by policy.
+func mkdirAll(path string, policy PermPolicy, changes *[]PermChange) error {
+	pInfo, err := os.Stat(path)
+	if err == nil {
+		if !pInfo.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: path, Err: unix.ENOTDIR}
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	parent := filepath.Dir(path)
+	if parent != path {
+		err = mkdirAll(parent, policy, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Mkdir(path, permDirDefault)
+	if err != nil {
+		// created by others after stat
+		pInfo, statErr := os.Stat(path)
+		if statErr == nil && pInfo.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	return applyPerm(path, true, policy, changes)
+}
+
+// hasDefaultACL return true if dir has posix default acl.
+func hasDefaultACL(dirPath string) bool {
+	size, err := unix.Getxattr(dirPath, xattrACLDefault, nil)
+	return err == nil && size > 0
+}
+
+// permOctal return octal permission with special bits, like: 2775.
+func permOctal(perm os.FileMode) string {
+	mode := uint32(perm & os.ModePerm)
+	if perm&os.ModeSetuid != 0 {
+		mode |= unix.S_ISUID
+	}
+	if perm&os.ModeSetgid != 0 {
+		mode |= unix.S_ISGID
+	}
+	if perm&os.ModeSticky != 0 {
+		mode |= unix.S_ISVTX
+	}
+	return fmt.Sprintf("%04o", mode)
+}
+
+// fileModeOf convert unix permission with special bits to os.FileMode.
+func fileModeOf(mode uint32) os.FileMode {
+	perm := os.FileMode(mode) & os.ModePerm
+	if mode&unix.S_ISUID != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&unix.S_ISGID != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&unix.S_ISVTX != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm
+}
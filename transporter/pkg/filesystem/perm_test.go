@@ -0,0 +1,79 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePermPolicy(t *testing.T) {
+	for s, expect := range map[string]PermPolicy{
+		"":              PreservePolicy,
+		"preserve":      PreservePolicy,
+		"inherit":       {Type: PermInherit},
+		"enforce":       {Type: PermEnforce, Mode: 0775},
+		"enforce:2750":  {Type: PermEnforce, Mode: 0750 | os.ModeSetgid},
+		"enforce:0640":  {Type: PermEnforce, Mode: 0640},
+		"enforce:":      {},
+		"enforce:10000": {},
+		"inherit:0755":  {},
+		"chmod":         {},
+	} {
+		policy, err := ParsePermPolicy(s)
+		if len(expect.Type) == 0 {
+			if !errors.Is(err, ErrPermPolicy) {
+				t.Error("expect err of policy:", s, "but get:", policy, err)
+			}
+			continue
+		}
+
+		if err != nil || policy != expect {
+			t.Error("unexpected policy of:", s, "get:", policy, err)
+		}
+	}
+}
+
+func TestCheckOrCreateDirPolicy(t *testing.T) {
+	root := t.TempDir()
+	existPath := filepath.Join(root, "exist")
+	_ = os.Mkdir(existPath, 0700)
+	_ = os.Chmod(existPath, 0700)
+
+	changes, err := CheckOrCreateDir(existPath, PreservePolicy)
+	pInfo, _ := os.Stat(existPath)
+	if err != nil || len(changes) != 0 || pInfo.Mode().Perm() != 0700 {
+		t.Error("exist dir should be preserved:", changes, pInfo.Mode(), err)
+	}
+
+	changes, err = CheckOrCreateDir(existPath, PermPolicy{Type: PermEnforce, Mode: 0750})
+	pInfo, _ = os.Stat(existPath)
+	if err != nil || len(changes) != 1 || changes[0].Op != PermOpChmod || changes[0].OldMode != "0700" ||
+		pInfo.Mode().Perm() != 0750 {
+		t.Error("exist dir should be enforced:", changes, pInfo.Mode(), err)
+	}
+
+	// new dirs inherit setgid of parent, files drop exec bits
+	_ = os.Chmod(existPath, 0770|os.ModeSetgid)
+	policy := PermPolicy{Type: PermInherit}
+	changes, err = CheckOrCreateDir(filepath.Join(existPath, "a/b"), policy)
+	pInfo, _ = os.Stat(filepath.Join(existPath, "a/b"))
+	if err != nil || len(changes) != 2 || changes[1].Op != PermOpCreate || changes[1].Mode != "2770" ||
+		pInfo.Mode()&permMask != 0770|os.ModeSetgid {
+		t.Error("new dir should inherit parent:", changes, pInfo.Mode(), err)
+	}
+
+	filePath := filepath.Join(existPath, "a/file")
+	changes, err = CheckOrCreateFile(filePath, false, policy)
+	pInfo, _ = os.Stat(filePath)
+	if err != nil || len(changes) != 1 || pInfo.Mode()&permMask != 0660 {
+		t.Error("new file should inherit parent:", changes, pInfo.Mode(), err)
+	}
+
+	_ = os.Chmod(filePath, 0600)
+	changes, err = CheckOrCreateFile(filePath, false, policy)
+	pInfo, _ = os.Stat(filePath)
+	if err != nil || len(changes) != 0 || pInfo.Mode().Perm() != 0600 {
+		t.Error("exist file should not be changed by inherit:", changes, pInfo.Mode(), err)
+	}
+}
@@ -0,0 +1,363 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	removeWorkersDefault = 16
+	removeReadSize       = 1024
+	removeErrSampleLimit = 10
+	removeOpenFlag       = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+	removeParentOpenFlag = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_CLOEXEC
+)
+
+// RemoveReq is request of parallel remove.
+type RemoveReq struct {
+	Workers  int                    // max num of goroutines that remove dirs, <= 0 means default
+	Skip     func(path string) bool // path and its parent dirs are kept if it return true, nil means remove all
+	Progress *RemoveProgress        // updated during remove if not nil, it is safe to read by another goroutine
+}
+
+// RemoveProgress is progress of parallel remove, Found is estimated total num of entries,
+// it grows during walk because children of dir are found only after dir is read.
+type RemoveProgress struct {
+	Removed int64
+	Found   int64
+}
+
+// Load return num of removed entries and found entries.
+func (p *RemoveProgress) Load() (int64, int64) {
+	return atomic.LoadInt64(&p.Removed), atomic.LoadInt64(&p.Found)
+}
+
+func (p *RemoveProgress) add(removed, found int64) {
+	if p == nil {
+		return
+	}
+
+	if removed != 0 {
+		atomic.AddInt64(&p.Removed, removed)
+	}
+	if found != 0 {
+		atomic.AddInt64(&p.Found, found)
+	}
+}
+
+// RemoveError is aggregate err of parallel remove, entries failed to remove are kept and others are continued.
+type RemoveError struct {
+	NumFailed int            // num of entries failed to remove
+	NumByErr  map[string]int // num of failed entries by err message of errno
+	Samples   []error        // the first errs, limit by removeErrSampleLimit
+}
+
+func (e *RemoveError) Error() string {
+	keyList := make([]string, 0, len(e.NumByErr))
+	for key := range e.NumByErr {
+		keyList = append(keyList, key)
+	}
+	sort.Strings(keyList)
+
+	var summaryList []string
+	for _, key := range keyList {
+		summaryList = append(summaryList, key+": "+strconv.Itoa(e.NumByErr[key]))
+	}
+
+	msg := "failed to remove " + strconv.Itoa(e.NumFailed) + " entries, " + strings.Join(summaryList, ", ")
+	if len(e.Samples) != 0 {
+		msg += ", first err: " + e.Samples[0].Error()
+	}
+	return msg
+}
+
+// Unwrap return the first err, so exit code is converted by it.
+func (e *RemoveError) Unwrap() error {
+	if len(e.Samples) == 0 {
+		return nil
+	}
+	return e.Samples[0]
+}
+
+// RemoveAllParallel remove path and all its children like os.RemoveAll,
+// dirs are walked by bounded goroutines and entries are removed by unlinkat relative to fd of parent dir,
+// return nil if path is not exist, or *RemoveError that summary all failed entries.
+func RemoveAllParallel(path string, req RemoveReq) error {
+	return newRemover(req).removePath(filepath.Clean(path), false)
+}
+
+// RemoveChildrenParallel remove all children of dir like RemoveAllParallel, dir is kept.
+func RemoveChildrenParallel(path string, req RemoveReq) error {
+	return newRemover(req).removePath(filepath.Clean(path), true)
+}
+
+// RemoveAllParallelAt remove entry that named name at parent dir of fd like RemoveAllParallel,
+// path is used by log and Skip of request only, fd is kept open.
+func RemoveAllParallelAt(parentFd int, name, path string, req RemoveReq) error {
+	return newRemover(req).removePathAt(parentFd, name, filepath.Clean(path), false)
+}
+
+// RemoveChildrenParallelAt remove all children of dir that named name at parent dir of fd like
+// RemoveChildrenParallel, path is used by log and Skip of request only, fd is kept open.
+func RemoveChildrenParallelAt(parentFd int, name, path string, req RemoveReq) error {
+	return newRemover(req).removePathAt(parentFd, name, filepath.Clean(path), true)
+}
+
+type remover struct {
+	req    RemoveReq
+	sem    chan struct{}
+	mu     sync.Mutex
+	errSum RemoveError
+}
+
+func newRemover(req RemoveReq) *remover {
+	if req.Workers <= 0 {
+		req.Workers = removeWorkersDefault
+	}
+
+	return &remover{
+		req: req,
+		// current goroutine is a worker too
+		sem:    make(chan struct{}, req.Workers-1),
+		errSum: RemoveError{NumByErr: map[string]int{}},
+	}
+}
+
+func (r *remover) removePath(path string, isKeepSelf bool) error {
+	if endsWithDot(path) {
+		return &os.PathError{Op: "remove", Path: path, Err: unix.EINVAL}
+	}
+
+	parentFd, err := unix.Open(filepath.Dir(path), removeParentOpenFlag, 0)
+	if err != nil {
+		if err == unix.ENOENT {
+			return nil
+		}
+		return &os.PathError{Op: "open", Path: filepath.Dir(path), Err: err}
+	}
+	defer unix.Close(parentFd)
+
+	return r.removePathAt(parentFd, filepath.Base(path), path, isKeepSelf)
+}
+
+func (r *remover) removePathAt(parentFd int, name, path string, isKeepSelf bool) error {
+	if endsWithDot(name) {
+		return &os.PathError{Op: "remove", Path: path, Err: unix.EINVAL}
+	}
+
+	var st unix.Stat_t
+	err := unix.Fstatat(parentFd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		if err == unix.ENOENT {
+			return nil
+		}
+		return &os.PathError{Op: "fstatat", Path: path, Err: err}
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		if isKeepSelf {
+			return &os.PathError{Op: "remove", Path: path, Err: unix.ENOTDIR}
+		}
+
+		err = unix.Unlinkat(parentFd, name, 0)
+		if err != nil && err != unix.ENOENT {
+			return &os.PathError{Op: "unlinkat", Path: path, Err: err}
+		}
+		r.req.Progress.add(1, 1)
+		return nil
+	}
+
+	if !isKeepSelf {
+		r.req.Progress.add(0, 1)
+	}
+
+	_ = r.removeDir(parentFd, name, path, isKeepSelf)
+	if r.errSum.NumFailed != 0 {
+		return &r.errSum
+	}
+	return nil
+}
+
+// removeDir remove dir that named name at parent dir, return true if all children are removed.
+// Dir is read again after a pass if any entry is removed and it is not read at once,
+// because removing entries while reading may cause filesystem to skip some entries.
+func (r *remover) removeDir(parentFd int, name, path string, isKeepSelf bool) bool {
+	var (
+		failedNames = map[string]bool{}
+		isComplete  = true
+		numRemoved  int
+		numRead     int
+	)
+
+	for {
+		fd, err := unix.Openat(parentFd, name, removeOpenFlag, 0)
+		if err != nil {
+			if err == unix.ENOENT {
+				return true
+			}
+			r.addErr(&os.PathError{Op: "open", Path: path, Err: err})
+			return false
+		}
+
+		numRemoved, numRead, err = r.removeEntries(fd, path, failedNames)
+		unix.Close(fd)
+		if err != nil {
+			r.addErr(&os.PathError{Op: "readdirent", Path: path, Err: err})
+			return false
+		}
+
+		if numRemoved == 0 || numRead < removeReadSize {
+			break
+		}
+	}
+
+	if len(failedNames) != 0 {
+		isComplete = false
+	}
+
+	if !isComplete || isKeepSelf {
+		return isComplete
+	}
+
+	err := unix.Unlinkat(parentFd, name, unix.AT_REMOVEDIR)
+	if err != nil && err != unix.ENOENT {
+		r.addErr(&os.PathError{Op: "unlinkat", Path: path, Err: err})
+		return false
+	}
+
+	r.req.Progress.add(1, 0)
+	return true
+}
+
+// removeEntries read all entries of dir and remove them, entries at failedNames are skipped,
+// entries that failed or skipped are added to failedNames. Return num of removed entries and read entries.
+func (r *remover) removeEntries(fd int, path string, failedNames map[string]bool) (int, int, error) {
+	// dup fd, because fd is closed by file
+	dupFd, err := unix.Dup(fd)
+	if err != nil {
+		return 0, 0, err
+	}
+	dirF := os.NewFile(uintptr(dupFd), path)
+	defer dirF.Close()
+
+	var (
+		numRemoved int
+		numRead    int
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		entryList  []fs.DirEntry
+	)
+
+	for {
+		entryList, err = dirF.ReadDir(removeReadSize)
+		numRead += len(entryList)
+		for _, entry := range entryList {
+			childName := entry.Name()
+			mu.Lock()
+			isFailed := failedNames[childName]
+			mu.Unlock()
+			if isFailed {
+				continue
+			}
+
+			childPath := path + string(filepath.Separator) + childName
+			if r.req.Skip != nil && r.req.Skip(childPath) {
+				mu.Lock()
+				failedNames[childName] = true
+				mu.Unlock()
+				continue
+			}
+			r.req.Progress.add(0, 1)
+
+			if !entry.IsDir() {
+				errUnlink := unix.Unlinkat(fd, childName, 0)
+				mu.Lock()
+				if errUnlink != nil && errUnlink != unix.ENOENT {
+					failedNames[childName] = true
+				} else {
+					numRemoved++
+				}
+				mu.Unlock()
+
+				if errUnlink != nil && errUnlink != unix.ENOENT {
+					r.addErr(&os.PathError{Op: "unlinkat", Path: childPath, Err: errUnlink})
+					continue
+				}
+				r.req.Progress.add(1, 0)
+				continue
+			}
+
+			removeChild := func() {
+				isRemoved := r.removeDir(fd, childName, childPath, false)
+				mu.Lock()
+				if isRemoved {
+					numRemoved++
+				} else {
+					failedNames[childName] = true
+				}
+				mu.Unlock()
+			}
+
+			select {
+			case r.sem <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer func() {
+						<-r.sem
+						wg.Done()
+					}()
+					removeChild()
+				}()
+			default:
+				removeChild()
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+	wg.Wait()
+
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return numRemoved, numRead, err
+}
+
+func (r *remover) addErr(err error) {
+	var errMsg string = err.Error()
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		errMsg = errno.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errSum.NumFailed++
+	r.errSum.NumByErr[errMsg]++
+	if len(r.errSum.Samples) < removeErrSampleLimit {
+		r.errSum.Samples = append(r.errSum.Samples, err)
+	}
+}
+
+// endsWithDot reports whether the final component of path is ".".
+func endsWithDot(path string) bool {
+	if path == "." {
+		return true
+	}
+	if len(path) >= 2 && path[len(path)-1] == '.' && os.IsPathSeparator(path[len(path)-2]) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func makeTree(t *testing.T, root string, numDir, numFile int) int {
+	var num int
+	for i := 0; i < numDir; i++ {
+		dir := filepath.Join(root, "d"+strconv.Itoa(i), "sub")
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal("failed to create dir:", err)
+		}
+		num += 2
+
+		for j := 0; j < numFile; j++ {
+			_ = os.WriteFile(filepath.Join(dir, "f"+strconv.Itoa(j)), nil, 0644)
+			num++
+		}
+	}
+	return num
+}
+
+func TestRemoveAllParallel(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	num := makeTree(t, root, 20, 1500)
+
+	var progress RemoveProgress
+	err := RemoveAllParallel(root, RemoveReq{Workers: 4, Progress: &progress})
+	if err != nil {
+		t.Fatal("failed to remove:", err)
+	}
+
+	_, err = os.Lstat(root)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("root should be removed, but get:", err)
+	}
+
+	removed, found := progress.Load()
+	if removed != int64(num+1) || found != removed {
+		t.Error("unexpected progress, removed:", removed, "found:", found, "expect:", num+1)
+	}
+
+	err = RemoveAllParallel(root, RemoveReq{})
+	if err != nil {
+		t.Error("not exist path should be ignored, but get:", err)
+	}
+}
+
+func TestRemoveChildrenParallel(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	makeTree(t, root, 3, 10)
+	keep := filepath.Join(root, "d1", "sub", "f5")
+
+	err := RemoveChildrenParallel(root, RemoveReq{Skip: func(path string) bool {
+		return path == keep
+	}})
+	if err != nil {
+		t.Fatal("failed to remove:", err)
+	}
+
+	_, err = os.Lstat(keep)
+	if err != nil {
+		t.Error("skipped path should be kept, but get:", err)
+	}
+
+	for _, name := range []string{"d0", "d2"} {
+		_, err = os.Lstat(filepath.Join(root, name))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error("dir:", name, "should be removed, but get:", err)
+		}
+	}
+
+	err = RemoveChildrenParallel(keep, RemoveReq{})
+	if !errors.Is(err, unix.ENOTDIR) {
+		t.Error("expect not dir err, but get:", err)
+	}
+}
+
+func TestRemoveError(t *testing.T) {
+	e := &RemoveError{NumByErr: map[string]int{}}
+	if e.Unwrap() != nil {
+		t.Error("empty err should unwrap to nil")
+	}
+
+	e.NumFailed = 2
+	e.NumByErr[unix.EACCES.Error()] = 2
+	e.Samples = append(e.Samples, &os.PathError{Op: "unlinkat", Path: "/a", Err: unix.EACCES})
+	if !errors.Is(e, fs.ErrPermission) {
+		t.Error("err should be permission err:", e)
+	}
+}
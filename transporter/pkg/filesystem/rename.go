@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// RenameNoReplace rename old path to new path, fail with EEXIST if new path is exist,
+// check and rename is atomic by renameat2(RENAME_NOREPLACE).
+// If filesystem reject the flag(like NFS), fallback to link new path and unlink old path,
+// link is also atomic and fail if new path is exist. Dir is not able to be linked,
+// so dir is renamed after check at last, rename only replace an empty dir.
+func RenameNoReplace(oldPath, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_NOREPLACE)
+	if err == nil {
+		return nil
+	}
+
+	if !isRenameFlagUnsupported(err) {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	log.Println("[filesystem-Warning]Rename with no replace is unsupported, err:", err.Error(),
+		"fallback to link and unlink, old:", oldPath, "new:", newPath)
+	err = unix.Link(oldPath, newPath)
+	if err == nil {
+		err = unix.Unlink(oldPath)
+		if err != nil {
+			_ = unix.Unlink(newPath)
+			return &os.PathError{Op: "unlink", Path: oldPath, Err: err}
+		}
+		return nil
+	}
+
+	// EPERM: old path is dir or filesystem does not support hard link
+	if err != unix.EPERM && err != unix.EOPNOTSUPP && err != unix.EMLINK {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: err}
+	}
+
+	_, err = os.Lstat(newPath)
+	if err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: unix.EEXIST}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+// RenameExchange swap old path and new path atomically by renameat2(RENAME_EXCHANGE),
+// both must be exist. Return err that IsRenameExchangeUnsupported is true if filesystem reject the flag.
+func RenameExchange(oldPath, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_EXCHANGE)
+	if err != nil {
+		return &os.LinkError{Op: "exchange", Old: oldPath, New: newPath, Err: err}
+	}
+
+	return nil
+}
+
+// IsRenameExchangeUnsupported return true if err of RenameExchange means exchange is not able to be done
+// by filesystem, and nothing is changed.
+func IsRenameExchangeUnsupported(err error) bool {
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) {
+		return false
+	}
+
+	return isRenameFlagUnsupported(linkErr.Err) || linkErr.Err == unix.EXDEV
+}
+
+// isRenameFlagUnsupported return true if renameat2 is not available or flag is rejected by filesystem.
+func isRenameFlagUnsupported(err error) bool {
+	return err == unix.EINVAL || err == unix.ENOSYS || err == unix.EOPNOTSUPP
+}
@@ -0,0 +1,74 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	_ = os.WriteFile(src, []byte("src"), 0644)
+	_ = os.WriteFile(dest, []byte("old"), 0644)
+
+	err := RenameNoReplace(src, dest)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Error("expect exist err, but get:", err)
+	}
+
+	content, _ := os.ReadFile(dest)
+	if string(content) != "old" {
+		t.Error("exist dest should not be replaced, but get:", string(content))
+	}
+
+	newPath := filepath.Join(dir, "new.txt")
+	err = RenameNoReplace(src, newPath)
+	if err != nil {
+		t.Error("failed to rename to not exist path:", err)
+	}
+
+	_, err = os.Lstat(src)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("src should be renamed, but get:", err)
+	}
+}
+
+func TestConflictResultReplace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dest := filepath.Join(dir, "dest.txt")
+	_ = os.WriteFile(src, []byte("src"), 0644)
+	_ = os.WriteFile(dest, []byte("old"), 0644)
+
+	p, _ := ParseConflictPolicy(ConflictBackup, "")
+	r, _ := p.Resolve(src, dest)
+	err := r.Replace(src)
+	if err != nil {
+		t.Fatal("failed to replace with backup:", err)
+	}
+
+	content, _ := os.ReadFile(dest)
+	backup, _ := os.ReadFile(r.BackupPath)
+	if string(content) != "src" || string(backup) != "old" {
+		t.Error("unexpected content of dest:", string(content), "backup:", string(backup))
+	}
+
+	_, err = os.Lstat(src)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("src should be renamed, but get:", err)
+	}
+
+	// dest is created after resolve
+	_ = os.WriteFile(src, []byte("src"), 0644)
+	newPath := filepath.Join(dir, "new.txt")
+	r, _ = p.Resolve(src, newPath)
+	_ = os.WriteFile(newPath, []byte("new"), 0644)
+	err = r.Replace(src)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Error("expect exist err, but get:", err)
+	}
+}
@@ -0,0 +1,292 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// quotactl and ioctl of project id that not defined by x/sys
+const (
+	qGetQuota       = 0x800007
+	qSubCmdShift    = 8
+	qSubCmdMask     = 0x00ff
+	usrQuota        = 0
+	prjQuota        = 2
+	qifDQBlkSize    = 1024
+	fsIOCFSGetXattr = 0x801c581f
+
+	devPrefix        = "/dev/"
+	percentMax       = 100
+	QuotaTypeUser    = "user"
+	QuotaTypeProject = "project"
+	opSpacePreflight = "preflight"
+)
+
+// ifDQBlk is struct if_dqblk of quotactl
+type ifDQBlk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	_          uint32
+}
+
+// fsXattr is struct fsxattr of ioctl FS_IOC_FSGETXATTR
+type fsXattr struct {
+	XFlags     uint32
+	ExtSize    uint32
+	NExtents   uint32
+	ProjID     uint32
+	CowExtSize uint32
+	Pad        [8]byte
+}
+
+// SpaceInfo is available space of filesystem and quota that a path at.
+type SpaceInfo struct {
+	Path           string // exist path that space is got from
+	FSType         string // type of filesystem, empty if mount is not found
+	Free           uint64 // available bytes of filesystem for unprivileged user
+	IsQuotaSkipped bool   // quota is not queried, because source of mount is not a local block device
+	IsQuota        bool   // quota is limited
+	QuotaFree      uint64 // available bytes of the most limited quota
+	QuotaType      string // type of the most limited quota: user, project
+}
+
+// SpaceRequired return size that add safety margin in percent.
+func SpaceRequired(size uint64, marginPercent int) uint64 {
+	if marginPercent <= 0 {
+		return size
+	}
+
+	return size + size/percentMax*uint64(marginPercent) + size%percentMax*uint64(marginPercent)/percentMax
+}
+
+// PathSize return size of regular file, or total size of regular files beneath dir, symlink is not followed.
+func PathSize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// file vanished during walk
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		size += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// PathSizeToCopy return size of regular files of src like PathSize, but skip file that already present at dest
+// with the same size, it is copied by a previous run. dest is the path that src is copied to.
+func PathSizeToCopy(src, dest string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// file vanished during walk
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		destInfo, err := os.Lstat(filepath.Join(dest, rel))
+		if err == nil && destInfo.Mode().IsRegular() && destInfo.Size() == info.Size() {
+			return nil
+		}
+
+		size += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// AvailableSpace return available space of filesystem and quota of path,
+// if path is not exist, the nearest exist parent is used.
+// Quota is got only if source of mount is block device, and failure of quota is ignored.
+// Quota of network filesystem, like: nfs, lustre, is kept by server and not able to be got by quotactl
+// of local device, so it is skipped and IsQuotaSkipped is set, only free space of filesystem is checked.
+func AvailableSpace(path string) (SpaceInfo, error) {
+	path = filepath.Clean(path)
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) || path == slashStr {
+			return SpaceInfo{}, err
+		}
+		path = filepath.Dir(path)
+	}
+
+	info := SpaceInfo{
+		Path: path,
+	}
+
+	var (
+		fsInfo unix.Statfs_t
+		err    error
+	)
+	for {
+		err = unix.Statfs(path, &fsInfo)
+		if err == nil {
+			break
+		}
+
+		// We have to check EINTR here, per issues 11180 and 39237.
+		if err == unix.EINTR {
+			continue
+		}
+
+		return SpaceInfo{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	info.Free = fsInfo.Bavail * uint64(fsInfo.Bsize)
+
+	m, ok := mountOf(path)
+	if !ok {
+		info.IsQuotaSkipped = true
+		return info, nil
+	}
+
+	info.FSType = m.FSType
+	if !strings.HasPrefix(m.Source, devPrefix) {
+		info.IsQuotaSkipped = true
+		return info, nil
+	}
+	device := m.Source
+
+	quotaFree, ok := quotaFreeOf(device, usrQuota, uint32(os.Geteuid()))
+	if ok {
+		info.IsQuota = true
+		info.QuotaFree = quotaFree
+		info.QuotaType = QuotaTypeUser
+	}
+
+	projID, ok := projectID(path)
+	if !ok || projID == 0 {
+		return info, nil
+	}
+
+	quotaFree, ok = quotaFreeOf(device, prjQuota, projID)
+	if ok && (!info.IsQuota || quotaFree < info.QuotaFree) {
+		info.IsQuota = true
+		info.QuotaFree = quotaFree
+		info.QuotaType = QuotaTypeProject
+	}
+
+	return info, nil
+}
+
+// Check return ENOSPC if free space of filesystem is less than size, EDQUOT if quota is less than size.
+func (s SpaceInfo) Check(size uint64) error {
+	if size > s.Free {
+		return &os.PathError{Op: opSpacePreflight, Path: s.Path, Err: unix.ENOSPC}
+	}
+
+	if s.IsQuota && size > s.QuotaFree {
+		return &os.PathError{Op: opSpacePreflight, Path: s.Path, Err: unix.EDQUOT}
+	}
+
+	return nil
+}
+
+// mountOf return mount that path at.
+func mountOf(path string) (MountInfo, bool) {
+	var st unix.Stat_t
+	err := unix.Stat(path, &st)
+	if err != nil {
+		return MountInfo{}, false
+	}
+
+	m, err := FindMountByDevice(unix.Major(st.Dev), unix.Minor(st.Dev))
+	if err != nil {
+		return MountInfo{}, false
+	}
+
+	return m, true
+}
+
+// quotaFreeOf return available bytes of quota, return false if quota is not enabled or not limited.
+func quotaFreeOf(device string, quotaType int, id uint32) (uint64, bool) {
+	devicePtr, err := unix.BytePtrFromString(device)
+	if err != nil {
+		return 0, false
+	}
+
+	var dq ifDQBlk
+	cmd := qGetQuota<<qSubCmdShift | quotaType&qSubCmdMask
+	_, _, errno := unix.Syscall6(unix.SYS_QUOTACTL, uintptr(cmd), uintptr(unsafe.Pointer(devicePtr)),
+		uintptr(id), uintptr(unsafe.Pointer(&dq)), 0, 0)
+	if errno != 0 || dq.BHardLimit == 0 {
+		return 0, false
+	}
+
+	limit := dq.BHardLimit * qifDQBlkSize
+	if dq.CurSpace >= limit {
+		return 0, true
+	}
+
+	return limit - dq.CurSpace, true
+}
+
+// projectID return project id of path, return false if filesystem not support.
+func projectID(path string) (uint32, bool) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return 0, false
+	}
+	defer unix.Close(fd)
+
+	var attr fsXattr
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), fsIOCFSGetXattr, uintptr(unsafe.Pointer(&attr)))
+	if errno != 0 {
+		return 0, false
+	}
+
+	return attr.ProjID, true
+}
@@ -0,0 +1,96 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSpaceRequired(t *testing.T) {
+	cases := [][3]uint64{{1000, 0, 1000}, {1000, 10, 1100}, {150, 50, 225}, {7, 100, 14}}
+	for _, c := range cases {
+		required := SpaceRequired(c[0], int(c[1]))
+		if required != c[2] {
+			t.Error("size:", c[0], "margin:", c[1], "expect:", c[2], "but get:", required)
+		}
+	}
+}
+
+func TestPathSizeAndCheck(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	if err != nil {
+		t.Error("failed to create dir:", err)
+		t.FailNow()
+	}
+
+	for name, size := range map[string]int{"a": 10, "sub/b": 20} {
+		err = os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644)
+		if err != nil {
+			t.Error("failed to write file:", err)
+			t.FailNow()
+		}
+	}
+
+	err = os.Symlink("a", filepath.Join(dir, "link"))
+	if err != nil {
+		t.Error("failed to create symlink:", err)
+		t.FailNow()
+	}
+
+	size, err := PathSize(dir)
+	if err != nil || size != 30 {
+		t.Error("expect size: 30, but get:", size, err)
+	}
+
+	info, err := AvailableSpace(filepath.Join(dir, "not", "exist"))
+	if err != nil || info.Path != dir {
+		t.Error("expect space of:", dir, "but get:", info, err)
+		t.FailNow()
+	}
+
+	err = SpaceInfo{Path: dir, Free: 10}.Check(11)
+	if !errors.Is(err, unix.ENOSPC) {
+		t.Error("expect ENOSPC, but get:", err)
+	}
+
+	err = SpaceInfo{Path: dir, Free: 100, IsQuota: true, QuotaFree: 10}.Check(11)
+	if !errors.Is(err, unix.EDQUOT) {
+		t.Error("expect EDQUOT, but get:", err)
+	}
+}
+
+func TestPathSizeToCopy(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+
+	for name, size := range map[string]int{"a": 10, "b": 20, "c": 40} {
+		err := os.WriteFile(filepath.Join(src, name), make([]byte, size), 0644)
+		if err != nil {
+			t.Error("failed to write file:", err)
+			t.FailNow()
+		}
+	}
+
+	// a is copied by previous run, b is partial
+	for name, size := range map[string]int{"a": 10, "b": 5} {
+		err := os.WriteFile(filepath.Join(dest, name), make([]byte, size), 0644)
+		if err != nil {
+			t.Error("failed to write file:", err)
+			t.FailNow()
+		}
+	}
+
+	size, err := PathSizeToCopy(src, dest)
+	if err != nil || size != 60 {
+		t.Error("expect size to copy: 60, but get:", size, err)
+	}
+
+	size, err = PathSizeToCopy(filepath.Join(src, "a"), filepath.Join(dest, "a"))
+	if err != nil || size != 0 {
+		t.Error("expect size of copied file: 0, but get:", size, err)
+	}
+}
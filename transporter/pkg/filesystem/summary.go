@@ -0,0 +1,164 @@
+package filesystem
+
+import (
+	"container/heap"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	summaryWorkersDefault = 16
+	summaryTopDefault     = 10
+)
+
+// FileSize is size of a file at summary.
+type FileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DirSummary is summary of all entries beneath a dir, dir itself is not counted, symlink is not followed.
+type DirSummary struct {
+	NumFile   int64      `json:"num_file"`
+	NumDir    int64      `json:"num_dir"`
+	NumOther  int64      `json:"num_other"`  // symlink, socket, device, etc.
+	TotalSize int64      `json:"total_size"` // bytes of regular files
+	Largest   []FileSize `json:"largest"`    // the largest regular files, order by size desc
+	NumFailed int64      `json:"num_failed"` // num of dirs or entries failed to read, they are not counted
+}
+
+// fileSizeHeap is min heap of file size, it keep the largest files.
+type fileSizeHeap []FileSize
+
+func (h fileSizeHeap) Len() int            { return len(h) }
+func (h fileSizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h fileSizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileSizeHeap) Push(x interface{}) { *h = append(*h, x.(FileSize)) }
+func (h *fileSizeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (h *fileSizeHeap) add(f FileSize, limit int) {
+	if h.Len() < limit {
+		heap.Push(h, f)
+		return
+	}
+
+	if limit > 0 && (*h)[0].Size < f.Size {
+		(*h)[0] = f
+		heap.Fix(h, 0)
+	}
+}
+
+type summaryWalker struct {
+	topN    int
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	summary DirSummary
+	largest fileSizeHeap
+}
+
+// SummarizeDir walk dir with bounded goroutines, return counts, total size and the largest topN files.
+// Entries failed to read are counted at NumFailed and others are continued,
+// err is returned only if dir is not able to be read.
+func SummarizeDir(path string, workers, topN int) (DirSummary, error) {
+	if workers <= 0 {
+		workers = summaryWorkersDefault
+	}
+	if topN < 0 {
+		topN = summaryTopDefault
+	}
+
+	path = filepath.Clean(path)
+	entryList, err := os.ReadDir(path)
+	if err != nil {
+		return DirSummary{}, err
+	}
+
+	w := &summaryWalker{
+		topN: topN,
+		// current goroutine is a worker too
+		sem: make(chan struct{}, workers-1),
+	}
+	w.walkEntries(path, entryList)
+	w.wg.Wait()
+
+	w.summary.Largest = append([]FileSize{}, w.largest...)
+	sort.Slice(w.summary.Largest, func(i, j int) bool {
+		return w.summary.Largest[i].Size > w.summary.Largest[j].Size
+	})
+	return w.summary, nil
+}
+
+func (w *summaryWalker) walkDir(path string) {
+	entryList, err := os.ReadDir(path)
+	if err != nil {
+		w.mu.Lock()
+		w.summary.NumFailed++
+		w.mu.Unlock()
+	}
+
+	// entries read before err are counted
+	w.walkEntries(path, entryList)
+}
+
+// walkEntries count entries of dir, sub dirs are walked by new goroutine if pool is not full,
+// otherwise walked by current goroutine. Counts are merged once per dir.
+func (w *summaryWalker) walkEntries(path string, entryList []os.DirEntry) {
+	var (
+		local   DirSummary
+		largest fileSizeHeap
+	)
+	for _, entry := range entryList {
+		childPath := filepath.Join(path, entry.Name())
+		if entry.IsDir() {
+			local.NumDir++
+			select {
+			case w.sem <- struct{}{}:
+				w.wg.Add(1)
+				go func() {
+					defer func() {
+						<-w.sem
+						w.wg.Done()
+					}()
+					w.walkDir(childPath)
+				}()
+			default:
+				w.walkDir(childPath)
+			}
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			local.NumOther++
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			local.NumFailed++
+			continue
+		}
+
+		local.NumFile++
+		local.TotalSize += info.Size()
+		largest.add(FileSize{Path: childPath, Size: info.Size()}, w.topN)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.summary.NumFile += local.NumFile
+	w.summary.NumDir += local.NumDir
+	w.summary.NumOther += local.NumOther
+	w.summary.TotalSize += local.TotalSize
+	w.summary.NumFailed += local.NumFailed
+	for _, f := range largest {
+		w.largest.add(f, w.topN)
+	}
+}
@@ -0,0 +1,117 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Mode of cache busting before stat, to make NFS client revalidate attribute cache of parent dir
+const (
+	CacheBustNone       = "none"
+	CacheBustOpenParent = "open-parent" // open and close parent dir, close-to-open consistency revalidate it
+	CacheBustListParent = "list-parent" // list entry of parent dir, also refresh dentry cache of it
+)
+
+const (
+	waitIntervalDefault      = 5 * time.Second
+	waitAttemptsDefault      = 5
+	waitIntervalQuickDefault = 1 * time.Second
+	waitAttemptsQuickDefault = 2
+)
+
+var ErrCacheBustMode = errors.New("unavailable cache bust mode, must be none, open-parent or list-parent")
+
+// WaitPolicy decide how to wait NFS client update attribute cache if path is not exist,
+// path is stat at most Attempts times and wait Interval between each stat.
+type WaitPolicy struct {
+	Interval  time.Duration
+	Attempts  int
+	CacheBust string
+}
+
+// NewWaitPolicy return policy that wait long enough for NFS client cache update,
+// it is used if path should be exist.
+func NewWaitPolicy() WaitPolicy {
+	return WaitPolicy{
+		Interval:  waitIntervalDefault,
+		Attempts:  waitAttemptsDefault,
+		CacheBust: CacheBustNone,
+	}
+}
+
+// NewQuickWaitPolicy return policy that bust cache and retry once quickly,
+// it is used if path is allowed to be not exist.
+func NewQuickWaitPolicy() WaitPolicy {
+	return WaitPolicy{
+		Interval:  waitIntervalQuickDefault,
+		Attempts:  waitAttemptsQuickDefault,
+		CacheBust: CacheBustListParent,
+	}
+}
+
+// Override return policy that override by flag, negative number or empty string means not override.
+func (p WaitPolicy) Override(intervalSecond, attempts int, cacheBust string) (WaitPolicy, error) {
+	if intervalSecond >= 0 {
+		p.Interval = time.Duration(intervalSecond) * time.Second
+	}
+
+	if attempts >= 0 {
+		p.Attempts = attempts
+	}
+
+	if len(cacheBust) != 0 {
+		switch cacheBust {
+		case CacheBustNone, CacheBustOpenParent, CacheBustListParent:
+			p.CacheBust = cacheBust
+		default:
+			return p, ErrCacheBustMode
+		}
+	}
+
+	return p, nil
+}
+
+// Stat stat path follow the policy, retry only if path is not exist.
+// Return file info, number of retry and err of the last stat.
+func (p WaitPolicy) Stat(path string) (os.FileInfo, int, error) {
+	var (
+		info     os.FileInfo
+		err      error
+		retryNum int
+	)
+	for {
+		p.bustCache(path)
+		info, err = os.Stat(path)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return info, retryNum, err
+		}
+
+		if retryNum+1 >= p.Attempts {
+			return nil, retryNum, err
+		}
+
+		time.Sleep(p.Interval)
+		retryNum += 1
+	}
+}
+
+// bustCache make NFS client revalidate parent dir of path, failure is ignored
+// because stat after it will report the real err.
+func (p WaitPolicy) bustCache(path string) {
+	if p.CacheBust != CacheBustOpenParent && p.CacheBust != CacheBustListParent {
+		return
+	}
+
+	parent, err := os.Open(filepath.Dir(filepath.Clean(path)))
+	if err != nil {
+		return
+	}
+	defer parent.Close()
+
+	if p.CacheBust == CacheBustListParent {
+		_, _ = parent.Readdirnames(-1)
+	}
+}
@@ -0,0 +1,38 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitPolicy(t *testing.T) {
+	p, err := NewWaitPolicy().Override(0, 3, CacheBustListParent)
+	if err != nil || p.Interval != 0 || p.Attempts != 3 || p.CacheBust != CacheBustListParent {
+		t.Error("unexpected policy:", p, err)
+	}
+
+	_, err = NewWaitPolicy().Override(-1, -1, "unknown")
+	if !errors.Is(err, ErrCacheBustMode) {
+		t.Error("expect err of cache bust mode, but get:", err)
+	}
+
+	p, _ = NewQuickWaitPolicy().Override(-1, -1, "")
+	if p.Interval != waitIntervalQuickDefault || p.Attempts != waitAttemptsQuickDefault {
+		t.Error("policy should not be overridden:", p)
+	}
+
+	dir := t.TempDir()
+	p = WaitPolicy{Interval: time.Millisecond, Attempts: 3, CacheBust: CacheBustOpenParent}
+	_, retryNum, err := p.Stat(filepath.Join(dir, "not-exist"))
+	if !errors.Is(err, fs.ErrNotExist) || retryNum != 2 {
+		t.Error("expect ENOENT after 2 retry, but get:", retryNum, err)
+	}
+
+	info, retryNum, err := p.Stat(dir)
+	if err != nil || retryNum != 0 || !info.IsDir() {
+		t.Error("expect exist dir without retry, but get:", retryNum, err)
+	}
+}
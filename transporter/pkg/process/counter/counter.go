@@ -0,0 +1,77 @@
+package counter
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+
+	"transporter/pkg/process/id"
+)
+
+const (
+	procBase         = "/proc/"
+	procProcessIO    = "/io"
+	ioFieldReadChar  = "rchar"
+	ioFieldWriteChar = "wchar"
+	sepColon         = ':'
+)
+
+// IOBytes return sum of bytes read and written by process, include bytes of pipe and socket.
+func IOBytes(pid int32) (uint64, error) {
+	content, err := os.ReadFile(procBase + strconv.Itoa(int(pid)) + procProcessIO)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		total    uint64
+		n        uint64
+		line     []byte
+		sepIndex int
+	)
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line = s.Bytes()
+		sepIndex = bytes.IndexByte(line, sepColon)
+		if sepIndex <= 0 {
+			continue
+		}
+
+		switch string(line[:sepIndex]) {
+		case ioFieldReadChar, ioFieldWriteChar:
+			n, err = strconv.ParseUint(string(bytes.TrimSpace(line[sepIndex+1:])), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+	}
+
+	return total, nil
+}
+
+// TreeIOBytes return sum of io bytes of process and all of its descendants.
+// Process that exited when walk the tree will be skipped.
+func TreeIOBytes(pid int32) (uint64, error) {
+	total, err := IOBytes(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	childrens, err := id.Children(pid)
+	if err != nil {
+		return total, nil
+	}
+
+	var n uint64
+	for _, child := range childrens {
+		n, err = TreeIOBytes(child.Pid)
+		if err != nil {
+			continue
+		}
+		total += n
+	}
+
+	return total, nil
+}
@@ -88,7 +88,7 @@ func CombinedStack(pid int32, saveDir string) error {
 		saveDir += slashStr
 	}
 	processStackDir := saveDir + strconv.Itoa(int(pid)) + kernelStackDir
-	err = filesystem.CheckOrCreateDir(processStackDir)
+	_, err = filesystem.CheckOrCreateDir(processStackDir, filesystem.PreservePolicy)
 	if err != nil {
 		return err
 	}
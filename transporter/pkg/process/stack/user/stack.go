@@ -56,7 +56,7 @@ func GoroutineStackFile(pid int32, saveDir string) error {
 		saveDir += slashStr
 	}
 	processStackDir := saveDir + strconv.Itoa(int(pid)) + userStackDir
-	err = filesystem.CheckOrCreateDir(processStackDir)
+	_, err = filesystem.CheckOrCreateDir(processStackDir, filesystem.PreservePolicy)
 	if err != nil {
 		return err
 	}
@@ -120,7 +120,7 @@ func StackFile(pid int32, saveDir string) error {
 		saveDir += slashStr
 	}
 	processStackDir := saveDir + strconv.Itoa(int(pid)) + userStackDir
-	err = filesystem.CheckOrCreateDir(processStackDir)
+	_, err = filesystem.CheckOrCreateDir(processStackDir, filesystem.PreservePolicy)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,210 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const (
+	exitCodeMin = 0
+	exitCodeMax = 255
+
+	// mapped exit code must not be 0, otherwise failed run is reported as succeed
+	mappedExitCodeMin = 1
+)
+
+var (
+	ErrClassifyBothClass     = errors.New("exit code is both recoverable and unrecoverable")
+	ErrClassifyRsyncCode     = errors.New("unavailable rsync exit code of mapping, must be integer")
+	ErrClassifyExitCodeRange = errors.New("unavailable exit code of mapping, must in range 1~255")
+	ErrClassifyEmptyMessage  = errors.New("message of stderr matcher is empty")
+)
+
+// StderrMatcher map line of stderr that contain message to exit code.
+type StderrMatcher struct {
+	Message  string `json:"message"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Classification is exit code classification and mapping of rsync wrapper,
+// and also is content format of classification file, for example:
+//
+//	{
+//	    "recoverable": [23],
+//	    "unrecoverable": [30],
+//	    "rsync_exit_code": {"23": 255},
+//	    "stderr_message": [{"message": "No space left on device", "exit_code": 28}]
+//	}
+//
+// Exit code at recoverable or unrecoverable will be moved to the specified class,
+// item of rsync_exit_code will override mapping of the rsync exit code,
+// matcher of stderr_message will override matcher with same message or be added with higher priority,
+// it is also matched before errno that printed by rsync.
+type Classification struct {
+	Recoverable   []int           `json:"recoverable"`
+	Unrecoverable []int           `json:"unrecoverable"`
+	RsyncExitCode map[string]int  `json:"rsync_exit_code"`
+	StderrMessage []StderrMatcher `json:"stderr_message"`
+}
+
+// LoadClassificationFile read classification file and override the effective classification.
+func LoadClassificationFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var c Classification
+	err = json.Unmarshal(content, &c)
+	if err != nil {
+		return err
+	}
+
+	err = ApplyClassification(c)
+	if err != nil {
+		return err
+	}
+
+	log.Println("[Classify-Info]Succeed to load classification file:", path)
+	return nil
+}
+
+// ApplyClassification validate classification and override the effective classification,
+// nothing is changed if classification is unavailable.
+func ApplyClassification(c Classification) error {
+	rsyncExitCode := make(map[int]int, len(c.RsyncExitCode))
+	for k, v := range c.RsyncExitCode {
+		code, err := strconv.Atoi(k)
+		if err != nil {
+			return ErrClassifyRsyncCode
+		}
+
+		if v < mappedExitCodeMin || v > exitCodeMax {
+			return ErrClassifyExitCodeRange
+		}
+
+		rsyncExitCode[code] = v
+	}
+
+	for _, code := range c.Recoverable {
+		if containsInt(c.Unrecoverable, code) {
+			return ErrClassifyBothClass
+		}
+	}
+
+	for _, m := range c.StderrMessage {
+		if len(m.Message) == 0 {
+			return ErrClassifyEmptyMessage
+		}
+
+		if m.ExitCode < mappedExitCodeMin || m.ExitCode > exitCodeMax {
+			return ErrClassifyExitCodeRange
+		}
+	}
+
+	for _, code := range c.Recoverable {
+		unRecoverableErrList = removeInt(unRecoverableErrList, code)
+		if !containsInt(recoverableErrList, code) {
+			recoverableErrList = append(recoverableErrList, code)
+		}
+	}
+
+	for _, code := range c.Unrecoverable {
+		recoverableErrList = removeInt(recoverableErrList, code)
+		if !containsInt(unRecoverableErrList, code) {
+			unRecoverableErrList = append(unRecoverableErrList, code)
+		}
+	}
+
+	for code, exitCode := range rsyncExitCode {
+		rsyncExitCodeMap[code] = exitCode
+	}
+
+	// matcher at classification has higher priority, keep the order of it
+	var msgList []string
+	for _, m := range c.StderrMessage {
+		stdExitCodeMap[m.Message] = m.ExitCode
+		if !containsStr(msgList, m.Message) {
+			msgList = append(msgList, m.Message)
+		}
+	}
+	classifiedMsgList = mergeStr(msgList, classifiedMsgList)
+	stdExitCodeMsgList = mergeStr(msgList, stdExitCodeMsgList)
+
+	return nil
+}
+
+// EffectiveClassification return classification that is used at current.
+func EffectiveClassification() Classification {
+	c := Classification{
+		Recoverable:   append([]int(nil), recoverableErrList...),
+		Unrecoverable: append([]int(nil), unRecoverableErrList...),
+		RsyncExitCode: make(map[string]int, len(rsyncExitCodeMap)),
+		StderrMessage: make([]StderrMatcher, 0, len(stdExitCodeMsgList)),
+	}
+	sort.Ints(c.Recoverable)
+	sort.Ints(c.Unrecoverable)
+
+	for code, exitCode := range rsyncExitCodeMap {
+		c.RsyncExitCode[strconv.Itoa(code)] = exitCode
+	}
+
+	for _, msg := range stdExitCodeMsgList {
+		c.StderrMessage = append(c.StderrMessage, StderrMatcher{
+			Message:  msg,
+			ExitCode: stdExitCodeMap[msg],
+		})
+	}
+
+	return c
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsStr(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeStr return list that items of high are in front of items of low, duplicated items are removed.
+func mergeStr(high, low []string) []string {
+	res := append([]string(nil), high...)
+	for _, s := range low {
+		if !containsStr(res, s) {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+func removeInt(list []int, n int) []int {
+	res := list[:0]
+	for _, v := range list {
+		if v != n {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
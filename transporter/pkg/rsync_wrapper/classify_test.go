@@ -0,0 +1,139 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyClassificationInvalid(t *testing.T) {
+	defer saveClassification()()
+
+	tests := []struct {
+		name   string
+		c      Classification
+		expect error
+	}{
+		{"both class", Classification{Recoverable: []int{23}, Unrecoverable: []int{23}}, ErrClassifyBothClass},
+		{"rsync code not integer", Classification{RsyncExitCode: map[string]int{"x": 1}}, ErrClassifyRsyncCode},
+		{"rsync exit code 0", Classification{RsyncExitCode: map[string]int{"23": 0}}, ErrClassifyExitCodeRange},
+		{"rsync exit code 256", Classification{RsyncExitCode: map[string]int{"23": 256}}, ErrClassifyExitCodeRange},
+		{"empty message", Classification{StderrMessage: []StderrMatcher{{ExitCode: 1}}}, ErrClassifyEmptyMessage},
+		{"message exit code 0", Classification{StderrMessage: []StderrMatcher{{Message: "m", ExitCode: 0}}}, ErrClassifyExitCodeRange},
+		{"message exit code -1", Classification{StderrMessage: []StderrMatcher{{Message: "m", ExitCode: -1}}}, ErrClassifyExitCodeRange},
+	}
+
+	before := EffectiveClassification()
+	for _, tt := range tests {
+		err := ApplyClassification(tt.c)
+		if !errors.Is(err, tt.expect) {
+			t.Error(tt.name, "expect err:", tt.expect, "but get:", err)
+		}
+	}
+
+	after := EffectiveClassification()
+	if len(after.Recoverable) != len(before.Recoverable) || len(after.StderrMessage) != len(before.StderrMessage) ||
+		ExitCodeConvert(ErrPartial) != before.RsyncExitCode["23"] {
+		t.Error("classification should not be changed by unavailable classification")
+	}
+}
+
+func TestApplyClassificationMoveClass(t *testing.T) {
+	defer saveClassification()()
+
+	err := ApplyClassification(Classification{
+		Recoverable:   []int{ErrSyntax},
+		Unrecoverable: []int{ErrPartial},
+		RsyncExitCode: map[string]int{"23": 255},
+	})
+	if err != nil {
+		t.Fatal("failed to apply classification:", err)
+	}
+
+	if !isErrRecoverable(ErrSyntax) || IsErrUnRecoverable(ErrSyntax) {
+		t.Error("ErrSyntax should be moved to recoverable")
+	}
+
+	if isErrRecoverable(ErrPartial) || !IsErrUnRecoverable(ErrPartial) {
+		t.Error("ErrPartial should be moved to unrecoverable")
+	}
+
+	if ExitCodeConvert(ErrPartial) != 255 {
+		t.Error("expect exit code of ErrPartial: 255, but get:", ExitCodeConvert(ErrPartial))
+	}
+
+	c := EffectiveClassification()
+	if !containsInt(c.Recoverable, ErrSyntax) || !containsInt(c.Unrecoverable, ErrPartial) ||
+		c.RsyncExitCode["23"] != 255 {
+		t.Error("unexpected effective classification:", c)
+	}
+}
+
+func TestLoadClassificationFile(t *testing.T) {
+	defer saveClassification()()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "classification.json")
+	err := os.WriteFile(path, []byte(`{
+		"recoverable": [4],
+		"stderr_message": [{"message": "quota exceeded on project", "exit_code": 122}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal("failed to write classification file:", err)
+	}
+
+	err = LoadClassificationFile(path)
+	if err != nil {
+		t.Fatal("failed to load classification file:", err)
+	}
+
+	if !isErrRecoverable(ErrUnsupported) {
+		t.Error("ErrUnsupported should be recoverable")
+	}
+
+	c := EffectiveClassification()
+	if len(c.StderrMessage) == 0 || c.StderrMessage[0] != (StderrMatcher{Message: "quota exceeded on project", ExitCode: 122}) {
+		t.Error("matcher of classification file should be the first, but get:", c.StderrMessage)
+	}
+
+	err = os.WriteFile(path, []byte(`{"recoverable": [`), 0644)
+	if err != nil {
+		t.Fatal("failed to write classification file:", err)
+	}
+
+	err = LoadClassificationFile(path)
+	if err == nil {
+		t.Error("expect err of unavailable json")
+	}
+
+	err = LoadClassificationFile(filepath.Join(dir, "not-exist.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("expect not exist err, but get:", err)
+	}
+}
+
+// saveClassification save the effective classification, return func that restore it.
+func saveClassification() func() {
+	var (
+		recoverable   = append([]int(nil), recoverableErrList...)
+		unRecoverable = append([]int(nil), unRecoverableErrList...)
+		rsyncMap      = make(map[int]int, len(rsyncExitCodeMap))
+		classified    = classifiedMsgList
+		msgList       = stdExitCodeMsgList
+		msgMap        = copyMsgMap(stdExitCodeMap)
+	)
+	for k, v := range rsyncExitCodeMap {
+		rsyncMap[k] = v
+	}
+
+	return func() {
+		recoverableErrList = recoverable
+		unRecoverableErrList = unRecoverable
+		rsyncExitCodeMap = rsyncMap
+		restoreStderrMatchers(classified, msgList, msgMap)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"transporter/pkg/client"
+	"transporter/pkg/rsync_wrapper"
 )
 
 func reportStderr(exitCode int, exitReason, stdErr, addr string, rc *client.ReportClient) error {
@@ -11,6 +12,7 @@ func reportStderr(exitCode int, exitReason, stdErr, addr string, rc *client.Repo
 		Message: stdErr,
 		ErrCode: int64(exitCode),
 		Reason:  exitReason,
+		Errors:  rsync_wrapper.ParseStderr(stdErr),
 	}
 
 	reqContentB, err := json.Marshal(&reqContent)
@@ -0,0 +1,96 @@
+package dir
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"transporter/pkg/exit_code"
+	"transporter/pkg/rsync_wrapper"
+)
+
+const (
+	rsyncOptionDryRun   = "--dry-run"
+	rsyncOptionItemize  = "--itemize-changes"
+	scratchDirPattern   = "rsync-dry-run-"
+	itemizeLineSeparate = "\n"
+	slashStr            = "/"
+)
+
+// DryRun run rsync with --dry-run and --itemize-changes once, return itemized changes and exit code,
+// nothing is changed at dest.
+// If dest is not exist, changes are itemized against an empty scratch dir,
+// because rsync is not able to dry run if parent of dest is not exist, the real run create it first.
+func DryRun(req ReqContent) ([]string, int) {
+	destPath := req.DestPath
+	_, err := os.Stat(destPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Println("[copy-Error]Failed to stat dest of dry run:", destPath, "and err:", err.Error())
+			return nil, exit_code.ExitCodeConvertWithErr(err)
+		}
+
+		destPath, err = os.MkdirTemp("", scratchDirPattern)
+		if err != nil {
+			log.Println("[copy-Error]Failed to create scratch dir of dry run, err:", err.Error())
+			return nil, exit_code.ExitCodeConvertWithErr(err)
+		}
+		defer os.RemoveAll(destPath)
+
+		destPath += slashStr
+		log.Println("[copy-Info]Dest of dry run is not exist, itemize against empty dir:", destPath)
+	}
+
+	var cmdArgList = []string{req.Preserve.RsyncOption(), rsyncOptionDryRun, rsyncOptionItemize}
+	if req.IsHandleSparse {
+		cmdArgList = append(cmdArgList, rsyncOptionSparse)
+	}
+	for _, rule := range req.FilterList {
+		if len(rule) == 0 {
+			continue
+		}
+		cmdArgList = append(cmdArgList, rsyncOptionFilter+rule)
+	}
+	cmdArgList = append(cmdArgList, req.ExtraOptions...)
+	cmdArgList = append(cmdArgList, req.Mirror.rsyncOptions()...)
+	cmdArgList = append(cmdArgList, req.SrcPath, destPath)
+
+	c := exec.Command(rsyncBinPath, cmdArgList...)
+	c.Env = rsync_wrapper.RsyncEnv()
+	log.Println("[copy-Info]cmd string of dry run:", c.String())
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	c.Stdout = &stdoutBuf
+	c.Stderr = &stderrBuf
+
+	var itemizeList []string
+	err = c.Run()
+	for _, line := range strings.Split(stdoutBuf.String(), itemizeLineSeparate) {
+		if len(line) != 0 {
+			itemizeList = append(itemizeList, line)
+		}
+	}
+
+	if err == nil {
+		return itemizeList, exit_code.Succeed
+	}
+
+	stdErr := stderrBuf.String()
+	log.Println("[copy-Warning]Dry run failed, err:", err.Error(), "stderr:", stdErr)
+	rsync_wrapper.LogStderrRecords("[copy-Warning]", rsync_wrapper.ParseStderr(stdErr))
+	exitCodeStderr, ok := rsync_wrapper.ExitCodeConvertWithStderr(stdErr)
+	if ok {
+		return itemizeList, exitCodeStderr
+	}
+
+	var processExitErr *exec.ExitError
+	if errors.As(err, &processExitErr) {
+		return itemizeList, rsync_wrapper.ExitCodeConvert(processExitErr.ExitCode())
+	}
+
+	return itemizeList, rsync_wrapper.ExitCodeConvert(rsync_wrapper.ErrStartCmd)
+}
@@ -0,0 +1,129 @@
+package dir
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"transporter/pkg/client"
+	"transporter/pkg/exit_code"
+)
+
+// Mode of mirror, extraneous files of dest are deleted, so dest is same as src after copy
+const (
+	MirrorDelete      = "delete"       // delete during transfer
+	MirrorDeleteAfter = "delete-after" // delete after transfer
+	MirrorDeleteDelay = "delete-delay" // find deletions during transfer, delete after transfer
+)
+
+const (
+	MaxDeleteUnlimited   = -1
+	rsyncOptionPrefix    = "--"
+	rsyncOptionMaxDelete = "--max-delete="
+	itemizeDeletePrefix  = "*deleting"
+)
+
+var ErrMirrorMode = errors.New("unavailable mirror mode, must be delete, delete-after or delete-delay")
+
+// Mirror is mirror mode of dir copy, empty mode means copy only.
+type Mirror struct {
+	Mode      string
+	MaxDelete int // limit of deleted files, rsync stop deleting and exit with ErrDelLimit if exceeded, negative means no limit
+}
+
+// reqDeletePreview is content of deletion preview that reported before mirror run.
+type reqDeletePreview struct {
+	MirrorMode  string   `json:"mirror_mode"`
+	MaxDelete   int      `json:"max_delete"`   // negative means no limit
+	DeleteCount int      `json:"delete_count"` // num of paths that would be deleted
+	DeleteList  []string `json:"delete_list"`  // paths relative to dest
+	ErrCode     int64    `json:"errcode"`      // exit code of preview, ErrDeleteLimit if exceed max delete
+}
+
+// ParseMirror check mode of mirror, empty mode means disable.
+func ParseMirror(mode string, maxDelete int) (Mirror, error) {
+	switch mode {
+	case "", MirrorDelete, MirrorDeleteAfter, MirrorDeleteDelay:
+	default:
+		return Mirror{}, ErrMirrorMode
+	}
+
+	if maxDelete < 0 {
+		maxDelete = MaxDeleteUnlimited
+	}
+	return Mirror{Mode: mode, MaxDelete: maxDelete}, nil
+}
+
+// IsEnable return true if extraneous files of dest are deleted.
+func (m Mirror) IsEnable() bool {
+	return len(m.Mode) != 0
+}
+
+func (m Mirror) rsyncOptions() []string {
+	if !m.IsEnable() {
+		return nil
+	}
+
+	optionList := []string{rsyncOptionPrefix + m.Mode}
+	if m.MaxDelete != MaxDeleteUnlimited {
+		optionList = append(optionList, rsyncOptionMaxDelete+strconv.Itoa(m.MaxDelete))
+	}
+	return optionList
+}
+
+// DeleteList return paths relative to dest that are deleted at itemized changes of dry run.
+func DeleteList(itemizeList []string) []string {
+	var deleteList []string
+	for _, line := range itemizeList {
+		if strings.HasPrefix(line, itemizeDeletePrefix) {
+			deleteList = append(deleteList, strings.TrimSpace(strings.TrimPrefix(line, itemizeDeletePrefix)))
+		}
+	}
+	return deleteList
+}
+
+// PreviewDelete run dry run of mirror without limit of deletions, log and return paths that would be deleted.
+// Return ErrDeleteLimit if num of deletions exceed max delete of mirror, then nothing should be copied.
+func PreviewDelete(req ReqContent) ([]string, int) {
+	maxDelete := req.Mirror.MaxDelete
+	req.Mirror.MaxDelete = MaxDeleteUnlimited
+	itemizeList, exitCode := DryRun(req)
+	if exitCode != exit_code.Succeed {
+		log.Println("[copy-Error]Failed to preview deletions of mirror, exit code:", exitCode)
+		return nil, exitCode
+	}
+
+	deleteList := DeleteList(itemizeList)
+	for _, path := range deleteList {
+		log.Println("[copy-Info]Mirror would delete:", path)
+	}
+	log.Println("[copy-Info]Preview deletions of mirror, mode:", req.Mirror.Mode,
+		"num of deletions:", len(deleteList),
+		"max delete:", maxDelete)
+
+	if maxDelete != MaxDeleteUnlimited && len(deleteList) > maxDelete {
+		log.Println("[copy-Error]Num of deletions:", len(deleteList), "exceed max delete:", maxDelete)
+		return deleteList, exit_code.ErrDeleteLimit
+	}
+	return deleteList, exit_code.Succeed
+}
+
+// ReportDeletePreview report paths that would be deleted by mirror to addr, it should be called before mirror run.
+func ReportDeletePreview(req ReqContent, deleteList []string, exitCode int) error {
+	reqContent := reqDeletePreview{
+		MirrorMode:  req.Mirror.Mode,
+		MaxDelete:   req.Mirror.MaxDelete,
+		DeleteCount: len(deleteList),
+		DeleteList:  deleteList,
+		ErrCode:     int64(exitCode),
+	}
+
+	reqContentB, err := json.Marshal(&reqContent)
+	if err != nil {
+		return err
+	}
+
+	return req.ReportClient.Report(req.ReportAddr, client.ContentType, reqContentB)
+}
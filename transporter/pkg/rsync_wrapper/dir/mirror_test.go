@@ -0,0 +1,75 @@
+package dir
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"transporter/pkg/client"
+	"transporter/pkg/exit_code"
+)
+
+func TestMirror(t *testing.T) {
+	m, err := ParseMirror(MirrorDeleteAfter, 10)
+	expect := []string{"--delete-after", "--max-delete=10"}
+	if err != nil || !m.IsEnable() || !reflect.DeepEqual(m.rsyncOptions(), expect) {
+		t.Error("expect options:", expect, "but get:", m.rsyncOptions(), err)
+	}
+
+	m, err = ParseMirror(MirrorDelete, -5)
+	if err != nil || m.MaxDelete != MaxDeleteUnlimited || !reflect.DeepEqual(m.rsyncOptions(), []string{"--delete"}) {
+		t.Error("unexpected mirror without limit:", m, m.rsyncOptions(), err)
+	}
+
+	m, err = ParseMirror("", 0)
+	if err != nil || m.IsEnable() || len(m.rsyncOptions()) != 0 {
+		t.Error("mirror should be disable:", m, err)
+	}
+
+	_, err = ParseMirror("delete-before", 0)
+	if !errors.Is(err, ErrMirrorMode) {
+		t.Error("expect err of mirror mode, but get:", err)
+	}
+
+	deleteList := DeleteList([]string{
+		">f+++++++++ dir/new",
+		"*deleting   dir/old file",
+		"*deleting   dir/sub/",
+		"cd+++++++++ dir/",
+	})
+	if !reflect.DeepEqual(deleteList, []string{"dir/old file", "dir/sub/"}) {
+		t.Error("unexpected delete list:", deleteList)
+	}
+}
+
+func TestReportDeletePreview(t *testing.T) {
+	var preview reqDeletePreview
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&preview)
+	}))
+	defer server.Close()
+
+	req := ReqContent{
+		ReportClient: client.NewReportClient(),
+		ReportAddr:   server.URL,
+		Mirror:       Mirror{Mode: MirrorDelete, MaxDelete: 1},
+	}
+	err := ReportDeletePreview(req, []string{"a", "b/c"}, exit_code.ErrDeleteLimit)
+	if err != nil {
+		t.Fatal("failed to report deletion preview:", err)
+	}
+
+	expect := reqDeletePreview{
+		MirrorMode:  MirrorDelete,
+		MaxDelete:   1,
+		DeleteCount: 2,
+		DeleteList:  []string{"a", "b/c"},
+		ErrCode:     exit_code.ErrDeleteLimit,
+	}
+	if !reflect.DeepEqual(preview, expect) {
+		t.Error("expect reported preview:", expect, "but get:", preview)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+	"sync/atomic"
 
 	"transporter/pkg/client"
 	"transporter/pkg/exit_code"
@@ -13,9 +14,7 @@ import (
 )
 
 const (
-	retryMaxLimit       = 3
 	rsyncBinPath        = "/usr/local/bin/rsync"
-	rsyncOptionBasic    = "-rlptgoHA"
 	rsyncOptionProgress = "--progress"
 	rsyncOptionPartial  = "--partial"
 	rsyncOptionSparse   = "--sparse"
@@ -29,6 +28,8 @@ type reqResult struct {
 	Message      string `json:"message"`       // rsync stderr content
 	ErrCode      int64  `json:"errcode"`       // exit code
 	Reason       string `json:"reason"`        // reason of exit error
+
+	Errors []rsync_wrapper.StderrRecord `json:"errors,omitempty"` // failures parsed from rsync stderr
 }
 
 type ReqContent struct {
@@ -40,62 +41,74 @@ type ReqContent struct {
 	ReportClient     *client.ReportClient
 	ReportInterval   int
 	ReportAddr       string
-	RetryLimit       int
+	RetryPolicy      rsync_wrapper.RetryPolicy
+	Preserve         rsync_wrapper.PreserveProfile // attributes preserved at copy, use DefaultPreserveProfile if not sure
 	FilterList       []string
+	ExtraOptions     []string // extra rsync options, must be checked by rsync_wrapper.ParseExtraOptions
+	Mirror           Mirror   // delete extraneous files of dest if enable
+	Timeout          int      // second, limit of total time include retry, not positive means no limit
+	StallTimeout     int      // second, kill rsync if no progress within it, not positive means disable
 }
 
-// Run run rsync command and if err return by rsync is recoverable will auto retry.
+// Run run rsync command and if err return by rsync is recoverable will auto retry follow the retry policy.
 func Run(req ReqContent) int {
 	var (
-		res               resultRsync
-		currentRetryNum   = 0
-		currentRetryLimit int
-		finalExitCode     int
-		isExitDirect      bool = false
+		res           resultRsync
+		finalExitCode int
+		isExitDirect  bool = false
+		retryDecision int
 	)
 
-	currentRetryLimit = req.RetryLimit
-	if currentRetryLimit < 0 {
-		currentRetryLimit = retryMaxLimit
-	}
-	log.Println("[copy-Info]Limit of retry dir copy:", currentRetryLimit)
+	log.Println("[copy-Info]Retry policy of dir copy, limit:", req.RetryPolicy.MaxRetry,
+		"vanished limit:", req.RetryPolicy.MaxVanished,
+		"backoff:", req.RetryPolicy.Backoff.String(),
+		"backoff max:", req.RetryPolicy.BackoffMax.String(),
+		"jitter:", req.RetryPolicy.Jitter,
+		"max duration:", req.RetryPolicy.MaxDuration.String(),
+		"overrides:", req.RetryPolicy.Overrides)
+	log.Println("[copy-Info]Preservation profile of dir copy:", req.Preserve.String())
+	retryState := req.RetryPolicy.NewState()
+
+	wd := rsync_wrapper.NewWatchdog(req.Timeout, req.StallTimeout)
+	log.Println("[copy-Info]Watchdog of dir copy, deadline:", wd.Deadline.String(),
+		"stall timeout:", wd.StallTimeout.String())
 
 	for {
 
-		if currentRetryNum > currentRetryLimit {
+		if wd.IsDeadlineExceeded() {
 			curExitCode := rsync_wrapper.ExitCodeConvert(res.exitCode)
 			if req.IsReportStderr {
 				_ = reportStderr(curExitCode, res.exitReason, res.stdErr, req.ReportAddr, req.ReportClient)
-				_ = reportStderr(exit_code.ErrRetryLimit, exit_code.ErrMsgMaxLimitRetry, res.stdErr, req.ReportAddr, req.ReportClient)
+				_ = reportStderr(exit_code.ErrRunTimeout, exit_code.ErrMsgRunTimeout, res.stdErr, req.ReportAddr, req.ReportClient)
 			}
-			log.Println(exit_code.ErrMsgMaxLimitRetry)
-			log.Println("[Retry Limit]Latest process exit code:", res.exitCode, "latest retry count:", retryMaxLimit)
-			return exit_code.ErrRetryLimit
+			log.Println(exit_code.ErrMsgRunTimeout)
+			log.Println("[Timeout]Latest process exit code:", res.exitCode, "latest retry count:", retryState.RetryNum)
+			return exit_code.ErrRunTimeout
 		}
 
-		res = runRsync(req)
+		res = runRsync(req, wd)
 		if res.exitCode == rsync_wrapper.ErrOK {
 			log.Println(exit_code.ErrMsgSucceed)
 			log.Println("[Complete]process exit code:", res.exitCode, "exit reason:", res.exitReason)
 			return exit_code.Succeed
 		}
 
-		// if stderr of result is not nil, try get std exit code according std eror desc
+		// if stderr of result is not nil, try get std exit code according std eror desc.
+		// if rsync exited because file vanished or killed by watchdog, not match stderr and retry command.
 		if len(res.stdErr) != 0 {
 			log.Println("[copy-Warning]Stderr is not empty:", res.stdErr)
-
-			// last exec, if exit with ErrVanished, retry command.
-			// if rsync exited because file vanished, not count retry num.
-			if res.exitCode == rsync_wrapper.ErrVanished {
-				log.Println("[copy-Warning]File(s) vanished on sender side")
-				continue
-			}
-
-			exitCodeStderr, ok := rsync_wrapper.ExitCodeConvertWithStderr(res.stdErr)
-			if ok {
-				log.Println("[copy-Error]Get exit code from stderr:", exitCodeStderr)
-				finalExitCode = exitCodeStderr
-				isExitDirect = true
+			rsync_wrapper.LogStderrRecords("[copy-Warning]", rsync_wrapper.ParseStderr(res.stdErr))
+
+			if !isSkipMatchStderr(res.exitCode) {
+				exitCodeStderr, ok := rsync_wrapper.ExitCodeConvertWithStderr(res.stdErr)
+				if ok {
+					log.Println("[copy-Error]Get exit code from stderr:", exitCodeStderr)
+					finalExitCode = exitCodeStderr
+					isExitDirect = true
+					if req.IsReportStderr {
+						_ = reportStderr(finalExitCode, res.exitReason, res.stdErr, req.ReportAddr, req.ReportClient)
+					}
+				}
 			}
 		} else {
 			log.Println("[copy-Warning]Stderr is empty")
@@ -106,7 +119,7 @@ func Run(req ReqContent) int {
 			return finalExitCode
 		}
 
-		if rsync_wrapper.IsErrUnRecoverable(res.exitCode) {
+		if req.RetryPolicy.IsUnRecoverable(res.exitCode) {
 			curExitCode := rsync_wrapper.ExitCodeConvert(res.exitCode)
 			if req.IsReportStderr {
 				_ = reportStderr(curExitCode, res.exitReason, res.stdErr, req.ReportAddr, req.ReportClient)
@@ -116,20 +129,40 @@ func Run(req ReqContent) int {
 			return curExitCode
 		}
 
-		// last exec, get a recoverable error, retry command.
-		// if rsync exited because file vanished, not count retry num.
 		if res.exitCode == rsync_wrapper.ErrVanished {
 			log.Println("[copy-Warning]File(s) vanished on sender side")
-			continue
 		}
 
-		currentRetryNum += 1
-		log.Println("[Retry]process count:", currentRetryNum)
+		// last exec, get a recoverable error, wait backoff and retry command.
+		retryDecision = retryState.Next(res.exitCode)
+		if retryDecision != rsync_wrapper.RetryContinue {
+			curExitCode := rsync_wrapper.ExitCodeConvert(res.exitCode)
+			stopExitCode, stopReason := rsync_wrapper.RetryStopExitCode(retryDecision)
+			if req.IsReportStderr {
+				_ = reportStderr(curExitCode, res.exitReason, res.stdErr, req.ReportAddr, req.ReportClient)
+				_ = reportStderr(stopExitCode, stopReason, res.stdErr, req.ReportAddr, req.ReportClient)
+			}
+			log.Println(stopReason)
+			log.Println("[Retry Stop]Latest process exit code:", res.exitCode,
+				"retry decision:", retryDecision,
+				"latest retry count:", retryState.RetryNum,
+				"latest vanished retry count:", retryState.VanishedNum,
+				"exit code:", stopExitCode)
+			return stopExitCode
+		}
+
+		log.Println("[Retry]process count:", retryState.RetryNum, "vanished count:", retryState.VanishedNum)
 		log.Println("[Retry]process exit code:", res.exitCode, "exit reason:", res.exitReason, "stderr:", res.stdErr)
 		log.Println("[Retry]---------------------------------------------------------------------------------------")
 	}
 }
 
+func isSkipMatchStderr(exitCode int) bool {
+	return exitCode == rsync_wrapper.ErrVanished ||
+		exitCode == rsync_wrapper.ErrStalled ||
+		exitCode == rsync_wrapper.ErrDeadline
+}
+
 type resultRsync struct {
 	exitCode   int
 	exitReason string
@@ -137,16 +170,19 @@ type resultRsync struct {
 }
 
 // runRsync run rsync command and get stdout and stderr.
-func runRsync(req ReqContent) (res resultRsync) {
+// If watchdog is enable, rsync will be killed when it is triggered.
+func runRsync(req ReqContent, wd rsync_wrapper.Watchdog) (res resultRsync) {
 	res.exitCode = rsync_wrapper.ErrOK
 	res.exitReason = rsync_wrapper.ErrOKMsg
 
 	var c *exec.Cmd
-	var cmdArgList = []string{rsyncOptionBasic, rsyncOptionPartial}
+	var cmdArgList = []string{req.Preserve.RsyncOption(), rsyncOptionPartial}
 	if req.IsHandleSparse {
 		cmdArgList = append(cmdArgList, rsyncOptionSparse)
 	}
-	if req.IsReportProgress {
+	// progress of stdout is also used by stall detection of watchdog
+	isReadProgress := req.IsReportProgress || wd.StallTimeout > 0
+	if isReadProgress {
 		cmdArgList = append(cmdArgList, rsyncOptionProgress)
 	}
 
@@ -166,13 +202,17 @@ func runRsync(req ReqContent) (res resultRsync) {
 		}
 	}
 
+	cmdArgList = append(cmdArgList, req.ExtraOptions...)
+	cmdArgList = append(cmdArgList, req.Mirror.rsyncOptions()...)
 	cmdArgList = append(cmdArgList, req.SrcPath)
 	cmdArgList = append(cmdArgList, req.DestPath)
 
 	c = exec.Command(rsyncBinPath, cmdArgList...)
+	c.Env = rsync_wrapper.RsyncEnv()
 	log.Println("[copy-Info]cmd string:", c.String())
 
-	if req.IsReportProgress {
+	var curProgressNum, totalProgressNum uint32
+	if isReadProgress {
 		log.Println("[copy-Info]read stdout of cmd turn on")
 
 		stdoutPipe, err := c.StdoutPipe()
@@ -185,9 +225,10 @@ func runRsync(req ReqContent) (res resultRsync) {
 		ctx, cancelProgressFunc := context.WithCancel(context.Background())
 		defer cancelProgressFunc()
 
-		var curProgressNum, totalProgressNum uint32
 		go readStdout(ctx, stdoutPipe, &curProgressNum, &totalProgressNum)
-		go reportProgress(ctx, &curProgressNum, &totalProgressNum, req.ReportAddr, req.ReportClient, req.ReportInterval)
+		if req.IsReportProgress {
+			go reportProgress(ctx, &curProgressNum, &totalProgressNum, req.ReportAddr, req.ReportClient, req.ReportInterval)
+		}
 
 	}
 
@@ -200,6 +241,10 @@ func runRsync(req ReqContent) (res resultRsync) {
 		res.stdErr = stderrBuf.String()
 	}()
 
+	if wd.IsEnable() {
+		rsync_wrapper.PrepareCmd(c)
+	}
+
 	errStart := c.Start()
 	if errStart != nil {
 		res.exitCode = rsync_wrapper.ErrStartCmd
@@ -209,7 +254,36 @@ func runRsync(req ReqContent) (res resultRsync) {
 
 	log.Println("[copy-Info]succeed to start command")
 
+	var (
+		watchResult     chan int
+		cancelWatchFunc context.CancelFunc
+	)
+	if wd.IsEnable() {
+		// progress of dir copy: num of transferred file and io bytes of rsync process tree,
+		// io bytes avoid treat copy of large file as stalled.
+		ioProgress := rsync_wrapper.TreeIOProgress(c.Process.Pid)
+		wd.Progress = func() uint64 {
+			return uint64(atomic.LoadUint32(&curProgressNum)) + ioProgress()
+		}
+
+		var watchCtx context.Context
+		watchCtx, cancelWatchFunc = context.WithCancel(context.Background())
+		defer cancelWatchFunc()
+
+		watchResult = make(chan int, 1)
+		go func() {
+			watchResult <- wd.Watch(watchCtx, c.Process.Pid)
+		}()
+		log.Println("[copy-Info]watchdog of cmd turn on")
+	}
+
 	errWait := c.Wait()
+	if watchResult != nil {
+		cancelWatch(cancelWatchFunc, watchResult, &res)
+		if res.exitCode != rsync_wrapper.ErrOK {
+			return res
+		}
+	}
 	if errWait != nil {
 		log.Println("[copy-Warning]get wait cmd err:", errWait.Error())
 
@@ -234,3 +308,19 @@ func runRsync(req ReqContent) (res resultRsync) {
 
 	return res
 }
+
+// cancelWatch stop watchdog and wait its result after command exited,
+// if watchdog is triggered, set result with exit code of watchdog.
+func cancelWatch(cancelWatchFunc context.CancelFunc, watchResult chan int, res *resultRsync) {
+	cancelWatchFunc()
+	code := <-watchResult
+
+	switch code {
+	case rsync_wrapper.ErrStalled:
+		res.exitCode = code
+		res.exitReason = rsync_wrapper.ErrStalledMsg
+	case rsync_wrapper.ErrDeadline:
+		res.exitCode = code
+		res.exitReason = rsync_wrapper.ErrDeadlineMsg
+	}
+}
@@ -0,0 +1,35 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	envLocaleAll      = "LC_ALL"
+	envLocaleLang     = "LANG"
+	envLocaleLanguage = "LANGUAGE"
+	envLocalePrefix   = "LC_"
+	envLocaleC        = "C"
+	envSep            = "="
+)
+
+// RsyncEnv return environment of rsync child process, locale is forced to C,
+// so that message of stderr is english and able to be matched whatever locale of wrapper is.
+func RsyncEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, envSep, 2)[0]
+		if key == envLocaleLang || key == envLocaleLanguage || strings.HasPrefix(key, envLocalePrefix) {
+			continue
+		}
+
+		env = append(env, kv)
+	}
+
+	env = append(env, envLocaleAll+envSep+envLocaleC, envLocaleLang+envSep+envLocaleC)
+	return env
+}
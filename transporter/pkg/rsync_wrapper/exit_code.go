@@ -13,6 +13,14 @@ import (
 	"transporter/pkg/exit_code"
 )
 
+// message of rsync that is not able to preserve requested attribute
+const (
+	ErrMsgACLNotSupport     = "ACLs are not supported on this client"
+	ErrMsgXattrNotSupport   = "extended attributes are not supported on this client"
+	ErrMsgCrtimesNotSupport = "does not support --crtimes"
+	ErrMsgAtimesNotSupport  = "does not support --atimes"
+)
+
 const (
 	ErrOK    = 0
 	ErrOKMsg = "process succeed complete with exit code 0"
@@ -48,11 +56,13 @@ const (
 	ErrCreatePipe  = -10 // failed to create pipe for stdin/stdout/stderr
 	ErrStartCmd    = -11 // failed to start the specified command
 	ErrWaitProcess = -12 // failed to wait specified command process
+	ErrStalled     = -13 // no progress within stall timeout, killed by watchdog
+	ErrDeadline    = -14 // deadline reached, killed by watchdog
 )
 
 var (
 	// if get recoverable err of rsync, rsync wrapper will retry run rsync command
-	recoverableErrList = [23]int{
+	recoverableErrList = []int{
 		ErrSocketio,
 		ErrFileio,
 		ErrStreamio,
@@ -66,7 +76,6 @@ var (
 		ErrMalloc,
 		ErrPartial,
 		ErrVanished,
-		ErrDelLimit,
 		ErrTimeout,
 		ErrConTimeout,
 		ErrCmdFailed,
@@ -76,16 +85,19 @@ var (
 		ErrCreatePipe,
 		ErrStartCmd,
 		ErrWaitProcess,
+		ErrStalled,
+		ErrDeadline,
 	}
 
 	// if get unRecoverable err of rsync, rsync wrapper will exit direct,
 	// also includes other errors that are unrecoverable and will cause the process to terminate.
-	unRecoverableErrList = [5]int{
+	unRecoverableErrList = []int{
 		ErrSyntax,
 		ErrProtocol,
 		ErrFileselect,
 		ErrUnsupported,
 		ErrStartclient,
+		ErrDelLimit, // retry get the same deletions
 
 		// other errors like:
 		// errSIGKILL
@@ -114,7 +126,7 @@ var (
 		ErrWaitChild:   exit_code.ErrSystem,
 		ErrMalloc:      exit_code.ErrSystem,
 		ErrPartial:     exit_code.ErrPermissionDenied,
-		ErrDelLimit:    exit_code.ErrSystem,
+		ErrDelLimit:    exit_code.ErrDeleteLimit,
 		ErrTimeout:     exit_code.ErrSystem,
 		ErrConTimeout:  exit_code.ErrSystem,
 		ErrCmdFailed:   exit_code.ErrSystem,
@@ -124,10 +136,20 @@ var (
 		ErrCreatePipe:  exit_code.ErrSystem,
 		ErrStartCmd:    exit_code.ErrSystem,
 		ErrWaitProcess: exit_code.ErrSystem,
+		ErrStalled:     exit_code.ErrRunTimeout,
+		ErrDeadline:    exit_code.ErrRunTimeout,
 	}
 
+	// message of matchers that loaded from classification, they are matched before errno printed by rsync,
+	// so that operator is able to override exit code of errno
+	classifiedMsgList []string
+
 	// if get one of these err msg, wrapper should exit directly
-	stdExitCodeMsgList = [12]string{
+	stdExitCodeMsgList = []string{
+		ErrMsgACLNotSupport,
+		ErrMsgXattrNotSupport,
+		ErrMsgCrtimesNotSupport,
+		ErrMsgAtimesNotSupport,
 		exit_code.ErrMsgNOENT,
 		exit_code.ErrMsgIOError,
 		exit_code.ErrMsgPermissionDenided,
@@ -143,6 +165,10 @@ var (
 	}
 
 	stdExitCodeMap = map[string]int{
+		ErrMsgACLNotSupport:               exit_code.ErrACLUnsupported,
+		ErrMsgXattrNotSupport:             exit_code.ErrXattrUnsupported,
+		ErrMsgCrtimesNotSupport:           exit_code.ErrAttrUnsupported,
+		ErrMsgAtimesNotSupport:            exit_code.ErrAttrUnsupported,
 		exit_code.ErrMsgNOENT:             exit_code.ErrNoSuchFileOrDir,
 		exit_code.ErrMsgIOError:           exit_code.ErrIOError,
 		exit_code.ErrMsgPermissionDenided: exit_code.ErrPermissionDenied,
@@ -199,6 +225,9 @@ func ExitCodeConvert(errCode int) int {
 	return exitCode
 }
 
+// ExitCodeConvertWithStderr convert stderr of rsync to linux std exit code,
+// errmsg loaded from classification file is matched first, then errno of the last parsed error line,
+// then match errmsg from the bottom line, errmsg of the classification is preferred, then errmsg of all linux errno.
 func ExitCodeConvertWithStderr(errContent string) (int, bool) {
 	if len(errContent) == 0 {
 		log.Println("[Match-FS-ExitCode]Combined output is empty, end match")
@@ -206,26 +235,60 @@ func ExitCodeConvertWithStderr(errContent string) (int, bool) {
 	}
 
 	log.Println("[Match-FS-ExitCode]Combined output:", errContent)
+
 	errStrList := strings.Split(errContent, "\n")
 
+	// matcher of classification file override errno printed by rsync
+	exitCode, ok := matchStderrMsg(errStrList, classifiedMsgList)
+	if ok {
+		return exitCode, true
+	}
+
+	// errno printed by rsync is preferred, message is matched only if no known errno found
+	exitCode, ok = ExitCodeConvertWithRecords(ParseStderr(errContent))
+	if ok {
+		return exitCode, true
+	}
+
 	errStrLen := len(errStrList)
 	var curErrStr string
 	for i := errStrLen - 1; i >= 0; i -= 1 {
 		curErrStr = errStrList[i]
 
-		for _, msg := range stdExitCodeMsgList {
-			if strings.Contains(curErrStr, msg) {
+		exitCode, ok = matchStderrMsg(errStrList[i:i+1], stdExitCodeMsgList)
+		if ok {
+			return exitCode, true
+		}
+
+		errno, msg, ok := matchErrnoMsg(curErrStr)
+		if ok {
+			log.Println(
+				"[Match-FS-ExitCode]Succeed to match errno msg:", msg,
+				"output line num:", i,
+				"output line content:", curErrStr,
+				"fs exit code:", errno)
+			return errno, true
+		}
+	}
+
+	log.Println("[Match-FS-ExitCode]All combined output has been match with fs errmsg, nothing matched")
+	return 0, false
+}
+
+// matchStderrMsg return exit code of the first message in msgList that contained by line, match from the bottom line.
+func matchStderrMsg(errStrList []string, msgList []string) (int, bool) {
+	for i := len(errStrList) - 1; i >= 0; i -= 1 {
+		for _, msg := range msgList {
+			if strings.Contains(errStrList[i], msg) {
 				exitCode := stdExitCodeMap[msg]
 				log.Println(
 					"[Match-FS-ExitCode]Succeed to match fs errMsg:", msg,
-					"output line num:", i,
-					"output line content:", curErrStr,
+					"output line content:", errStrList[i],
 					"fs exit code:", exitCode)
 				return exitCode, true
 			}
 		}
 	}
 
-	log.Println("[Match-FS-ExitCode]All combined output has been match with fs errmsg, nothing matched")
 	return 0, false
 }
@@ -1,6 +1,8 @@
 package file
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"log"
 	"os"
@@ -22,10 +24,8 @@ import (
 
 const (
 	rsyncBinPath       = "/usr/local/bin/rsync"
-	rsyncOptionBasic   = "-rlptgoHA"
 	rsyncOptionPartial = "--partial"
 	rsyncOptionSparse  = "--sparse"
-	retryMaxLimit      = 3
 	stackBasePath      = "/var/log/rsync-wrapper-stack/"
 	intervalDumpStack  = 3600 // second
 	timeoutWaitDump    = 30   // second
@@ -46,8 +46,12 @@ type ReqContent struct {
 	SrcPath        string
 	DestPath       string
 	IsHandleSparse bool
-	RetryLimit     int
+	RetryPolicy    rsync_wrapper.RetryPolicy
+	Preserve       rsync_wrapper.PreserveProfile // attributes preserved at copy, use DefaultPreserveProfile if not sure
+	ExtraOptions   []string                      // extra rsync options, must be checked by rsync_wrapper.ParseExtraOptions
 	RecordStack    bool
+	Timeout        int // second, limit of total time include retry, not positive means no limit
+	StallTimeout   int // second, kill rsync if no io bytes progress within it, not positive means disable
 }
 
 func isDumpRunning() bool {
@@ -89,7 +93,7 @@ func dumpStack() {
 	)
 
 	saveDir := stackBasePath + taskID
-	err = filesystem.CheckOrCreateDir(saveDir)
+	_, err = filesystem.CheckOrCreateDir(saveDir, filesystem.PreservePolicy)
 	if err != nil {
 		log.Println(
 			"[CopyFile-Warning]Failed to create save dir:", saveDir,
@@ -393,38 +397,71 @@ func recordProcessTree(req reqRecordProcessTree) error {
 func CopyFile(req ReqContent) int {
 
 	var (
-		finalExitCode     int
-		ok                bool
-		currentRetryLimit int
-		currentRetryNum   int
-		stdoutStderr      []byte
-		err               error
+		finalExitCode int
+		ok            bool
+		stdoutStderr  bytes.Buffer
+		err           error
+		watchCode     int
+		retryCode     int
 	)
 
-	currentRetryLimit = req.RetryLimit
-	if currentRetryLimit < 0 {
-		currentRetryLimit = retryMaxLimit
-	}
+	retryState := req.RetryPolicy.NewState()
 
-	cmdContent := []string{rsyncOptionBasic, rsyncOptionPartial}
+	cmdContent := []string{req.Preserve.RsyncOption(), rsyncOptionPartial}
 	if req.IsHandleSparse {
 		cmdContent = append(cmdContent, rsyncOptionSparse)
 	}
 
+	cmdContent = append(cmdContent, req.ExtraOptions...)
 	cmdContent = append(cmdContent, req.SrcPath)
 	cmdContent = append(cmdContent, req.DestPath)
 
+	wd := rsync_wrapper.NewWatchdog(req.Timeout, req.StallTimeout)
+
 	for {
-		if currentRetryNum > currentRetryLimit {
-			log.Println("[CopyFile-Error]Retry limit reached, exit with ErrRetryLImit(208)")
-			return exit_code.ErrRetryLimit
+		// deadline is checked before retry limit like dir copy, run killed by deadline exit with ErrRunTimeout
+		if wd.IsDeadlineExceeded() {
+			log.Println("[CopyFile-Error]Deadline reached:", wd.Deadline.String(),
+				"exit with ErrRunTimeout(206)")
+			waitDumpComplete()
+			return exit_code.ErrRunTimeout
+		}
+
+		if retryCode != rsync_wrapper.ErrOK {
+			retryDecision := retryState.Next(retryCode)
+			if retryDecision != rsync_wrapper.RetryContinue {
+				stopExitCode, stopReason := rsync_wrapper.RetryStopExitCode(retryDecision)
+				log.Println("[CopyFile-Error]Stop retry:", stopReason,
+					"latest exit code:", retryCode,
+					"retry number:", retryState.RetryNum,
+					"vanished retry number:", retryState.VanishedNum,
+					"exit with:", stopExitCode)
+				waitDumpComplete()
+				return stopExitCode
+			}
 		}
 
 		c := exec.Command(rsyncBinPath, cmdContent...)
-		log.Println("[CopyFile-Info]Run command:", c.String(), "retry number:", currentRetryNum)
+		c.Env = rsync_wrapper.RsyncEnv()
+		log.Println("[CopyFile-Info]Run command:", c.String(),
+			"retry number:", retryState.RetryNum,
+			"vanished retry number:", retryState.VanishedNum)
+
+		stdoutStderr.Reset()
+		c.Stdout = &stdoutStderr
+		c.Stderr = &stdoutStderr
 
 		go dumpStack()
-		stdoutStderr, err = c.CombinedOutput()
+		watchCode, err = runWithWatchdog(c, wd)
+		if watchCode != rsync_wrapper.ErrOK {
+			retryCode = watchCode
+			log.Println(
+				"[CopyFile-Warning]Rsync killed by watchdog with code:", watchCode,
+				"output:", stdoutStderr.String(),
+				", it is a recoverable error, will retry exec command")
+			continue
+		}
+
 		if err == nil {
 			waitDumpComplete()
 			return exit_code.Succeed
@@ -450,15 +487,22 @@ func CopyFile(req ReqContent) int {
 			"exit code:", processExitErr.ExitCode(),
 			"subprocess pid", processExitErr.Pid())
 
-		finalExitCode, ok = rsync_wrapper.ExitCodeConvertWithStderr(string(stdoutStderr))
+		processExitCode := processExitErr.ExitCode()
+		if processExitCode == rsync_wrapper.ErrVanished && !req.RetryPolicy.IsUnRecoverable(processExitCode) {
+			retryCode = processExitCode
+			log.Println("[CopyFile-Warning]File vanished on sender side, will retry exec command")
+			continue
+		}
+
+		rsync_wrapper.LogStderrRecords("[CopyFile-Warning]", rsync_wrapper.ParseStderr(stdoutStderr.String()))
+		finalExitCode, ok = rsync_wrapper.ExitCodeConvertWithStderr(stdoutStderr.String())
 		if ok {
 			log.Println("[CopyFile-Error]Matched stand file system exit code and exit:", finalExitCode)
 			waitDumpComplete()
 			return finalExitCode
 		}
 
-		processExitCode := processExitErr.ExitCode()
-		if rsync_wrapper.IsErrUnRecoverable(processExitCode) {
+		if req.RetryPolicy.IsUnRecoverable(processExitCode) {
 			log.Println(
 				"[CopyFile-Error]Get unrecoverable err when copy src:", req.SrcPath,
 				"to dest:", req.DestPath,
@@ -468,9 +512,36 @@ func CopyFile(req ReqContent) int {
 			return finalExitCode
 		}
 
-		currentRetryNum += 1
+		retryCode = processExitCode
 		log.Println("[CopyFile-Warning]Get exit error but it is a recoverable error, will retry exec command")
 		continue
 	}
 
 }
+
+// runWithWatchdog start command and wait it exit, if watchdog is enable,
+// return code of watchdog when command is killed by watchdog.
+func runWithWatchdog(c *exec.Cmd, wd rsync_wrapper.Watchdog) (int, error) {
+	if !wd.IsEnable() {
+		return rsync_wrapper.ErrOK, c.Run()
+	}
+
+	rsync_wrapper.PrepareCmd(c)
+	err := c.Start()
+	if err != nil {
+		return rsync_wrapper.ErrOK, err
+	}
+
+	// progress of file copy: io bytes of rsync process tree
+	wd.Progress = rsync_wrapper.TreeIOProgress(c.Process.Pid)
+
+	watchCtx, cancelWatchFunc := context.WithCancel(context.Background())
+	watchResult := make(chan int, 1)
+	go func() {
+		watchResult <- wd.Watch(watchCtx, c.Process.Pid)
+	}()
+
+	err = c.Wait()
+	cancelWatchFunc()
+	return <-watchResult, err
+}
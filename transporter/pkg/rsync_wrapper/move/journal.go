@@ -0,0 +1,109 @@
+package move
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// Operation of journal entry
+const (
+	JournalOpMove     = "move"
+	JournalOpRollback = "rollback"
+
+	journalSeparator = ".mv-journal."
+	permJournal      = 0644
+)
+
+// JournalEntry is a line of undo journal, format is json, for example:
+//
+//	{"op":"move","old_path":"/mnt/src/dir/a","new_path":"/mnt/dest/a"}
+type JournalEntry struct {
+	Op      string `json:"op"`
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+}
+
+// Journal record each move and rollback to file, it is used to undo moves after failure,
+// and is kept as machine-readable list of moved entries if rollback is not complete.
+type Journal struct {
+	Path  string
+	Moved []JournalEntry // entries that moved and not rollback
+	f     *os.File
+}
+
+// JournalPath return default path of journal that beside src dir.
+func JournalPath(srcDir string) string {
+	srcDir = filepath.Clean(srcDir)
+	return filepath.Join(filepath.Dir(srcDir),
+		stagingPrefix+filepath.Base(srcDir)+journalSeparator+strconv.Itoa(os.Getpid()))
+}
+
+// OpenJournal create journal file, return err if it is exist.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_APPEND, permJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		Path: path,
+		f:    f,
+	}, nil
+}
+
+// Record append entry to journal file and sync it.
+func (j *Journal) Record(op, oldPath, newPath string) error {
+	entry := JournalEntry{
+		Op:      op,
+		OldPath: oldPath,
+		NewPath: newPath,
+	}
+
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(j.f)
+	_, _ = w.Write(line)
+	_ = w.WriteByte('\n')
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = j.f.Sync()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case JournalOpMove:
+		j.Moved = append(j.Moved, entry)
+	case JournalOpRollback:
+		for i := len(j.Moved) - 1; i >= 0; i-- {
+			if j.Moved[i].OldPath == oldPath && j.Moved[i].NewPath == newPath {
+				j.Moved = append(j.Moved[:i], j.Moved[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close close journal file and keep it.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Remove close and remove journal file, it is used if nothing need to undo.
+func (j *Journal) Remove() error {
+	_ = j.f.Close()
+	return os.Remove(j.Path)
+}
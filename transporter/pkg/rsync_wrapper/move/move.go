@@ -0,0 +1,210 @@
+package move
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"transporter/pkg/checksum"
+	"transporter/pkg/client"
+	"transporter/pkg/exit_code"
+	"transporter/pkg/filesystem"
+	"transporter/pkg/rsync_wrapper"
+	"transporter/pkg/rsync_wrapper/dir"
+)
+
+const (
+	slashStr         = "/"
+	stagingPrefix    = "."
+	stagingSeparator = ".mv-staging."
+)
+
+var ErrEntryMissing = errors.New("entry of src is missing at dest after copy")
+
+// CopyError is returned if copy src to staging path failed, ExitCode is exit code of copy.
+type CopyError struct {
+	SrcPath  string
+	DestPath string
+	ExitCode int
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf("failed to copy src: %s to dest: %s, exit code: %d", e.SrcPath, e.DestPath, e.ExitCode)
+}
+
+type ReqContent struct {
+	SrcPath          string
+	DestPath         string
+	SrcMountPath     string // mount point that src is beneath, src is removed relative to it
+	IsReportProgress bool
+	IsReportStderr   bool
+	ReportClient     *client.ReportClient
+	ReportInterval   int
+	ReportAddr       string
+	RetryPolicy      rsync_wrapper.RetryPolicy
+	Preserve         rsync_wrapper.PreserveProfile
+	IsOverwrite      bool // replace dest if it is exist, otherwise dest must be not exist
+}
+
+// ExitCode return exit code of err returned by CrossFSMove.
+func ExitCode(err error) int {
+	var copyErr *CopyError
+	if errors.As(err, &copyErr) {
+		return copyErr.ExitCode
+	}
+
+	return exit_code.ExitCodeConvertWithErr(err)
+}
+
+// StagingPath return hidden path beside dest that src is copied to before rename to dest.
+func StagingPath(destPath string) string {
+	return filepath.Join(filepath.Dir(destPath),
+		stagingPrefix+filepath.Base(destPath)+stagingSeparator+strconv.Itoa(os.Getpid()))
+}
+
+// CrossFSMove move src to dest that at different filesystem, dest must be not exist unless IsOverwrite.
+// Src is copied to staging path beside dest and verified with checksum,
+// then staging path is renamed to dest and src is removed at last,
+// so src is never removed unless dest is complete, and dest never be a partial copy.
+func CrossFSMove(req ReqContent) error {
+	srcPath := filepath.Clean(req.SrcPath)
+	destPath := filepath.Clean(req.DestPath)
+
+	_, err := os.Lstat(destPath)
+	if err == nil {
+		if !req.IsOverwrite {
+			return &os.PathError{Op: "move", Path: destPath, Err: fs.ErrExist}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	stagingPath := StagingPath(destPath)
+	log.Println("[move-Info]Cross filesystem move start, src:", srcPath,
+		"dest:", destPath,
+		"staging:", stagingPath)
+
+	reqCopy := dir.ReqContent{
+		SrcPath:          srcPath,
+		DestPath:         stagingPath,
+		IsReportProgress: req.IsReportProgress,
+		IsReportStderr:   req.IsReportStderr,
+		ReportClient:     req.ReportClient,
+		ReportInterval:   req.ReportInterval,
+		ReportAddr:       req.ReportAddr,
+		RetryPolicy:      req.RetryPolicy,
+		Preserve:         req.Preserve,
+	}
+	if srcInfo.IsDir() {
+		// copy content of src dir into staging dir
+		reqCopy.SrcPath += slashStr
+		reqCopy.DestPath += slashStr
+	}
+
+	log.Println("[move-Info]Step 1 -> copy src:", reqCopy.SrcPath, "to staging:", reqCopy.DestPath)
+	exitCode := dir.Run(reqCopy)
+	if exitCode != exit_code.Succeed {
+		removeStaging(stagingPath)
+		return &CopyError{SrcPath: srcPath, DestPath: stagingPath, ExitCode: exitCode}
+	}
+
+	log.Println("[move-Info]Step 2 -> verify staging:", stagingPath, "with src:", srcPath)
+	err = VerifyTree(srcPath, stagingPath)
+	if err != nil {
+		log.Println("[move-Error]Failed to verify staging:", stagingPath, "and err:", err.Error())
+		removeStaging(stagingPath)
+		return err
+	}
+
+	log.Println("[move-Info]Step 3 -> rename staging:", stagingPath, "to dest:", destPath)
+	if req.IsOverwrite {
+		err = os.Rename(stagingPath, destPath)
+	} else {
+		// dest may be created during copy, it is not replaced
+		err = filesystem.RenameNoReplace(stagingPath, destPath)
+	}
+	if err != nil {
+		removeStaging(stagingPath)
+		return err
+	}
+
+	// dest is complete, failure of remove src only leave src, no data lost
+	log.Println("[move-Info]Step 4 -> remove src:", srcPath)
+	err = RemoveSrc(req.SrcMountPath, srcPath)
+	if err != nil {
+		log.Println("[move-Error]Dest is complete:", destPath, "but failed to remove src:", srcPath,
+			"and err:", err.Error())
+		return err
+	}
+
+	log.Println("[move-Info]Cross filesystem move end, src:", srcPath, "dest:", destPath)
+	return nil
+}
+
+// RemoveSrc remove src and all its children relative to fd of its parent dir that opened beneath mount point,
+// so symlink swapped into path during copy is not followed out of mount point.
+func RemoveSrc(mountPath, srcPath string) error {
+	rel, err := filepath.Rel(mountPath, srcPath)
+	if err != nil || !filepath.IsAbs(srcPath) {
+		return fmt.Errorf("%w: %s of mount point: %s", filesystem.ErrPathEscape, srcPath, mountPath)
+	}
+
+	parentFd, name, err := filesystem.OpenParentBeneath(mountPath, rel)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(parentFd)
+
+	return filesystem.RemoveAllParallelAt(parentFd, name, srcPath, filesystem.RemoveReq{})
+}
+
+// VerifyTree check all entries of src exist at dest with same type, and regular files have same md5.
+func VerifyTree(srcPath, destPath string) error {
+	return filepath.WalkDir(srcPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+
+		destEntryPath := filepath.Join(destPath, rel)
+		destInfo, err := os.Lstat(destEntryPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("%w: %s", ErrEntryMissing, destEntryPath)
+			}
+			return err
+		}
+
+		if destInfo.Mode().Type() != d.Type() {
+			return fmt.Errorf("%w: type of %s is not same as %s", ErrEntryMissing, destEntryPath, path)
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		return checksum.MD5Checksum(path, destEntryPath, false)
+	})
+}
+
+// removeStaging remove staging path that copy or verify failed, failure is only logged.
+func removeStaging(stagingPath string) {
+	err := os.RemoveAll(stagingPath)
+	if err != nil {
+		log.Println("[move-Warning]Failed to remove staging:", stagingPath, "and err:", err.Error())
+	}
+}
@@ -0,0 +1,143 @@
+package move
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"transporter/pkg/checksum"
+	"transporter/pkg/filesystem"
+)
+
+func TestVerifyTree(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+
+	for _, root := range []string{src, dest} {
+		err := os.MkdirAll(filepath.Join(root, "sub"), 0755)
+		if err != nil {
+			t.Error("failed to create dir:", err)
+			t.FailNow()
+		}
+
+		err = os.WriteFile(filepath.Join(root, "sub", "f"), []byte("content"), 0644)
+		if err != nil {
+			t.Error("failed to write file:", err)
+			t.FailNow()
+		}
+	}
+
+	err := VerifyTree(src, dest)
+	if err != nil {
+		t.Error("expect same tree, but get err:", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dest, "sub", "f"), []byte("changed"), 0644)
+	if err != nil {
+		t.Error("failed to write file:", err)
+		t.FailNow()
+	}
+
+	err = VerifyTree(src, dest)
+	if !errors.Is(err, checksum.ErrNotEqual) {
+		t.Error("expect checksum not equal, but get err:", err)
+	}
+
+	err = os.WriteFile(filepath.Join(src, "g"), nil, 0644)
+	if err != nil {
+		t.Error("failed to write file:", err)
+		t.FailNow()
+	}
+
+	err = VerifyTree(src, dest)
+	if !errors.Is(err, ErrEntryMissing) {
+		t.Error("expect entry missing, but get err:", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Error("failed to open journal:", err)
+		t.FailNow()
+	}
+
+	_ = j.Record(JournalOpMove, "/src/a", "/dest/a")
+	_ = j.Record(JournalOpMove, "/src/b", "/dest/b")
+	_ = j.Record(JournalOpRollback, "/src/b", "/dest/b")
+	if len(j.Moved) != 1 || j.Moved[0].OldPath != "/src/a" {
+		t.Error("expect only /src/a is moved, but get:", j.Moved)
+	}
+
+	_, err = OpenJournal(path)
+	if !errors.Is(err, os.ErrExist) {
+		t.Error("expect exist err of journal, but get:", err)
+	}
+
+	err = j.Close()
+	if err != nil {
+		t.Error("failed to close journal:", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Error("failed to read journal:", err)
+		t.FailNow()
+	}
+
+	expect := `{"op":"move","old_path":"/src/a","new_path":"/dest/a"}
+{"op":"move","old_path":"/src/b","new_path":"/dest/b"}
+{"op":"rollback","old_path":"/src/b","new_path":"/dest/b"}
+`
+	if string(content) != expect {
+		t.Error("expect journal:", expect, "but get:", string(content))
+	}
+}
+
+func TestRemoveSrc(t *testing.T) {
+	mountPoint := t.TempDir()
+	outside := t.TempDir()
+
+	for _, path := range []string{filepath.Join(mountPoint, "dir", "sub", "f"), filepath.Join(outside, "sub", "f")} {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			t.Error("failed to write file:", err)
+			t.FailNow()
+		}
+	}
+
+	err := RemoveSrc(mountPoint, filepath.Join(mountPoint, "dir", "sub"))
+	if err != nil {
+		t.Error("failed to remove src:", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(mountPoint, "dir", "sub"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("src should be removed, but get err:", err)
+	}
+
+	// parent of src is swapped with symlink to outside during copy
+	err = os.Remove(filepath.Join(mountPoint, "dir"))
+	if err == nil {
+		err = os.Symlink(outside, filepath.Join(mountPoint, "dir"))
+	}
+	if err != nil {
+		t.Error("failed to swap parent with symlink:", err)
+		t.FailNow()
+	}
+
+	err = RemoveSrc(mountPoint, filepath.Join(mountPoint, "dir", "sub"))
+	if !errors.Is(err, filesystem.ErrPathEscape) {
+		t.Error("expect path escape err, but get:", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(outside, "sub", "f"))
+	if err != nil {
+		t.Error("file outside mount point should be kept, but get err:", err)
+	}
+}
@@ -0,0 +1,116 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	extraOptionSeparator = ","
+	extraOptionValueSep  = "="
+)
+
+// Value kind of extra rsync option
+const (
+	optionValueNone = iota
+	optionValueSize // like: 1.5m, 100K, 10MiB
+	optionValuePath // absolute path
+)
+
+var ErrExtraOption = errors.New("unavailable extra rsync option")
+
+// extraOptionAllowList is rsync options that are able to be passed through, options that change output of
+// progress and stderr, like: --progress, --info, --quiet, are not allowed, because wrapper parse them.
+// Deletion options are not allowed, mirror mode of dir copy should be used, it previews and limits deletions.
+var extraOptionAllowList = map[string]int{
+	"--bwlimit":       optionValueSize,
+	"--checksum":      optionValueNone,
+	"--inplace":       optionValueNone,
+	"--append-verify": optionValueNone,
+	"--compress":      optionValueNone,
+	"--whole-file":    optionValueNone,
+	"--max-size":      optionValueSize,
+	"--link-dest":     optionValuePath,
+}
+
+var optionSizeValue = regexp.MustCompile(`^\d+(\.\d+)?([KMGTPkmgtp]([Ii]?[Bb])?)?$`)
+
+// ParseExtraOptions parse comma separated extra rsync options and check them with allow list,
+// option with value must be long option with =, example: --bwlimit=10m,--checksum,--link-dest=/mnt/prev.
+// Empty means no extra option.
+func ParseExtraOptions(s string) ([]string, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var optionList []string
+	for _, option := range strings.Split(s, extraOptionSeparator) {
+		option = strings.TrimSpace(option)
+		err := CheckExtraOption(option)
+		if err != nil {
+			return nil, err
+		}
+		optionList = append(optionList, option)
+	}
+
+	return optionList, nil
+}
+
+// CheckExtraOption return ErrExtraOption if option is not at allow list or its value is unavailable.
+func CheckExtraOption(option string) error {
+	name, value, hasValue := option, "", false
+	if i := strings.Index(option, extraOptionValueSep); i >= 0 {
+		name, value, hasValue = option[:i], option[i+1:], true
+	}
+
+	kind, ok := extraOptionAllowList[name]
+	if !ok {
+		return fmt.Errorf("%w: %s is not allowed", ErrExtraOption, option)
+	}
+
+	switch kind {
+	case optionValueNone:
+		if hasValue {
+			return fmt.Errorf("%w: %s has no value", ErrExtraOption, name)
+		}
+	case optionValueSize:
+		if !optionSizeValue.MatchString(value) {
+			return fmt.Errorf("%w: %s need size value, like: %s=10m", ErrExtraOption, name, name)
+		}
+	case optionValuePath:
+		if !filepath.IsAbs(value) || hasDotDot(value) {
+			return fmt.Errorf("%w: %s need absolute path without ..", ErrExtraOption, name)
+		}
+	}
+
+	return nil
+}
+
+func hasDotDot(path string) bool {
+	for _, elem := range strings.Split(path, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtraOptionPathList return path values of extra options, like: value of --link-dest,
+// caller should check they are beneath dest mount point.
+func ExtraOptionPathList(optionList []string) []string {
+	var pathList []string
+	for _, option := range optionList {
+		i := strings.Index(option, extraOptionValueSep)
+		if i < 0 || extraOptionAllowList[option[:i]] != optionValuePath {
+			continue
+		}
+		pathList = append(pathList, option[i+1:])
+	}
+	return pathList
+}
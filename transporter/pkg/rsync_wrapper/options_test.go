@@ -0,0 +1,49 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseExtraOptions(t *testing.T) {
+	optionList, err := ParseExtraOptions("--bwlimit=1.5m, --checksum,--max-size=10MiB,--link-dest=/mnt/prev/")
+	expect := []string{"--bwlimit=1.5m", "--checksum", "--max-size=10MiB", "--link-dest=/mnt/prev/"}
+	if err != nil || !reflect.DeepEqual(optionList, expect) {
+		t.Error("expect options:", expect, "but get:", optionList, err)
+	}
+
+	optionList, err = ParseExtraOptions("")
+	if err != nil || len(optionList) != 0 {
+		t.Error("expect no option, but get:", optionList, err)
+	}
+
+	for _, s := range []string{
+		"--progress",
+		"--info=progress2",
+		"-z",
+		"--checksum=1",
+		"--bwlimit",
+		"--bwlimit=fast",
+		"--link-dest=prev",
+		"--link-dest=/mnt/../etc",
+		"--checksum,",
+		"--delete",
+	} {
+		_, err = ParseExtraOptions(s)
+		if !errors.Is(err, ErrExtraOption) {
+			t.Error("expect err of option:", s, "but get:", err)
+		}
+	}
+}
+
+func TestExtraOptionPathList(t *testing.T) {
+	pathList := ExtraOptionPathList([]string{"--bwlimit=1m", "--link-dest=/mnt/prev", "--checksum"})
+	expect := []string{"/mnt/prev"}
+	if !reflect.DeepEqual(pathList, expect) {
+		t.Error("expect path list:", expect, "but get:", pathList)
+	}
+}
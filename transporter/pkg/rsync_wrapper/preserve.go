@@ -0,0 +1,159 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"strings"
+)
+
+// Attribute of preservation profile
+const (
+	PreservePerms     = "perms"
+	PreserveOwner     = "owner"
+	PreserveGroup     = "group"
+	PreserveTimes     = "times"
+	PreserveACLs      = "acls" // imply perms by rsync
+	PreserveXattrs    = "xattrs"
+	PreserveHardlinks = "hardlinks"
+	PreserveDevices   = "devices" // devices and specials
+	PreserveAtimes    = "atimes"
+	PreserveCrtimes   = "crtimes"
+
+	PreserveDefault = "default" // same as fixed option of old version: perms,owner,group,times,acls,hardlinks
+	PreserveNone    = "none"
+)
+
+const (
+	preserveSeparator = ","
+	preserveExclude   = "-"
+	// recursive and copy symlinks as symlinks are always enable
+	rsyncOptionPreserveBase = "-rl"
+)
+
+var ErrPreserveProfile = errors.New("unavailable preservation profile, example: default,xattrs,-owner,-group")
+
+// PreserveProfile is attributes that preserved at copy, it is translated into rsync options.
+type PreserveProfile struct {
+	Perms     bool `json:"perms"`     // -p
+	Owner     bool `json:"owner"`     // -o
+	Group     bool `json:"group"`     // -g
+	Times     bool `json:"times"`     // -t
+	ACLs      bool `json:"acls"`      // -A
+	Xattrs    bool `json:"xattrs"`    // -X
+	Hardlinks bool `json:"hardlinks"` // -H
+	Devices   bool `json:"devices"`   // -D
+	Atimes    bool `json:"atimes"`    // -U
+	Crtimes   bool `json:"crtimes"`   // -N
+}
+
+// DefaultPreserveProfile return profile that same as fixed option -rlptgoHA of old version.
+func DefaultPreserveProfile() PreserveProfile {
+	return PreserveProfile{
+		Perms:     true,
+		Owner:     true,
+		Group:     true,
+		Times:     true,
+		ACLs:      true,
+		Hardlinks: true,
+	}
+}
+
+// ParsePreserveProfile parse comma separated attributes, attribute with prefix - is removed,
+// default and none are able to be used as base, example: default,xattrs,-owner,-group.
+// Empty means default.
+func ParsePreserveProfile(s string) (PreserveProfile, error) {
+	if len(s) == 0 {
+		return DefaultPreserveProfile(), nil
+	}
+
+	var p PreserveProfile
+	for _, item := range strings.Split(s, preserveSeparator) {
+		item = strings.TrimSpace(item)
+		switch item {
+		case PreserveDefault:
+			p = DefaultPreserveProfile()
+			continue
+		case PreserveNone:
+			p = PreserveProfile{}
+			continue
+		}
+
+		isPreserve := !strings.HasPrefix(item, preserveExclude)
+		field := p.field(strings.TrimPrefix(item, preserveExclude))
+		if field == nil {
+			return PreserveProfile{}, ErrPreserveProfile
+		}
+		*field = isPreserve
+	}
+
+	return p, nil
+}
+
+func (p *PreserveProfile) field(name string) *bool {
+	switch name {
+	case PreservePerms:
+		return &p.Perms
+	case PreserveOwner:
+		return &p.Owner
+	case PreserveGroup:
+		return &p.Group
+	case PreserveTimes:
+		return &p.Times
+	case PreserveACLs:
+		return &p.ACLs
+	case PreserveXattrs:
+		return &p.Xattrs
+	case PreserveHardlinks:
+		return &p.Hardlinks
+	case PreserveDevices:
+		return &p.Devices
+	case PreserveAtimes:
+		return &p.Atimes
+	case PreserveCrtimes:
+		return &p.Crtimes
+	}
+	return nil
+}
+
+// RsyncOption return combined short option of rsync, default profile return -rlptgoHA.
+func (p PreserveProfile) RsyncOption() string {
+	option := strings.Builder{}
+	option.WriteString(rsyncOptionPreserveBase)
+	for _, flag := range []struct {
+		enable bool
+		short  byte
+	}{
+		{p.Perms, 'p'},
+		{p.Times, 't'},
+		{p.Group, 'g'},
+		{p.Owner, 'o'},
+		{p.Devices, 'D'},
+		{p.Hardlinks, 'H'},
+		{p.ACLs, 'A'},
+		{p.Xattrs, 'X'},
+		{p.Atimes, 'U'},
+		{p.Crtimes, 'N'},
+	} {
+		if flag.enable {
+			option.WriteByte(flag.short)
+		}
+	}
+	return option.String()
+}
+
+func (p PreserveProfile) String() string {
+	var nameList []string
+	for _, name := range []string{PreservePerms, PreserveOwner, PreserveGroup, PreserveTimes, PreserveACLs,
+		PreserveXattrs, PreserveHardlinks, PreserveDevices, PreserveAtimes, PreserveCrtimes} {
+		if *p.field(name) {
+			nameList = append(nameList, name)
+		}
+	}
+
+	if len(nameList) == 0 {
+		return PreserveNone
+	}
+	return strings.Join(nameList, preserveSeparator)
+}
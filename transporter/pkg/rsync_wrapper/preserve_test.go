@@ -0,0 +1,38 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePreserveProfile(t *testing.T) {
+	cases := map[string]string{
+		"":                             "-rlptgoHA",
+		"default":                      "-rlptgoHA",
+		"none":                         "-rl",
+		"default,xattrs,-owner,-group": "-rlptHAX",
+		"perms,times,devices,atimes":   "-rlptDU",
+		"none,crtimes, hardlinks":      "-rlHN",
+	}
+	for s, expect := range cases {
+		p, err := ParsePreserveProfile(s)
+		if err != nil || p.RsyncOption() != expect {
+			t.Error("profile:", s, "expect option:", expect, "but get:", p.RsyncOption(), err)
+		}
+	}
+
+	for _, s := range []string{"default,owners", "-", "perms,,times"} {
+		_, err := ParsePreserveProfile(s)
+		if !errors.Is(err, ErrPreserveProfile) {
+			t.Error("expect err of profile:", s, "but get:", err)
+		}
+	}
+
+	p, _ := ParsePreserveProfile("default,-acls,xattrs")
+	if p.String() != "perms,owner,group,times,xattrs,hardlinks" {
+		t.Error("unexpected string of profile:", p.String())
+	}
+}
@@ -0,0 +1,212 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"transporter/pkg/exit_code"
+)
+
+const (
+	retryMaxLimitDefault      = 3
+	retryVanishedLimitDefault = 10
+	retryBackoffDefault       = 5   // second
+	retryBackoffMaxDefault    = 300 // second
+	retryBackoffFactorDefault = 2
+	retryJitterDefault        = 0.2
+
+	sepRetryOverride      = ","
+	sepRetryOverrideValue = "="
+	retryOverrideRecover  = "recoverable"
+	retryOverrideFatal    = "unrecoverable"
+)
+
+// result of retry decision
+const (
+	RetryContinue     = 0 // retry command after backoff
+	RetryStopLimit    = 1 // retry limit of recoverable error has been reached
+	RetryStopVanished = 2 // retry limit of vanished file has been reached
+	RetryStopDuration = 3 // max total duration of retry has been reached
+)
+
+var ErrRetryOverrideFormat = errors.New("unavailable format of retry override, example: 23=unrecoverable,30=recoverable")
+
+// RetryPolicy decide whether and when retry rsync command after get an error.
+type RetryPolicy struct {
+	MaxRetry      int           // limit of retry with recoverable error, not include ErrVanished
+	MaxVanished   int           // limit of retry with ErrVanished
+	Backoff       time.Duration // wait time before first retry
+	BackoffMax    time.Duration // limit of wait time before each retry
+	BackoffFactor float64       // multiplier of wait time for each retry
+	Jitter        float64       // random ratio of wait time, range [0, 1]
+	MaxDuration   time.Duration // limit of total time since first run, zero means no limit
+	Overrides     map[int]bool  // exit code -> recoverable, override recoverableErrList and unRecoverableErrList
+}
+
+// NewRetryPolicy return default retry policy, retryLimit < 0 means use default limit.
+func NewRetryPolicy(retryLimit int) RetryPolicy {
+	p := RetryPolicy{
+		MaxRetry:      retryMaxLimitDefault,
+		MaxVanished:   retryVanishedLimitDefault,
+		Backoff:       retryBackoffDefault * time.Second,
+		BackoffMax:    retryBackoffMaxDefault * time.Second,
+		BackoffFactor: retryBackoffFactorDefault,
+		Jitter:        retryJitterDefault,
+	}
+
+	if retryLimit >= 0 {
+		p.MaxRetry = retryLimit
+	}
+
+	return p
+}
+
+// ParseRetryOverrides parse override of exit code, format: 23=unrecoverable,30=recoverable
+func ParseRetryOverrides(s string) (map[int]bool, error) {
+	overrides := make(map[int]bool)
+	if len(s) == 0 {
+		return overrides, nil
+	}
+
+	var (
+		kv   []string
+		code int
+		err  error
+	)
+	for _, item := range strings.Split(s, sepRetryOverride) {
+		if len(item) == 0 {
+			continue
+		}
+
+		kv = strings.Split(item, sepRetryOverrideValue)
+		if len(kv) != 2 {
+			return nil, ErrRetryOverrideFormat
+		}
+
+		code, err = strconv.Atoi(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, ErrRetryOverrideFormat
+		}
+
+		switch strings.TrimSpace(kv[1]) {
+		case retryOverrideRecover:
+			overrides[code] = true
+		case retryOverrideFatal:
+			overrides[code] = false
+		default:
+			return nil, ErrRetryOverrideFormat
+		}
+	}
+
+	return overrides, nil
+}
+
+// IsUnRecoverable return true if exit code should not retry, override is checked first.
+func (p RetryPolicy) IsUnRecoverable(errCode int) bool {
+	isRecoverable, ok := p.Overrides[errCode]
+	if ok {
+		return !isRecoverable
+	}
+
+	return IsErrUnRecoverable(errCode)
+}
+
+// BackoffOf return wait time before retry with number retryNum(start from 1).
+func (p RetryPolicy) BackoffOf(retryNum int, r *rand.Rand) time.Duration {
+	if p.Backoff <= 0 || retryNum <= 0 {
+		return 0
+	}
+
+	backoff := float64(p.Backoff)
+	for i := 1; i < retryNum; i++ {
+		backoff *= p.BackoffFactor
+		if p.BackoffMax > 0 && backoff >= float64(p.BackoffMax) {
+			break
+		}
+	}
+
+	if p.BackoffMax > 0 && backoff > float64(p.BackoffMax) {
+		backoff = float64(p.BackoffMax)
+	}
+
+	if p.Jitter > 0 && r != nil {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		// range: [backoff*(1-jitter), backoff*(1+jitter))
+		backoff = backoff * (1 - jitter + 2*jitter*r.Float64())
+	}
+
+	return time.Duration(backoff)
+}
+
+// RetryState record retry of one copy that follow the retry policy.
+type RetryState struct {
+	Policy      RetryPolicy
+	StartTime   time.Time
+	RetryNum    int
+	VanishedNum int
+	rand        *rand.Rand
+}
+
+// NewState return retry state that start from now.
+func (p RetryPolicy) NewState() *RetryState {
+	return &RetryState{
+		Policy:    p,
+		StartTime: time.Now(),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next count retry of recoverable exit code, wait backoff and return RetryContinue,
+// or return reason of stop retry without wait.
+func (s *RetryState) Next(errCode int) int {
+	var backoff time.Duration
+	if errCode == ErrVanished {
+		s.VanishedNum += 1
+		if s.VanishedNum > s.Policy.MaxVanished {
+			log.Println("[Retry-Warning]Retry limit of vanished file reached:", s.Policy.MaxVanished)
+			return RetryStopVanished
+		}
+		backoff = s.Policy.BackoffOf(s.VanishedNum, s.rand)
+	} else {
+		s.RetryNum += 1
+		if s.RetryNum > s.Policy.MaxRetry {
+			log.Println("[Retry-Warning]Retry limit reached:", s.Policy.MaxRetry)
+			return RetryStopLimit
+		}
+		backoff = s.Policy.BackoffOf(s.RetryNum, s.rand)
+	}
+
+	if s.Policy.MaxDuration > 0 && time.Since(s.StartTime)+backoff > s.Policy.MaxDuration {
+		log.Println("[Retry-Warning]Max duration of retry reached:", s.Policy.MaxDuration.String(),
+			"start at:", s.StartTime.String())
+		return RetryStopDuration
+	}
+
+	log.Println("[Retry-Info]Wait backoff:", backoff.String(),
+		"retry num:", s.RetryNum,
+		"vanished retry num:", s.VanishedNum)
+	time.Sleep(backoff)
+	return RetryContinue
+}
+
+// RetryStopExitCode return exit code and message of the reason of stop retry,
+// max duration of retry is reached means timeout of run.
+func RetryStopExitCode(decision int) (int, string) {
+	switch decision {
+	case RetryStopVanished:
+		return exit_code.ErrRetryLimit, exit_code.ErrMsgVanishedLimit
+	case RetryStopDuration:
+		return exit_code.ErrRunTimeout, exit_code.ErrMsgRetryDuration
+	}
+	return exit_code.ErrRetryLimit, exit_code.ErrMsgMaxLimitRetry
+}
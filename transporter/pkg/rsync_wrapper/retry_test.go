@@ -0,0 +1,102 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"testing"
+	"time"
+
+	"transporter/pkg/exit_code"
+)
+
+func TestParseRetryOverrides(t *testing.T) {
+	overrides, err := ParseRetryOverrides("23=unrecoverable,30=recoverable")
+	if err != nil {
+		t.Error("failed to parse retry overrides:", err)
+		t.FailNow()
+	}
+
+	if overrides[ErrPartial] || !overrides[ErrTimeout] {
+		t.Error("unexpected overrides:", overrides)
+	}
+
+	for _, s := range []string{"23", "x=recoverable", "23=maybe"} {
+		_, err = ParseRetryOverrides(s)
+		if err == nil {
+			t.Error("expect err of unavailable override:", s)
+		}
+	}
+}
+
+func TestRetryPolicyIsUnRecoverable(t *testing.T) {
+	p := NewRetryPolicy(-1)
+	p.Overrides = map[int]bool{ErrPartial: false, ErrSyntax: true}
+
+	if !p.IsUnRecoverable(ErrPartial) {
+		t.Error("ErrPartial is overridden to unrecoverable")
+	}
+
+	if p.IsUnRecoverable(ErrSyntax) {
+		t.Error("ErrSyntax is overridden to recoverable")
+	}
+
+	if !p.IsUnRecoverable(ErrProtocol) {
+		t.Error("ErrProtocol is unrecoverable by default")
+	}
+}
+
+func TestRetryPolicyBackoffOf(t *testing.T) {
+	p := NewRetryPolicy(-1)
+	p.Jitter = 0
+
+	expects := []time.Duration{0, 5 * time.Second, 10 * time.Second, 20 * time.Second}
+	for retryNum, expect := range expects {
+		backoff := p.BackoffOf(retryNum, nil)
+		if backoff != expect {
+			t.Error("retry num:", retryNum, "expect backoff:", expect, "but get:", backoff)
+		}
+	}
+
+	if p.BackoffOf(100, nil) != p.BackoffMax {
+		t.Error("backoff should not large than max backoff")
+	}
+}
+
+func TestRetryStateNext(t *testing.T) {
+	p := NewRetryPolicy(2)
+	p.Backoff = 0
+	p.MaxVanished = 1
+	s := p.NewState()
+
+	if s.Next(ErrVanished) != RetryContinue {
+		t.Error("first vanished retry should continue")
+	}
+
+	if s.Next(ErrVanished) != RetryStopVanished {
+		t.Error("vanished retry should stop when reach limit")
+	}
+
+	if s.Next(ErrPartial) != RetryContinue || s.Next(ErrPartial) != RetryContinue {
+		t.Error("retry should continue before reach limit")
+	}
+
+	if s.Next(ErrPartial) != RetryStopLimit {
+		t.Error("retry should stop when reach limit")
+	}
+}
+
+func TestRetryStopExitCode(t *testing.T) {
+	cases := map[int]int{
+		RetryStopLimit:    exit_code.ErrRetryLimit,
+		RetryStopVanished: exit_code.ErrRetryLimit,
+		RetryStopDuration: exit_code.ErrRunTimeout,
+	}
+
+	for decision, expect := range cases {
+		exitCode, msg := RetryStopExitCode(decision)
+		if exitCode != expect || len(msg) == 0 {
+			t.Error("decision:", decision, "expect exit code:", expect, "but get:", exitCode, msg)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"transporter/pkg/exit_code"
+)
+
+const (
+	quoteStr            = `"`
+	operationFailed     = " failed"
+	operationFailedOn   = " failed on"
+	stderrLineSeparator = "\n"
+
+	// prefix of failed operation that rsync print when set attribute, like:
+	// set_acl: sys_acl_set_file(...), rsync_xal_set: lsetxattr(...), chown, failed to set times on
+	attrOperationACL   = "set_acl:"
+	attrOperationXattr = "rsync_xal_set:"
+	attrOperationChown = "chown"
+	attrOperationChmod = "chmod"
+	attrOperationPerms = "failed to set permissions on"
+	attrOperationTime  = "failed to set times on"
+	attrOperationMknod = "mknod"
+)
+
+// rsync print error line of syscall as: rsync: [role] operation "path" failed: message (errno)
+// role is not printed by old version of rsync, example:
+//
+//	rsync: [receiver] open "/dest/file" failed: Permission denied (13)
+//	rsync: [receiver] write failed on "/dest/file": No space left on device (28)
+//	rsync: [generator] recv_generator: mkdir "/dest/dir" failed: Permission denied (13)
+//	rsync: link_stat "/src/file" failed: No such file or directory (2)
+var stderrErrnoLine = regexp.MustCompile(`^rsync:\s+(?:\[(\w+)\]\s+)?(.*):\s+([^:]+?)\s+\((\d+)\)\s*$`)
+
+// StderrRecord is a failure that parsed from error line of rsync stderr.
+type StderrRecord struct {
+	Role      string `json:"role"`      // rsync process role: sender, receiver, generator, empty if not printed
+	Operation string `json:"operation"` // failed operation, like: open, link_stat, recv_generator: mkdir
+	Path      string `json:"path"`      // path of failed operation, empty if not printed
+	Errno     int    `json:"errno"`     // errno of failed operation
+	Message   string `json:"message"`   // desc of errno
+	Line      int    `json:"line"`      // line num of stderr, start from 0
+}
+
+// ParseStderr parse all error lines with errno of rsync stderr to records, keep order of lines.
+func ParseStderr(errContent string) []StderrRecord {
+	var (
+		records []StderrRecord
+		record  StderrRecord
+		ok      bool
+	)
+
+	for i, line := range strings.Split(errContent, stderrLineSeparator) {
+		record, ok = ParseStderrLine(line)
+		if !ok {
+			continue
+		}
+
+		record.Line = i
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// ParseStderrLine parse error line with errno of rsync stderr to record,
+// return false if line is not an error line with errno.
+func ParseStderrLine(line string) (StderrRecord, bool) {
+	matches := stderrErrnoLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if matches == nil {
+		return StderrRecord{}, false
+	}
+
+	errno, err := strconv.Atoi(matches[4])
+	if err != nil {
+		return StderrRecord{}, false
+	}
+
+	record := StderrRecord{
+		Role:    matches[1],
+		Errno:   errno,
+		Message: matches[3],
+	}
+
+	desc := matches[2]
+	firstQuote := strings.Index(desc, quoteStr)
+	lastQuote := strings.LastIndex(desc, quoteStr)
+	if firstQuote >= 0 && lastQuote > firstQuote {
+		record.Path = desc[firstQuote+1 : lastQuote]
+		desc = desc[:firstQuote]
+	}
+
+	desc = strings.TrimSpace(desc)
+	desc = strings.TrimSuffix(desc, operationFailedOn)
+	desc = strings.TrimSuffix(desc, operationFailed)
+	record.Operation = desc
+
+	return record, true
+}
+
+// transientErrnoList is errno of failure that may not happen again, like: connection between sender and
+// receiver is broken, memory or buffer is not enough, wrapper should not exit directly with it,
+// but retry with exit code of rsync.
+var transientErrnoList = []unix.Errno{
+	unix.EPIPE,
+	unix.ECONNRESET,
+	unix.ECONNREFUSED,
+	unix.ECONNABORTED,
+	unix.ENOTCONN,
+	unix.ENETRESET,
+	unix.ENETDOWN,
+	unix.ENETUNREACH,
+	unix.EHOSTDOWN,
+	unix.EHOSTUNREACH,
+	unix.EAGAIN,
+	unix.EINTR,
+	unix.ETIMEDOUT,
+	unix.ENOMEM,
+	unix.ENOBUFS,
+	unix.EBUSY,
+}
+
+// ExitCodeConvertWithRecords return exit code of the last record that errno is a valid linux errno,
+// if dest is not able to preserve attribute of the record, exit code of the attribute is returned.
+// Record with transient errno is skipped, so it is retried according to exit code of rsync.
+func ExitCodeConvertWithRecords(records []StderrRecord) (int, bool) {
+	for i := len(records) - 1; i >= 0; i -= 1 {
+		if !isLinuxErrno(records[i].Errno) {
+			continue
+		}
+
+		if isTransientErrno(records[i].Errno) {
+			log.Println(
+				"[Match-FS-ExitCode]Skip transient errno of record, role:", records[i].Role,
+				"operation:", records[i].Operation,
+				"errno:", records[i].Errno,
+				"output line num:", records[i].Line)
+			continue
+		}
+
+		exitCode, ok := attrExitCode(records[i])
+		if ok {
+			log.Println(
+				"[Match-FS-ExitCode]Succeed to match unsupported attribute of record, role:", records[i].Role,
+				"operation:", records[i].Operation,
+				"path:", records[i].Path,
+				"errno:", records[i].Errno,
+				"output line num:", records[i].Line,
+				"exit code:", exitCode)
+			return exitCode, true
+		}
+
+		log.Println(
+			"[Match-FS-ExitCode]Succeed to match errno of record, role:", records[i].Role,
+			"operation:", records[i].Operation,
+			"path:", records[i].Path,
+			"errno:", records[i].Errno,
+			"output line num:", records[i].Line)
+		return records[i].Errno, true
+	}
+
+	return 0, false
+}
+
+// attrExitCode return exit code of attribute if operation of record set an attribute and errno means
+// dest is not able to preserve it, like: set_acl with EOPNOTSUPP, chown with EPERM.
+func attrExitCode(record StderrRecord) (int, bool) {
+	var (
+		operation = record.Operation
+		errno     = unix.Errno(record.Errno)
+	)
+	switch {
+	case strings.HasPrefix(operation, attrOperationACL):
+		return exit_code.ErrACLUnsupported, isErrnoIn(errno, unix.EOPNOTSUPP, unix.ENOSYS, unix.EINVAL)
+	case strings.HasPrefix(operation, attrOperationXattr):
+		return exit_code.ErrXattrUnsupported, isErrnoIn(errno, unix.EOPNOTSUPP, unix.ENOSYS, unix.EPERM, unix.E2BIG)
+	case operation == attrOperationChown:
+		return exit_code.ErrOwnerNotPermitted, isErrnoIn(errno, unix.EPERM, unix.EINVAL)
+	case operation == attrOperationChmod, operation == attrOperationPerms,
+		operation == attrOperationTime, operation == attrOperationMknod:
+		return exit_code.ErrAttrUnsupported, isErrnoIn(errno, unix.EOPNOTSUPP, unix.ENOSYS, unix.EPERM)
+	}
+	return 0, false
+}
+
+func isErrnoIn(errno unix.Errno, errnoList ...unix.Errno) bool {
+	for _, e := range errnoList {
+		if errno == e {
+			return true
+		}
+	}
+	return false
+}
+
+// LogStderrRecords print all records of stderr to log.
+func LogStderrRecords(logPrefix string, records []StderrRecord) {
+	for _, r := range records {
+		log.Println(logPrefix+"Rsync failure, role:", r.Role,
+			"operation:", r.Operation,
+			"path:", r.Path,
+			"errno:", r.Errno,
+			"message:", r.Message)
+	}
+}
+
+// isLinuxErrno return true if errno is defined by linux, it is able to be exit code directly.
+func isLinuxErrno(errno int) bool {
+	if errno <= exitCodeMin || errno > exitCodeMax {
+		return false
+	}
+
+	return len(unix.ErrnoName(unix.Errno(errno))) != 0
+}
+
+// isTransientErrno return true if errno is at transientErrnoList.
+func isTransientErrno(errno int) bool {
+	return isErrnoIn(unix.Errno(errno), transientErrnoList...)
+}
+
+// matchErrnoMsg return errno that message is contained by line, the longest message is preferred.
+// message of errno is compared case-insensitively, because desc of go is lower case.
+// Transient errno is not matched.
+func matchErrnoMsg(line string) (int, string, bool) {
+	var (
+		matchedErrno int
+		matchedMsg   string
+		msg          string
+	)
+
+	line = strings.ToLower(line)
+	for errno := exitCodeMin + 1; errno <= exitCodeMax; errno++ {
+		if !isLinuxErrno(errno) || isTransientErrno(errno) {
+			continue
+		}
+
+		msg = unix.Errno(errno).Error()
+		if len(msg) > len(matchedMsg) && strings.Contains(line, msg) {
+			matchedErrno = errno
+			matchedMsg = msg
+		}
+	}
+
+	return matchedErrno, matchedMsg, matchedErrno != 0
+}
@@ -0,0 +1,131 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"testing"
+)
+
+func TestParseStderr(t *testing.T) {
+	stderr := `sending incremental file list
+rsync: [sender] link_stat "/src/a b" failed: No such file or directory (2)
+rsync: [receiver] write failed on "/dest/file": No space left on device (28)
+rsync: [generator] recv_generator: mkdir "/dest/dir" failed: Permission denied (13)
+rsync: open "/dest/old" failed: Permission denied (13)
+rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1338) [sender=3.2.3]`
+
+	expects := []StderrRecord{
+		{Role: "sender", Operation: "link_stat", Path: "/src/a b", Errno: 2, Message: "No such file or directory", Line: 1},
+		{Role: "receiver", Operation: "write", Path: "/dest/file", Errno: 28, Message: "No space left on device", Line: 2},
+		{Role: "generator", Operation: "recv_generator: mkdir", Path: "/dest/dir", Errno: 13, Message: "Permission denied", Line: 3},
+		{Role: "", Operation: "open", Path: "/dest/old", Errno: 13, Message: "Permission denied", Line: 4},
+	}
+
+	records := ParseStderr(stderr)
+	if len(records) != len(expects) {
+		t.Error("expect records:", expects, "but get:", records)
+		t.FailNow()
+	}
+
+	for i := range expects {
+		if records[i] != expects[i] {
+			t.Error("expect record:", expects[i], "but get:", records[i])
+		}
+	}
+
+	exitCode, ok := ExitCodeConvertWithRecords(records)
+	if !ok || exitCode != 13 {
+		t.Error("expect exit code of last record: 13, but get:", exitCode, ok)
+	}
+}
+
+func TestExitCodeConvertWithStderr(t *testing.T) {
+	cases := map[string]int{
+		`rsync: [receiver] rename "/dest/.a.XXX" -> "a": Too many links (31)`:                                               31,
+		`rsync: [receiver] set_acl: sys_acl_set_file(a, ACCESS): Function not implemented`:                                  38,
+		"rsync: [sender] read errors mapping \"/src/a\": Input/output error (5)":                                            5,
+		`rsync: [receiver] set_acl: sys_acl_set_file(a, ACL_TYPE_ACCESS): Operation not supported (95)`:                     213,
+		`rsync: [receiver] rsync_xal_set: lsetxattr(""/dest/a"",""security.selinux"") failed: Operation not supported (95)`: 214,
+		`rsync: [receiver] chown "/dest/a" failed: Operation not permitted (1)`:                                             215,
+		`rsync: [receiver] failed to set times on "/dest/a": Operation not permitted (1)`:                                   216,
+		"rsync: This rsync does not support --crtimes (-N)":                                                                 216,
+		"rsync: extended attributes are not supported on this client":                                                       214,
+		`rsync: [receiver] failed to set permissions on "/dest/a": Operation not permitted (1)`:                             216,
+		`rsync: [receiver] open "/dest/timeline": Operation not permitted (1)`:                                              1,
+		`rsync: [sender] get_xattr_names: llistxattr("/src/a",1024) failed: Operation not permitted (1)`:                    1,
+	}
+
+	for stderr, expect := range cases {
+		exitCode, ok := ExitCodeConvertWithStderr(stderr)
+		if !ok || exitCode != expect {
+			t.Error("stderr:", stderr, "expect exit code:", expect, "but get:", exitCode, ok)
+		}
+	}
+
+	_, ok := ExitCodeConvertWithStderr("rsync error: some files/attrs were not transferred (code 23)")
+	if ok {
+		t.Error("summary line of rsync should not match any errno")
+	}
+
+	for _, stderr := range []string{
+		"rsync: [sender] write error: Broken pipe (32)\nrsync error: error in socket IO (code 10) at io.c(848) [sender=3.2.3]",
+		`rsync: [receiver] read errors mapping "/src/a": Connection reset by peer (104)`,
+		"rsync: connection unexpectedly closed: connection timed out",
+		"rsync: failed to connect to 10.0.0.1 (10.0.0.1): Connection refused (111)\nrsync error: error in socket IO (code 10) at clientserver.c(137) [Receiver=3.2.3]",
+		"ERROR: out of memory in receive_sums [receiver]: Cannot allocate memory (12)",
+		`rsync: [receiver] recv_files: "/dest/a": No route to host (113)`,
+	} {
+		exitCode, ok := ExitCodeConvertWithStderr(stderr)
+		if ok {
+			t.Error("transient errno should be retried, stderr:", stderr, "but get exit code:", exitCode)
+		}
+	}
+
+	exitCode, ok := ExitCodeConvertWithStderr(`rsync: [receiver] write failed on "/dest/file": No space left on device (28)
+rsync: [sender] write error: Broken pipe (32)`)
+	if !ok || exitCode != 28 {
+		t.Error("expect errno before transient errno: 28, but get:", exitCode, ok)
+	}
+}
+
+func TestExitCodeConvertWithStderrOverride(t *testing.T) {
+	defer restoreStderrMatchers(classifiedMsgList, stdExitCodeMsgList, copyMsgMap(stdExitCodeMap))
+
+	stderr := `rsync: [receiver] write failed on "/dest/file": No space left on device (28)`
+	exitCode, ok := ExitCodeConvertWithStderr(stderr)
+	if !ok || exitCode != 28 {
+		t.Error("expect errno of record: 28, but get:", exitCode, ok)
+	}
+
+	err := ApplyClassification(Classification{
+		StderrMessage: []StderrMatcher{{Message: "No space left on device", ExitCode: 99}},
+	})
+	if err != nil {
+		t.Fatal("failed to apply classification:", err)
+	}
+
+	exitCode, ok = ExitCodeConvertWithStderr(stderr)
+	if !ok || exitCode != 99 {
+		t.Error("expect exit code of override: 99, but get:", exitCode, ok)
+	}
+
+	exitCode, ok = ExitCodeConvertWithStderr(`rsync: [receiver] open "/dest/file" failed: Permission denied (13)`)
+	if !ok || exitCode != 13 {
+		t.Error("expect errno of record not overridden: 13, but get:", exitCode, ok)
+	}
+}
+
+func restoreStderrMatchers(classified []string, msgList []string, msgMap map[string]int) {
+	classifiedMsgList = classified
+	stdExitCodeMsgList = msgList
+	stdExitCodeMap = msgMap
+}
+
+func copyMsgMap(msgMap map[string]int) map[string]int {
+	res := make(map[string]int, len(msgMap))
+	for k, v := range msgMap {
+		res[k] = v
+	}
+	return res
+}
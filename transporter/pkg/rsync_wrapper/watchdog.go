@@ -0,0 +1,206 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"transporter/pkg/filesystem"
+	"transporter/pkg/process/counter"
+	"transporter/pkg/process/id"
+	"transporter/pkg/process/stack/kernel"
+	"transporter/pkg/process/stack/user"
+)
+
+const (
+	ErrStalledMsg  = "no progress of rsync command within stall timeout, killed by watchdog"
+	ErrDeadlineMsg = "rsync command still running when deadline reached, killed by watchdog"
+
+	watchdogCheckInterval  = 10 // second
+	watchdogStackDirNoTask = "watchdog-"
+	envSRMTaskID           = "SRM_TASK_ID"
+)
+
+// watchdogStackBasePath is base dir that stack is dumped to when watchdog is triggered
+var watchdogStackBasePath = "/var/log/rsync-wrapper-stack/"
+
+// Watchdog kill rsync command when deadline is reached or no progress within stall timeout.
+type Watchdog struct {
+	Deadline     time.Time     // zero value means no deadline
+	StallTimeout time.Duration // zero value means no stall detection
+	Progress     func() uint64 // progress counter, any change of value is treated as progress
+}
+
+// NewWatchdog return a watchdog, timeout and stallTimeout unit is second, not positive means disable.
+func NewWatchdog(timeout, stallTimeout int) Watchdog {
+	var w Watchdog
+	if timeout > 0 {
+		w.Deadline = time.Now().Add(time.Duration(timeout) * time.Second)
+	}
+
+	if stallTimeout > 0 {
+		w.StallTimeout = time.Duration(stallTimeout) * time.Second
+	}
+
+	return w
+}
+
+// IsEnable return true if deadline or stall detection is specified.
+func (w Watchdog) IsEnable() bool {
+	return !w.Deadline.IsZero() || w.StallTimeout > 0
+}
+
+// IsDeadlineExceeded return true if deadline is specified and has been reached.
+func (w Watchdog) IsDeadlineExceeded() bool {
+	if w.Deadline.IsZero() {
+		return false
+	}
+
+	return !time.Now().Before(w.Deadline)
+}
+
+// PrepareCmd start command in a new process group, so watchdog can kill the whole rsync process tree.
+func PrepareCmd(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &unix.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+}
+
+// TreeIOProgress return a progress counter that based on io bytes of process tree.
+func TreeIOProgress(pid int) func() uint64 {
+	return func() uint64 {
+		n, err := counter.TreeIOBytes(int32(pid))
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+}
+
+// Watch block until ctx is done or watchdog is triggered.
+// If triggered, dump kernel and user stack of process tree, kill the process group of pid
+// and return ErrDeadline or ErrStalled, otherwise return ErrOK.
+func (w Watchdog) Watch(ctx context.Context, pid int) int {
+	if !w.IsEnable() {
+		return ErrOK
+	}
+
+	interval := watchdogCheckInterval * time.Second
+	if w.StallTimeout > 0 && w.StallTimeout < interval {
+		interval = w.StallTimeout
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var (
+		lastProgress     uint64
+		curProgress      uint64
+		lastProgressTime = time.Now()
+		triggerCode      int
+	)
+	if w.Progress != nil {
+		lastProgress = w.Progress()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ErrOK
+
+		case <-t.C:
+		}
+
+		if w.IsDeadlineExceeded() {
+			log.Println("[Watchdog-Warning]Deadline reached:", w.Deadline.String(), "pid:", pid)
+			triggerCode = ErrDeadline
+			break
+		}
+
+		if w.StallTimeout <= 0 || w.Progress == nil {
+			continue
+		}
+
+		curProgress = w.Progress()
+		if curProgress != lastProgress {
+			lastProgress = curProgress
+			lastProgressTime = time.Now()
+			continue
+		}
+
+		if time.Since(lastProgressTime) >= w.StallTimeout {
+			log.Println("[Watchdog-Warning]No progress since:", lastProgressTime.String(),
+				"stall timeout:", w.StallTimeout.String(),
+				"pid:", pid)
+			triggerCode = ErrStalled
+			break
+		}
+	}
+
+	dumpWatchdogStack(int32(pid))
+
+	err := unix.Kill(-pid, unix.SIGKILL)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to kill process group:", pid, "and err:", err.Error())
+	} else {
+		log.Println("[Watchdog-Info]Succeed to kill process group:", pid)
+	}
+
+	return triggerCode
+}
+
+// dumpWatchdogStack dump stack of wrapper process and process tree of rsync,
+// failed to dump stack will not stop the watchdog kill process.
+func dumpWatchdogStack(pid int32) {
+	taskID := os.Getenv(envSRMTaskID)
+	if len(taskID) == 0 {
+		taskID = watchdogStackDirNoTask + strconv.Itoa(int(id.Current()))
+	}
+
+	saveDir := watchdogStackBasePath + taskID
+	_, err := filesystem.CheckOrCreateDir(saveDir, filesystem.PreservePolicy)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to create save dir:", saveDir,
+			"and err:", err.Error(),
+			", abort dump stack!")
+		return
+	}
+
+	err = user.GoroutineStackFile(id.Current(), saveDir)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to dump user stack of wrapper process and err:", err.Error())
+	}
+
+	dumpProcessTreeStack(pid, saveDir)
+	log.Println("[Watchdog-Info]End dump stack of process tree:", pid, "saveDir:", saveDir)
+}
+
+func dumpProcessTreeStack(pid int32, saveDir string) {
+	err := kernel.CombinedStack(pid, saveDir)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to dump kernel stack of pid:", pid, "and err:", err.Error())
+	}
+
+	err = user.StackFile(pid, saveDir)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to dump user stack of pid:", pid, "and err:", err.Error())
+	}
+
+	childrens, err := id.Children(pid)
+	if err != nil {
+		log.Println("[Watchdog-Warning]Failed to get children of pid:", pid, "and err:", err.Error())
+		return
+	}
+
+	for _, child := range childrens {
+		dumpProcessTreeStack(child.Pid, saveDir)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build amd64 && linux
+// +build amd64,linux
+
+package rsync_wrapper
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogWatch(t *testing.T) {
+	defer func(path string) { watchdogStackBasePath = path }(watchdogStackBasePath)
+	watchdogStackBasePath = t.TempDir() + "/"
+
+	var progress uint64
+	tests := []struct {
+		name   string
+		w      Watchdog
+		expect int
+	}{
+		{
+			name: "stalled",
+			w: Watchdog{
+				StallTimeout: 200 * time.Millisecond,
+				Progress:     func() uint64 { return 1 },
+			},
+			expect: ErrStalled,
+		},
+		{
+			name: "deadline",
+			w: Watchdog{
+				Deadline:     time.Now().Add(300 * time.Millisecond),
+				StallTimeout: 100 * time.Millisecond,
+				Progress:     func() uint64 { progress++; return progress },
+			},
+			expect: ErrDeadline,
+		},
+	}
+
+	for _, tt := range tests {
+		c, childPid := startSleepTree(t)
+		exitCode := tt.w.Watch(context.Background(), c.Process.Pid)
+		_ = c.Wait()
+		if exitCode != tt.expect {
+			t.Error(tt.name, "expect exit code:", tt.expect, "but get:", exitCode)
+		}
+
+		if !isProcessGone(childPid, 2*time.Second) {
+			t.Error(tt.name, "child of process group should be killed, pid:", childPid)
+			_ = exec.Command("kill", "-9", strconv.Itoa(childPid)).Run()
+		}
+	}
+}
+
+func TestWatchdogWatchCancel(t *testing.T) {
+	c, childPid := startSleepTree(t)
+	defer func() {
+		_ = c.Process.Kill()
+		_ = c.Wait()
+		_ = exec.Command("kill", "-9", strconv.Itoa(childPid)).Run()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	w := Watchdog{
+		StallTimeout: time.Minute,
+		Progress:     func() uint64 { return 1 },
+	}
+	exitCode := w.Watch(ctx, c.Process.Pid)
+	if exitCode != ErrOK {
+		t.Error("expect exit code of canceled watch:", ErrOK, "but get:", exitCode)
+	}
+
+	if isProcessGone(childPid, 0) {
+		t.Error("process should not be killed if watch is canceled")
+	}
+}
+
+// startSleepTree start shell in a new process group with a sleeping child, return pid of child.
+func startSleepTree(t *testing.T) (*exec.Cmd, int) {
+	c := exec.Command("sh", "-c", "sleep 60 & echo $!; wait")
+	PrepareCmd(c)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal("failed to get stdout of command:", err)
+	}
+
+	err = c.Start()
+	if err != nil {
+		t.Fatal("failed to start command:", err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal("failed to read pid of child:", err)
+	}
+
+	childPid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal("unavailable pid of child:", line)
+	}
+
+	return c, childPid
+}
+
+// isProcessGone return true if process is not exist or is zombie within timeout.
+func isProcessGone(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		content, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return true
+		}
+
+		// state is the field after the last ')' of comm
+		fields := strings.Fields(string(content[strings.LastIndexByte(string(content), ')')+1:]))
+		if len(fields) != 0 && fields[0] == "Z" {
+			return true
+		}
+
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,331 @@
+package trash
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"transporter/pkg/filesystem"
+)
+
+// Layout of trash dir at root of mount point:
+//
+//	<mount>/.transporter-trash/files/<id>      trashed file or dir
+//	<mount>/.transporter-trash/info/<id>.json  metadata of trashed entry
+const (
+	DirName      = ".transporter-trash"
+	filesDirName = "files"
+	infoDirName  = "info"
+	infoSuffix   = ".json"
+
+	envSRMTaskID = "SRM_TASK_ID"
+	permInfo     = 0644
+)
+
+var (
+	ErrInTrash = errors.New("path is in trash dir")
+	ErrInfo    = errors.New("unavailable metadata of trash entry")
+)
+
+// Info is metadata of trashed entry, OriginalPath is relative to mount point,
+// so entry is able to be restored even if mount point is changed.
+type Info struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	TaskID       string    `json:"task_id"`
+	IsDir        bool      `json:"is_dir"`
+}
+
+// Trash is the trash dir of a mount point.
+type Trash struct {
+	MountPath string
+	Path      string
+	Policy    filesystem.PermPolicy // permission policy of dirs created by trash and restore
+}
+
+// New return trash of mount point, trash dir is created when the first entry is put.
+func New(mountPath string, policy filesystem.PermPolicy) Trash {
+	return Trash{
+		MountPath: filepath.Clean(mountPath),
+		Path:      filepath.Join(mountPath, DirName),
+		Policy:    policy,
+	}
+}
+
+// Contains return true if path is trash dir or in it.
+func (t Trash) Contains(path string) bool {
+	path = filepath.Clean(path)
+	return path == t.Path || strings.HasPrefix(path, t.Path+string(filepath.Separator))
+}
+
+// Put move path into trash, path must be absolute path under mount point.
+// Metadata is written before move, so a moved entry always has metadata.
+func (t Trash) Put(path string) (Info, error) {
+	path = filepath.Clean(path)
+	if t.Contains(path) {
+		return Info{}, &os.PathError{Op: "trash", Path: path, Err: ErrInTrash}
+	}
+
+	relativePath, err := filepath.Rel(t.MountPath, path)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return Info{}, &os.PathError{Op: "trash", Path: path, Err: unix.EINVAL}
+	}
+
+	pInfo, err := os.Lstat(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	for _, dir := range []string{filepath.Join(t.Path, filesDirName), filepath.Join(t.Path, infoDirName)} {
+		_, err = filesystem.CheckOrCreateDir(dir, t.Policy)
+		if err != nil {
+			return Info{}, err
+		}
+	}
+
+	info := Info{
+		ID:           strconv.FormatInt(time.Now().UnixNano(), 10) + "." + strconv.Itoa(os.Getpid()),
+		OriginalPath: relativePath,
+		DeletedAt:    time.Now().UTC(),
+		TaskID:       os.Getenv(envSRMTaskID),
+		IsDir:        pInfo.IsDir(),
+	}
+
+	err = t.writeInfo(info)
+	if err != nil {
+		return Info{}, err
+	}
+
+	err = os.Rename(path, t.EntryPath(info.ID))
+	if err != nil {
+		_ = os.Remove(t.infoPath(info.ID))
+		return Info{}, err
+	}
+
+	return info, nil
+}
+
+// Get return metadata of entry.
+func (t Trash) Get(id string) (Info, error) {
+	var info Info
+	if len(id) == 0 || strings.ContainsRune(id, filepath.Separator) {
+		return info, &os.PathError{Op: "trash", Path: id, Err: unix.EINVAL}
+	}
+
+	content, err := os.ReadFile(t.infoPath(id))
+	if err != nil {
+		return info, err
+	}
+
+	err = json.Unmarshal(content, &info)
+	if err != nil || info.ID != id {
+		return info, &os.PathError{Op: "trash", Path: t.infoPath(id), Err: ErrInfo}
+	}
+
+	return info, nil
+}
+
+// List return metadata of all entries, order by deletion time.
+// Unavailable metadata is skipped, empty list is returned if trash is not exist.
+func (t Trash) List() ([]Info, error) {
+	names, err := readDirNames(filepath.Join(t.Path, infoDirName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var (
+		infoList []Info
+		info     Info
+	)
+	for _, name := range names {
+		if !strings.HasSuffix(name, infoSuffix) {
+			continue
+		}
+
+		info, err = t.Get(strings.TrimSuffix(name, infoSuffix))
+		if err != nil {
+			continue
+		}
+		infoList = append(infoList, info)
+	}
+
+	sort.Slice(infoList, func(i, j int) bool {
+		return infoList[i].DeletedAt.Before(infoList[j].DeletedAt)
+	})
+	return infoList, nil
+}
+
+// Restore move entry back to original path, conflict of original path is resolved by policy.
+// Parent dir of original path is created by permission policy of trash if it is not exist.
+// Return restored path, it is empty if restore is skipped by policy.
+func (t Trash) Restore(id string, policy filesystem.ConflictPolicy) (string, error) {
+	result, err := t.ResolveRestore(id, policy)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Skip {
+		return "", nil
+	}
+
+	// symlink may be swapped into original path after resolve
+	for _, path := range []string{result.Path, result.BackupPath} {
+		if len(path) == 0 {
+			continue
+		}
+
+		err = filesystem.CheckAbsPathBeneath(t.MountPath, path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = filesystem.CheckOrCreateDir(filepath.Dir(result.Path), t.Policy)
+	if err != nil {
+		return "", err
+	}
+
+	err = result.Replace(t.EntryPath(id))
+	if err != nil {
+		return "", err
+	}
+
+	_ = os.Remove(t.infoPath(id))
+	return result.Path, nil
+}
+
+// ResolveRestore resolve conflict of original path of entry by policy, it does not change anything.
+func (t Trash) ResolveRestore(id string, policy filesystem.ConflictPolicy) (filesystem.ConflictResult, error) {
+	info, err := t.Get(id)
+	if err != nil {
+		return filesystem.ConflictResult{}, err
+	}
+
+	originalPath := filepath.Join(t.MountPath, info.OriginalPath)
+	if t.Contains(originalPath) {
+		return filesystem.ConflictResult{}, &os.PathError{Op: "restore", Path: originalPath, Err: ErrInTrash}
+	}
+
+	err = filesystem.CheckPathBeneath(t.MountPath, info.OriginalPath)
+	if err != nil {
+		return filesystem.ConflictResult{}, err
+	}
+
+	return policy.Resolve(t.EntryPath(id), originalPath)
+}
+
+// Purge remove entry from trash permanently, metadata is removed at last,
+// so a partially removed entry is still listed and able to be purged again.
+func (t Trash) Purge(id string) error {
+	_, err := t.Get(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(t.EntryPath(id))
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(t.infoPath(id))
+}
+
+// Expire purge entries that deleted before now minus retention, return purged entries
+// and the first err, entries failed to purge are kept and others are continued.
+func (t Trash) Expire(retention time.Duration, now time.Time) ([]Info, error) {
+	expired, err := t.Expired(retention, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		purged   []Info
+		firstErr error
+	)
+	for _, info := range expired {
+		err = t.Purge(info.ID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged = append(purged, info)
+	}
+
+	return purged, firstErr
+}
+
+// Expired return entries that deleted before now minus retention.
+func (t Trash) Expired(retention time.Duration, now time.Time) ([]Info, error) {
+	infoList, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Info
+	deadline := now.Add(-retention)
+	for _, info := range infoList {
+		if info.DeletedAt.Before(deadline) {
+			expired = append(expired, info)
+		}
+	}
+
+	return expired, nil
+}
+
+// EntryPath return path of trashed file or dir of entry.
+func (t Trash) EntryPath(id string) string {
+	return filepath.Join(t.Path, filesDirName, id)
+}
+
+func (t Trash) infoPath(id string) string {
+	return filepath.Join(t.Path, infoDirName, id+infoSuffix)
+}
+
+func (t Trash) writeInfo(info Info) error {
+	content, err := json.Marshal(&info)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.infoPath(info.ID), unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL, permInfo)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(t.infoPath(info.ID))
+	}
+	return err
+}
+
+func readDirNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdirnames(-1)
+}
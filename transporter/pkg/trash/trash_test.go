@@ -0,0 +1,137 @@
+package trash
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"transporter/pkg/filesystem"
+)
+
+func TestTrash(t *testing.T) {
+	mount := t.TempDir()
+	path := filepath.Join(mount, "dir", "file")
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	_ = os.WriteFile(path, []byte("content"), 0644)
+	t.Setenv(envSRMTaskID, "task-1")
+
+	bin := New(mount, filesystem.PreservePolicy)
+	info, err := bin.Put(path)
+	if err != nil || info.OriginalPath != "dir/file" || info.TaskID != "task-1" {
+		t.Error("failed to put file to trash:", info, err)
+		t.FailNow()
+	}
+
+	_, err = os.Stat(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("file should be moved to trash, but get:", err)
+	}
+
+	_, err = bin.Put(bin.Path)
+	if !errors.Is(err, ErrInTrash) {
+		t.Error("expect err of trash dir, but get:", err)
+	}
+
+	infoList, _ := bin.List()
+	if len(infoList) != 1 || infoList[0].ID != info.ID {
+		t.Error("unexpected entries of trash:", infoList)
+	}
+
+	// parent of original path is removed after trash
+	_ = os.Remove(filepath.Dir(path))
+	policy, _ := filesystem.ParseConflictPolicy(filesystem.ConflictFail, "")
+	restoredPath, err := bin.Restore(info.ID, policy)
+	if err != nil || restoredPath != path {
+		t.Error("failed to restore:", restoredPath, err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "content" {
+		t.Error("unexpected content of restored file:", string(content))
+	}
+
+	_, err = bin.Get(info.ID)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("metadata should be removed after restore, but get:", err)
+	}
+}
+
+func TestTrashExpire(t *testing.T) {
+	mount := t.TempDir()
+	bin := New(mount, filesystem.PreservePolicy)
+	for _, name := range []string{"a", "b"} {
+		_ = os.WriteFile(filepath.Join(mount, name), nil, 0644)
+		_, err := bin.Put(filepath.Join(mount, name))
+		if err != nil {
+			t.Error("failed to put file to trash:", err)
+			t.FailNow()
+		}
+	}
+
+	purged, err := bin.Expire(time.Hour, time.Now())
+	if err != nil || len(purged) != 0 {
+		t.Error("entries should not expire:", purged, err)
+	}
+
+	purged, err = bin.Expire(time.Hour, time.Now().Add(2*time.Hour))
+	if err != nil || len(purged) != 2 {
+		t.Error("entries should expire:", purged, err)
+	}
+
+	infoList, _ := bin.List()
+	if len(infoList) != 0 {
+		t.Error("trash should be empty:", infoList)
+	}
+}
+
+func TestTrashRestoreConfine(t *testing.T) {
+	mount := t.TempDir()
+	outside := t.TempDir()
+	path := filepath.Join(mount, "dir", "sub", "file")
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	_ = os.WriteFile(path, nil, 0644)
+
+	policy, err := filesystem.ParsePermPolicy("enforce:0750")
+	if err != nil {
+		t.Fatal("failed to parse permission policy:", err)
+	}
+
+	bin := New(mount, policy)
+	info, err := bin.Put(path)
+	if err != nil {
+		t.Fatal("failed to put file to trash:", err)
+	}
+
+	pInfo, err := os.Stat(filepath.Join(bin.Path, filesDirName))
+	if err != nil || pInfo.Mode().Perm() != 0750 {
+		t.Error("trash dir should be created by policy, but get:", pInfo, err)
+	}
+
+	// parent of original path is swapped with symlink to outside
+	_ = os.RemoveAll(filepath.Join(mount, "dir"))
+	_ = os.Symlink(outside, filepath.Join(mount, "dir"))
+	conflictPolicy, _ := filesystem.ParseConflictPolicy(filesystem.ConflictFail, "")
+	_, err = bin.Restore(info.ID, conflictPolicy)
+	if !errors.Is(err, filesystem.ErrPathEscape) {
+		t.Error("expect path escape err, but get:", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(outside, "sub"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("nothing should be created outside mount point, but get:", err)
+	}
+
+	_ = os.Remove(filepath.Join(mount, "dir"))
+	restoredPath, err := bin.Restore(info.ID, conflictPolicy)
+	if err != nil || restoredPath != path {
+		t.Fatal("failed to restore:", restoredPath, err)
+	}
+
+	pInfo, err = os.Stat(filepath.Dir(path))
+	if err != nil || pInfo.Mode().Perm() != 0750 {
+		t.Error("parent of restored path should be created by policy, but get:", pInfo, err)
+	}
+}